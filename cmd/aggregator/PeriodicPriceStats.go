@@ -1,117 +1,101 @@
 package main
 
 import (
-	"context"
-	"encoding/json"
-	"log"
 	"strconv"
 	"time"
 
 	"github.com/kaanureyen/tradebot/cmd/shared"
-	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func PeriodicPriceStats(subCh string, period time.Duration, shutdownOrchestrator *shared.ShutdownOrchestrator) chan AggregatedTradeInfo {
-	stop, finished := shutdownOrchestrator.Get()
+func PeriodicPriceStats(subCh string, period time.Duration, shutdownOrchestrator *shared.ShutdownOrchestrator, onUpdate func(shared.AggregatedTradeInfo)) chan shared.AggregatedTradeInfo {
+	stop := shutdownOrchestrator.Context(shared.PhaseStopIngest, "trade subscription")
+	_, finished := shutdownOrchestrator.Add(shared.PhaseDrainPipeline, "bar aggregation")
 	return calculatePriceStats(
-		unmarshalTradeDatePrice(
-			subscribeRedis(
-				subCh,
+		shared.UnmarshalTradeDatePrice(
+			shared.SubscribeRedis(
 				stop,
+				subCh,
 			),
 		),
 		time.Now().Truncate(24*time.Hour),
 		period,
 		finished,
+		onUpdate,
 	)
 }
 
-// calculates and sends AggregateTradeInfo-s from TradeDatePrice-s from a start date per each resolution
-func calculatePriceStats(chDatePrice chan shared.TradeDatePrice, startDate time.Time, resolution time.Duration, finished chan struct{}) chan AggregatedTradeInfo {
+// calculates and sends AggregateTradeInfo-s from TradeDatePrice-s from a start date per each resolution.
+// onUpdate, if not nil, is called with the aggregation in progress after each trade
+func calculatePriceStats(chDatePrice chan shared.TradeDatePrice, startDate time.Time, resolution time.Duration, finished func(), onUpdate func(shared.AggregatedTradeInfo)) chan shared.AggregatedTradeInfo {
 	lastSentDate := startDate
+	symbol, res := shared.Symbol, resolution.String()
+	trades := 0 // in the bar in progress
 
-	var curAgg AggregatedTradeInfo
+	var curAgg shared.AggregatedTradeInfo
 	curAgg.SetDefault()
 
-	out := make(chan AggregatedTradeInfo)
+	out := make(chan shared.AggregatedTradeInfo)
+	tradeLog := shared.RateLimited(barLog, shared.LogRateLimit) // once per trade otherwise
 	go func() {
 		defer func() {
 			close(out)
-			finished <- struct{}{}
+			finished()
 		}()
 
 		for v := range chDatePrice {
+			start := time.Now()
+			ctx, span := shared.StartSpan(shared.TraceContext(v.Trace), "aggregate")
 			// parse price to float
 			p, err := strconv.ParseFloat(v.Price, 64)
 			if err != nil {
-				log.Println("[Warning] while parsing price as float. Skipping the data. Error:: ", err)
+				shared.EndSpan(span, err)
+				shared.DroppedTrades.WithLabelValues("invalid", symbol, res).Inc()
+				tradeLog.Warn("Skipping the trade with an invalid price", "price", v.Price, "error", err)
 				continue
 			}
+			// quantity is optional, older fetchers did not publish it
+			q := 0.0
+			if v.Quantity != "" {
+				q, err = strconv.ParseFloat(v.Quantity, 64)
+				if err != nil {
+					tradeLog.Warn("Using 0 for an invalid quantity", "quantity", v.Quantity, "error", err)
+					q = 0
+				}
+			}
 
 			// determine its time-group
 			d := time.UnixMilli(v.TradeDate)
 			delta := d.Sub(lastSentDate)
 			if delta >= resolution { // latest received message belongs to the next group
-				if !curAgg.IsDefault() { // send current aggregation if populated
+				if !curAgg.IsDefault() { // send current aggregation if populated. its trace continues from this trade
+					shared.BarTrades.WithLabelValues(symbol, res).Observe(float64(trades))
+					if empty := delta/resolution - 1; empty > 0 { // periods between the bar and this trade
+						shared.EmptyBars.WithLabelValues(symbol, res).Add(float64(empty))
+					}
+					span.SetAttributes(attribute.Bool("bar.closed", true))
+					curAgg.Trace = shared.TraceCarrier(ctx)
 					out <- curAgg
 				}
 				curAgg.SetDefault() // reset for the next time group
+				trades = 0
 
 				lastSentDate = lastSentDate.Add((delta / resolution) * resolution) // move the time group marker forward
 
 			}
 			if delta >= 0 {
-				curAgg.Update(d, p)
-			} else {
-				log.Println("[Warning] Discarding data:", v, "due to having a timestamp before the last processed interval:", lastSentDate)
-			}
-		}
-	}()
-	return out
-}
-
-func unmarshalTradeDatePrice(inp chan string) chan shared.TradeDatePrice {
-	out := make(chan shared.TradeDatePrice)
-	go func() {
-		defer close(out)
-		for msg := range inp {
-			var msgStruct shared.TradeDatePrice
-			err := json.Unmarshal([]byte(msg), &msgStruct)
-			if err != nil {
-				log.Println("[Warning] Failed to unmarshal to TradeDatePrice. Skipping the data. Error::", err)
-				continue
-			}
-			out <- msgStruct
-		}
-	}()
-	return out
-}
-
-// accepts redis channel name to connect. returns redis message receive channel
-func subscribeRedis(subCh string, done chan struct{}) chan string {
-	var rdb = redis.NewClient(&redis.Options{
-		Addr: shared.RedisAddress,
-	})
-	var ctx = context.Background()
-	out := make(chan string)
-	go func() {
-		defer close(out)
-		for {
-			ch := rdb.Subscribe(ctx, subCh).Channel()
-
-			for {
-				select {
-				case v, ok := <-ch:
-					if !ok {
-						break
-					}
-					out <- v.Payload
-
-				case <-done:
-					log.Println("[Info] Stopping subscription:", subCh)
-					return
+				curAgg.Update(d, p, q)
+				trades++
+				if onUpdate != nil {
+					onUpdate(curAgg)
 				}
+			} else {
+				span.SetAttributes(attribute.Bool("trade.late", true))
+				shared.DroppedTrades.WithLabelValues("late", symbol, res).Inc()
+				tradeLog.Warn("Discarding the trade before the bar in progress", "trade_time", d, "bar_start", lastSentDate)
 			}
+			span.End()
+			shared.ObserveStage("aggregate", symbol, res, start)
 		}
 	}()
 	return out
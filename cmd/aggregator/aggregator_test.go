@@ -1,7 +1,16 @@
 package main
 
 import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/kaanureyen/tradebot/cmd/shared"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestDummy(t *testing.T) {
@@ -12,3 +21,171 @@ func TestDummy(t *testing.T) {
 	}
 
 }
+
+func TestBarsFromTrades(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	trades := []histTrade{
+		{start.Add(1 * time.Second), 100, 1},
+		{start.Add(5 * time.Second), 105, 2},
+		{start.Add(9 * time.Second), 95, 1},
+		{start.Add(16 * time.Second), 101, 3},
+		{start.Add(46 * time.Second), 102, 1}, // after an empty bar
+	}
+	bars := barsFromTrades(trades, 15*time.Second)
+	if len(bars) != 3 {
+		t.Fatalf("got %v bars; want 3", len(bars))
+	}
+	b := bars[0]
+	if b.FirstPrice != 100 || b.MaxPrice != 105 || b.MinPrice != 95 || b.LastPrice != 95 || b.Volume != 4 {
+		t.Errorf("got first bar %+v; want open 100 high 105 low 95 close 95 volume 4", b)
+	}
+	if !bars[1].FirstTime.Equal(start.Add(16*time.Second)) || !bars[2].FirstTime.Truncate(15*time.Second).Equal(start.Add(45*time.Second)) {
+		t.Errorf("got bar starts %v, %v", bars[1].FirstTime, bars[2].FirstTime)
+	}
+}
+
+func TestComputeSmas(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	period := 15 * time.Second
+	var bars []shared.AggregatedTradeInfo
+	for i := 0; i < 6; i++ {
+		var b shared.AggregatedTradeInfo
+		b.SetDefault()
+		b.Update(start.Add(time.Duration(i)*period), float64(100+i), 1)
+		bars = append(bars, b)
+	}
+	params := shared.StrategyParams{SmaShortTerm: 2, SmaLongTerm: 4}
+
+	// the bars before from only fill the buffer
+	smas := computeSmas(bars, start.Add(4*period), params, period)
+	if len(smas) != 2 {
+		t.Fatalf("got %v SMAs; want 2", len(smas))
+	}
+	if s := smas[1]; !s.TimeStamp.Equal(bars[5].LastTime) || s.Sma50 != 104.5 || s.Sma200 != 103.5 {
+		t.Errorf("got %+v; want SMA2 104.5 and SMA4 103.5 at %v", s, bars[5].LastTime)
+	}
+	// not ready before SmaLongTerm bars
+	if smas := computeSmas(bars, start, params, period); len(smas) != 3 {
+		t.Errorf("got %v SMAs; want 3", len(smas))
+	}
+}
+
+func TestBarCompletenessMetrics(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	period := time.Minute // labels of its own, apart from the other tests
+	labels := []string{shared.Symbol, period.String()}
+	trade := func(offset time.Duration) shared.TradeDatePrice {
+		return shared.TradeDatePrice{TradeDate: start.Add(offset).UnixMilli(), Price: "100", Quantity: "1"}
+	}
+
+	in := make(chan shared.TradeDatePrice)
+	out := calculatePriceStats(in, start, period, func() {}, nil)
+	go func() {
+		for _, offset := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 61 * time.Second, 4 * time.Minute} {
+			in <- trade(offset)
+		}
+		in <- trade(30 * time.Second) // late
+		in <- shared.TradeDatePrice{TradeDate: start.Add(5 * time.Minute).UnixMilli(), Price: "x"}
+		close(in)
+	}()
+	var bars []shared.AggregatedTradeInfo
+	for b := range out {
+		bars = append(bars, b)
+	}
+
+	if len(bars) != 2 {
+		t.Fatalf("got %v bars; want 2", len(bars))
+	}
+	if n := testutil.CollectAndCount(shared.BarTrades); n == 0 {
+		t.Error("no trades per bar observed")
+	}
+	if got := testutil.ToFloat64(shared.EmptyBars.WithLabelValues(labels...)); got != 2 {
+		t.Errorf("got %v empty bars; want 2", got)
+	}
+	if got := testutil.ToFloat64(shared.DroppedTrades.WithLabelValues(append([]string{"late"}, labels...)...)); got != 1 {
+		t.Errorf("got %v late trades; want 1", got)
+	}
+	if got := testutil.ToFloat64(shared.DroppedTrades.WithLabelValues(append([]string{"invalid"}, labels...)...)); got != 1 {
+		t.Errorf("got %v invalid trades; want 1", got)
+	}
+}
+
+func TestBarSignals(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	bar := shared.AggregatedTradeInfo{FirstTime: start, LastTime: start.Add(time.Minute), FirstPrice: 100, MaxPrice: 100, MinPrice: 85, LastPrice: 90}
+	for _, c := range []struct {
+		allowShort bool
+		want       []string
+	}{
+		{false, []string{"SELL " + shared.ExitReasonStopLoss}},
+		{true, []string{"SELL " + shared.ExitReasonStopLoss, "SELL " + shared.ExitReasonCrossover}},
+	} {
+		exits := shared.PositionExits{Rules: shared.ExitRules{StopLoss: 0.1}}
+		exits.Open(100, start)
+		// the stop at 90 and a crossover down on the same bar
+		var got []string
+		for _, s := range barSignals(&exits, bar, -1, 1, c.allowShort, false) {
+			got = append(got, s.Signal+" "+s.Reason)
+		}
+		if strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("allow short %v: got %v; want %v", c.allowShort, got, c.want)
+		}
+		if exits.IsOpen != c.allowShort || exits.IsShort != c.allowShort {
+			t.Errorf("allow short %v: got exits %+v; want a short only when allowed", c.allowShort, exits)
+		}
+	}
+}
+
+// the pause drops new entries, the exits of the open position still go out
+func TestBarSignalsPaused(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	flat := shared.AggregatedTradeInfo{FirstTime: start, LastTime: start.Add(time.Minute), FirstPrice: 100, MaxPrice: 100, MinPrice: 100, LastPrice: 100}
+	exits := shared.PositionExits{Rules: shared.ExitRules{StopLoss: 0.1}}
+	if got := barSignals(&exits, flat, 1, -1, false, true); len(got) != 0 || exits.IsOpen {
+		t.Errorf("got %+v, tracking %v; want the BUY entry dropped", got, exits.IsOpen)
+	}
+
+	exits.Open(100, start)
+	if got := barSignals(&exits, flat, -1, 1, false, true); len(got) != 1 || got[0].Signal != "SELL" || !got[0].CloseOnly || exits.IsOpen {
+		t.Errorf("got %+v; want the crossover SELL closing the long", got)
+	}
+	exits.Open(100, start)
+	stop := shared.AggregatedTradeInfo{FirstTime: start, LastTime: start.Add(time.Minute), FirstPrice: 100, MaxPrice: 100, MinPrice: 85, LastPrice: 90}
+	if got := barSignals(&exits, stop, 0, 0, false, true); len(got) != 1 || got[0].Reason != shared.ExitReasonStopLoss {
+		t.Errorf("got %+v; want the stop loss", got)
+	}
+
+	// with short selling, the crossovers close the open position without reversing it
+	exits.Open(100, start)
+	if got := barSignals(&exits, flat, -1, 1, true, true); len(got) != 1 || got[0].Signal != "SELL" || !got[0].CloseOnly || exits.IsOpen {
+		t.Errorf("got %+v, tracking %v; want the crossover SELL closing the long only", got, exits.IsOpen)
+	}
+	if got := barSignals(&exits, flat, -1, 1, true, true); len(got) != 0 || exits.IsOpen {
+		t.Errorf("got %+v, tracking %v; want the short entry dropped", got, exits.IsOpen)
+	}
+	exits.OpenShort(100, start)
+	if got := barSignals(&exits, flat, 1, -1, true, true); len(got) != 1 || got[0].Signal != "BUY" || !got[0].CloseOnly || exits.IsOpen {
+		t.Errorf("got %+v, tracking %v; want the crossover BUY closing the short only", got, exits.IsOpen)
+	}
+}
+
+func TestPauseHandler(t *testing.T) {
+	var paused atomic.Bool
+	var saved []bool
+	var saveErr error
+	handler := pauseHandler(&paused, func(p bool) error {
+		saved = append(saved, p)
+		return saveErr
+	})
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/signals?paused=true", nil))
+	if rec.Code != http.StatusOK || !paused.Load() || len(saved) != 1 || !saved[0] {
+		t.Errorf("got %v, paused %v, saved %v; want paused and saved", rec.Code, paused.Load(), saved)
+	}
+	saveErr = errors.New("mongo down")
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/signals?paused=false", nil))
+	if rec.Code != http.StatusInternalServerError || paused.Load() {
+		t.Errorf("got %v, paused %v; want resumed, and the failed save reported", rec.Code, paused.Load())
+	}
+}
@@ -2,184 +2,524 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/kaanureyen/tradebot/cmd/shared"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-// prometheus metrics
-var aggregateInfoAge = prometheus.NewSummary(
-	prometheus.SummaryOpts{
-		Name:       "aggregate_info_age_milliseconds",
-		Help:       "Difference of local time on aggregate creation and trade time in milliseconds",
-		Objectives: map[float64]float64{0.5: 0.05, 0.95: 0.01, 0.99: 0.001},
-	},
-)
-var aggregatePrice = prometheus.NewGauge(
+// prometheus metrics, by symbol and resolution. the latencies of the stages are in shared.StageLatency
+var aggregatePrice = prometheus.NewGaugeVec(
 	prometheus.GaugeOpts{
 		Name: "aggregate_info_price",
-		Help: "BTC-USDT Price",
+		Help: "Last price of the last bar",
 	},
+	[]string{"symbol", "resolution"},
 )
-var aggregateSma50 = prometheus.NewGauge(
+var aggregateSma50 = prometheus.NewGaugeVec(
 	prometheus.GaugeOpts{
 		Name: "aggregate_info_sma50",
-		Help: "BTC-USDT Price SMA50",
+		Help: "Short term SMA of the last bar",
 	},
+	[]string{"symbol", "resolution"},
 )
-var aggregateSma200 = prometheus.NewGauge(
+var aggregateSma200 = prometheus.NewGaugeVec(
 	prometheus.GaugeOpts{
 		Name: "aggregate_info_sma200",
-		Help: "BTC-USDT Price SMA200",
+		Help: "Long term SMA of the last bar",
 	},
+	[]string{"symbol", "resolution"},
 )
-var aggregateSell = prometheus.NewCounter(
+var aggregateSell = prometheus.NewCounterVec(
 	prometheus.CounterOpts{
 		Name: "aggregate_info_sell_count",
 		Help: "Sell Count",
 	},
+	[]string{"symbol", "resolution"},
 )
-var aggregateBuy = prometheus.NewCounter(
+var aggregateBuy = prometheus.NewCounterVec(
 	prometheus.CounterOpts{
 		Name: "aggregate_info_buy_count",
 		Help: "Buy Count",
 	},
+	[]string{"symbol", "resolution"},
+)
+var signalsPaused = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "aggregator_signals_paused",
+		Help: "1 while signal generation is paused",
+	},
+)
+var signalsPublished = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "signals_published_total",
+		Help: "Trade signals published to Redis",
+	},
+	[]string{"symbol", "resolution"},
 )
 
-type SmaStruct struct {
-	TimeStamp time.Time `bson:"timestamp"`
-	Sma50     float64   `bson:"sma50"`
-	Sma200    float64   `bson:"sma200"`
-}
+// symbol and resolution label values of the metrics, set in main
+var symbol, resolution string
+
+// loggers of the stages, with the symbol and period once the logging is set up
+var (
+	barLog     = slog.Default()
+	signalLog  = slog.Default()
+	storageLog = slog.Default()
+)
 
 func main() {
-	shutdownOrchestrator := shared.InitCommon("aggregator") // set logger name, start http health endpoint, initialize & start shutdownOrchestrator
+	shutdownOrchestrator, admin := shared.InitCommon("aggregator") // set logger name, start admin server, initialize & start shutdownOrchestrator
 	defer func() {
-		<-shutdownOrchestrator.Done // blocks until every shutdownOrchestrator.Get()'s recv is sent an empty struct, after a interrupt/terminate signal.
+		<-shutdownOrchestrator.Done // closed once every phase of the shutdown finished or timed out, after a interrupt/terminate signal.
 		log.Println("[Info] Exiting...")
 	}()
 
+	// price bucketing period
+	period := shared.AggregatePeriod
+	symbol, resolution = shared.Symbol, period.String()
+	barLog = shared.NewLogger("bars", symbol, period)
+	signalLog = shared.NewLogger("signals", symbol, period)
+	storageLog = shared.NewLogger("storage", symbol, period)
+
 	// register the prometheus metrics
-	prometheus.MustRegister(aggregateInfoAge)
 	prometheus.MustRegister(aggregatePrice)
 	prometheus.MustRegister(aggregateSma50)
 	prometheus.MustRegister(aggregateSma200)
 	prometheus.MustRegister(aggregateSell)
 	prometheus.MustRegister(aggregateBuy)
-	// start prometheus metrics
-	go func() {
-		http.Handle("/metrics", promhttp.Handler())
-		log.Fatal("[Fatal][Error] Prometheus metrics endpoint could not be opened. Error: ", http.ListenAndServe(":2113", nil))
-	}()
+	prometheus.MustRegister(signalsPublished)
+	prometheus.MustRegister(signalsPaused)
+	prometheus.MustRegister(shared.WebhookDeliveries)
 
 	// connect to MongoDB
 	client, ctx := shared.MongoConnect()
-	defer client.Disconnect(ctx)
+	shutdownOrchestrator.Register(shared.PhaseCloseConnections, "mongodb", client.Disconnect)
 
 	collAggr := shared.MongoAggregateCollection(client, ctx)
 	collSma := shared.MongoSmaCollection(client, ctx)
 	collTrade := shared.MongoTradeCollection(client, ctx)
 
-	// price bucketing period
-	period := 15 * time.Second
+	// signals are fanned out to Redis and the webhooks
+	rdb := redis.NewClient(&redis.Options{
+		Addr: shared.RedisAddress,
+	})
+	shutdownOrchestrator.Register(shared.PhaseCloseConnections, "redis", func(context.Context) error {
+		return rdb.Close()
+	})
+	// health checks
+	var lastBar shared.Heartbeat
+	shared.Health.AddReadiness("redis", shared.RedisCheck(rdb))
+	shared.Health.AddReadiness("mongodb", shared.MongoCheck(client))
+	shared.Health.AddReadiness("trade_subscription", shared.SubscriptionCheck(shared.RedisChannel))
+	shared.Health.AddReadiness("last_bar", lastBar.Check("bar", shared.ReadyMaxBarAge))
+
+	webhooks := shared.WebhookDispatcherFromEnv(&shared.MongoDeadLetterStore{Collection: shared.MongoDeadLetterCollection(client, ctx)})
+	if webhooks != nil {
+		signalLog.Info("Delivering signals to webhooks", "count", len(webhooks.URLs))
+		admin.SetConfig("webhooks", len(webhooks.URLs)) // the URLs may hold tokens
+		webhooks.Start(100)
+		shutdownOrchestrator.Register(shared.PhaseFlushStorage, "webhooks", shared.StopFunc(webhooks.Close))
+	}
+	// entries are computed but not emitted while paused, the pause outlives restarts
+	var paused atomic.Bool
+	collControl := shared.MongoControlCollection(client, ctx)
+	if p, err := loadPaused(ctx, collControl); err != nil {
+		signalLog.Error("Cannot load the signal pause, running unpaused", "error", err)
+	} else if p {
+		signalLog.Warn("Signal generation is paused since before the restart")
+		paused.Store(true)
+		signalsPaused.Set(1)
+	}
+
+	// strategy parameters
+	params := shared.StrategyParamsFromEnv()
+	signalLog.Info("Using the SMA crossover for trade signals", "sma_short", params.SmaShortTerm, "sma_long", params.SmaLongTerm)
+	admin.SetConfig("symbol", symbol)
+	admin.SetConfig("period", period.String())
+	admin.SetConfig("strategy", params)
+
+	// alerts of the bars and signals, for deployments without Prometheus
+	alerts := shared.NewAlertEvaluator("aggregator")
+	barEmit := shared.StageLatency.WithLabelValues("bar_emit", symbol, resolution).(prometheus.Histogram)
+	strategy := shared.StageLatency.WithLabelValues("strategy", symbol, resolution).(prometheus.Histogram)
+	barsOnTime, bars := &shared.Increase{Window: 5 * time.Minute}, &shared.Increase{Window: 5 * time.Minute}
+	alerts.Add(shared.AlertBarEmissionLag, func(now time.Time) bool {
+		within, total := shared.HistogramCounts(barEmit, shared.SloBarEmitLatency.Seconds())
+		onTime, _ := barsOnTime.Add(now, within)
+		n, ok := bars.Add(now, total)
+		return ok && n > 0 && onTime/n < shared.SloBarEmitRatio
+	})
+	recentBars, evaluations := &shared.Increase{Window: 10 * time.Minute}, &shared.Increase{Window: 10 * time.Minute}
+	alerts.Add(shared.AlertSignalGenerationStopped, func(now time.Time) bool {
+		_, barCount := shared.HistogramCounts(barEmit, 0)
+		_, strategyCount := shared.HistogramCounts(strategy, 0)
+		n, ok := recentBars.Add(now, barCount)
+		m, _ := evaluations.Add(now, strategyCount)
+		return ok && n > 0 && m == 0
+	})
+	mongoErrors := &shared.Increase{Window: 5 * time.Minute}
+	alerts.Add(shared.AlertMongoWriteFailures, func(now time.Time) bool {
+		n, _ := mongoErrors.Add(now, shared.CounterSum(shared.MongoWriteErrors))
+		return n > 0
+	})
+	admin.Handle("GET /alerts", alerts)
+	alerts.Start(shutdownOrchestrator)
+
+	// operator actions
+	admin.HandleFunc("/signals", pauseHandler(&paused, func(p bool) error { return savePaused(context.Background(), collControl, p) }))
+	admin.HandleFunc("/recompute", maintenanceHandler(func(ctx context.Context, from, to time.Time) (int, error) {
+		return Recompute(ctx, collAggr, collSma, params, period, from, to)
+	}))
+	fetchTrades := BinanceTradeFetcher(symbol)
+	admin.HandleFunc("/backfill", maintenanceHandler(func(ctx context.Context, from, to time.Time) (int, error) {
+		n, err := Backfill(ctx, collAggr, fetchTrades, period, from, to)
+		if err != nil || n == 0 {
+			return n, err
+		}
+		// the SMAs of the following bars include the backfilled ones
+		_, err = Recompute(ctx, collAggr, collSma, params, period, from, to.Add(time.Duration(params.SmaLongTerm)*period))
+		return n, err
+	}))
 
 	// initialize sma buffer
-	smaBuffer := SmaBuffer{}
-	smaBuffer.Init(shared.SmaLongTerm)
+	smaBuffer := shared.SmaBuffer{}
+	smaBuffer.Init(params.SmaLongTerm)
 
 	// load into sma buffer from DB
-	log.Println("[Info] Loading the last price data from the DB")
-	LoadLastNIntoSmaBuffer(collAggr, shared.SmaLongTerm, &smaBuffer, period)
+	barLog.Info("Loading the last bars from the DB")
+	LoadLastNIntoSmaBuffer(collAggr, params.SmaLongTerm, &smaBuffer, period)
 
 	// start read from Redis
-	log.Println("[Info] Start reading price data from Redis")
-	aggCh := PeriodicPriceStats(shared.RedisChannel, period, shutdownOrchestrator)
+	barLog.Info("Start reading trades from Redis", "channel", shared.RedisChannel)
+	// the bar in progress is published at most every BarUpdateInterval, without holding up the aggregation
+	barUpdates := make(chan shared.AggregatedTradeInfo, 1)
+	updateLog := shared.RateLimited(barLog, shared.LogRateLimit) // once a second while Redis is down
+	publishBarUpdate := func(v shared.AggregatedTradeInfo) {
+		if err := shared.PublishJSON(ctx, rdb, shared.BarUpdateChannel, shared.NewBarEvent(symbol, v, period, false)); err != nil {
+			updateLog.Warn("Redis bar update publish failed", "error", err)
+		}
+	}
+	stopBarUpdates, barUpdatesStopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(barUpdatesStopped)
+		for {
+			select {
+			case v := <-barUpdates:
+				publishBarUpdate(v)
+			case <-stopBarUpdates:
+				select { // the last one waiting
+				case v := <-barUpdates:
+					publishBarUpdate(v)
+				default:
+				}
+				return
+			}
+		}
+	}()
+	shutdownOrchestrator.Register(shared.PhaseFlushStorage, "bar update publisher", shared.StopFunc(func() {
+		close(stopBarUpdates)
+		<-barUpdatesStopped
+	}))
+	var lastBarUpdate time.Time
+	onUpdate := func(v shared.AggregatedTradeInfo) {
+		if time.Since(lastBarUpdate) < shared.BarUpdateInterval {
+			return
+		}
+		lastBarUpdate = time.Now()
+		select {
+		case barUpdates <- v:
+		default:
+		}
+	}
+	aggCh := PeriodicPriceStats(shared.RedisChannel, period, shutdownOrchestrator, onUpdate)
+	_, pipelineDone := shutdownOrchestrator.Add(shared.PhaseDrainPipeline, "signal pipeline")
+	defer pipelineDone() // the bars read before the shutdown are stored and signaled
 
 	lastDiff := 0.0
+	exits := shared.PositionExits{Rules: params.Exits} // position opened by the last signal, for the protective exits
 	for v := range aggCh {
-		aggregateInfoAge.Observe(float64(time.Since(v.LastTime).Milliseconds()))
-		aggregatePrice.Set(v.LastPrice)
+		lastBar.Beat(time.Now())
+		shared.ObserveStage("bar_emit", symbol, resolution, v.FirstTime.Truncate(period).Add(period))
+		aggregatePrice.WithLabelValues(symbol, resolution).Set(v.LastPrice)
+		// the trace of the trade that closed the bar continues with its stages
+		barCtx, barSpan := shared.StartSpan(shared.TraceContext(v.Trace), "bar",
+			attribute.String("symbol", symbol), attribute.String("resolution", period.String()), attribute.String("bar.start", v.FirstTime.Truncate(period).Format(time.RFC3339)))
 
 		// Store to MongoDB time series
-		_, err := collAggr.InsertOne(ctx, v)
-		if err != nil {
-			log.Printf("[Error] Failed to insert to MongoDB: %v\n", err)
+		start := time.Now()
+		storeCtx, span := shared.StartSpan(barCtx, "store bar")
+		err := insert(storeCtx, collAggr, v)
+		if err := shared.PublishJSON(storeCtx, rdb, shared.BarChannel, shared.NewBarEvent(symbol, v, period, true)); err != nil {
+			barLog.Warn("Redis bar publish failed", "error", err)
 		}
+		shared.EndSpan(span, err)
+		shared.ObserveStage("store", symbol, resolution, start)
 
-		smaBuffer.AddWithLinInterpFill(v.LastPrice, v.LastTime, period)
-
-		if smaBuffer.IsSmaReady(shared.SmaLongTerm) {
-			smaShortTerm, _ := smaBuffer.CalculateSma(shared.SmaShortTerm)
-			smaLongTerm, _ := smaBuffer.CalculateSma(shared.SmaLongTerm)
+		start = time.Now()
+		_, span = shared.StartSpan(barCtx, "indicator")
+		if n := smaBuffer.AddWithLinInterpFill(v.LastPrice, v.LastTime, period); n > 0 {
+			shared.InterpolatedBars.WithLabelValues(symbol, resolution).Add(float64(n))
+		}
+		ready := smaBuffer.IsSmaReady(params.SmaLongTerm)
+		var smaShortTerm, smaLongTerm float64
+		if ready {
+			smaShortTerm, _ = smaBuffer.CalculateSma(params.SmaShortTerm)
+			smaLongTerm, _ = smaBuffer.CalculateSma(params.SmaLongTerm)
+		}
+		span.SetAttributes(attribute.Bool("sma.ready", ready))
+		span.End()
+		shared.ObserveStage("indicator", symbol, resolution, start)
 
-			tradeSignal := shared.TradeSignal{
-				TimeStamp: time.Now(),
-				Signal:    "",
-				Price:     v.LastPrice,
-				Sma50:     smaShortTerm,
-				Sma200:    smaLongTerm,
-			}
+		if ready {
+			start = time.Now()
+			strategyCtx, strategySpan := shared.StartSpan(barCtx, "strategy")
 
 			diff := smaShortTerm - smaLongTerm
-			if diff > 0 && lastDiff <= 0 {
-				tradeSignal.Signal = "BUY"
-				aggregateBuy.Inc()
-			}
-			if diff < 0 && lastDiff >= 0 {
-				tradeSignal.Signal = "SELL"
-				aggregateSell.Inc()
-			}
-			if tradeSignal.Signal != "" {
-				// Store to MongoDB time series
-				_, err := collTrade.InsertOne(ctx, tradeSignal)
-				if err != nil {
-					log.Printf("[Error] Failed to insert to MongoDB: %v\n", err)
+			crossover := ""
+			for _, s := range barSignals(&exits, v, diff, lastDiff, params.Margin.AllowShort, paused.Load()) {
+				s.ID, s.TimeStamp, s.Sma50, s.Sma200 = primitive.NewObjectID(), time.Now(), smaShortTerm, smaLongTerm
+				if s.Signal == "BUY" {
+					aggregateBuy.WithLabelValues(symbol, resolution).Inc()
+				} else {
+					aggregateSell.WithLabelValues(symbol, resolution).Inc()
+				}
+				if s.Reason == shared.ExitReasonCrossover {
+					crossover = s.Signal
+				} else {
+					signalLog.Info("Protective exit", "reason", s.Reason, "price", s.Price)
 				}
+				emitSignal(strategyCtx, s, collTrade, rdb, webhooks)
 			}
+			strategySpan.SetAttributes(attribute.String("signal", crossover))
+			strategySpan.End()
+			shared.ObserveStage("strategy", symbol, resolution, start)
 			lastDiff = diff
-			aggregateSma200.Set(smaLongTerm)
-			aggregateSma50.Set(smaShortTerm)
+			aggregateSma200.WithLabelValues(symbol, resolution).Set(smaLongTerm)
+			aggregateSma50.WithLabelValues(symbol, resolution).Set(smaShortTerm)
 
 			// Store to MongoDB time series
-			_, err := collSma.InsertOne(ctx, SmaStruct{
+			sma := shared.SmaStruct{
 				TimeStamp: v.LastTime,
 				Sma50:     smaShortTerm,
 				Sma200:    smaLongTerm,
-			})
+			}
+			start = time.Now()
+			storeCtx, span := shared.StartSpan(barCtx, "store indicator")
+			err := insert(storeCtx, collSma, sma)
+			if err := shared.PublishJSON(storeCtx, rdb, shared.IndicatorChannel, sma); err != nil {
+				barLog.Warn("Redis indicator publish failed", "error", err)
+			}
+			shared.EndSpan(span, err)
+			shared.ObserveStage("store", symbol, resolution, start)
+		}
+		barSpan.End()
+	}
+}
+
+// signals of a bar: the protective exit of the position opened by the last signal, then the crossover.
+// without short selling, a crossover SELL after the protective exit has nothing left to close and is dropped.
+// while paused, a crossover only closes the open position and is marked close-only, without one to close it is dropped
+func barSignals(exits *shared.PositionExits, v shared.AggregatedTradeInfo, diff, lastDiff float64, allowShort, paused bool) []shared.TradeSignal {
+	var signals []shared.TradeSignal
+	if price, reason := exits.Check(v.FirstPrice, v.MaxPrice, v.MinPrice, v.LastPrice, v.LastTime); reason != "" {
+		signal := "SELL"
+		if exits.IsShort {
+			signal = "BUY"
+		}
+		exits.Close()
+		signals = append(signals, shared.TradeSignal{Signal: signal, Price: price, Reason: reason})
+	}
+
+	signal := shared.CrossoverSignal(diff, lastDiff)
+	if signal != "" && paused {
+		closes := exits.IsOpen && (signal == "BUY") == exits.IsShort
+		if !closes {
+			signalLog.Info("Signal generation is paused, dropping the entry", "signal", signal, "price", v.LastPrice)
+			return signals
+		}
+		exits.Close()
+		return append(signals, shared.TradeSignal{Signal: signal, Price: v.LastPrice, Reason: shared.ExitReasonCrossover, CloseOnly: true})
+	}
+	switch signal {
+	case "BUY":
+		exits.Open(v.LastPrice, v.LastTime)
+		signals = append(signals, shared.TradeSignal{Signal: signal, Price: v.LastPrice, Reason: shared.ExitReasonCrossover})
+	case "SELL":
+		if len(signals) > 0 && signals[0].Signal == "SELL" && !allowShort {
+			break
+		}
+		exits.Close()
+		if allowShort {
+			exits.OpenShort(v.LastPrice, v.LastTime)
+		}
+		signals = append(signals, shared.TradeSignal{Signal: signal, Price: v.LastPrice, Reason: shared.ExitReasonCrossover})
+	}
+	return signals
+}
+
+// stores the signal, then publishes it to Redis and queues it for the webhooks
+func emitSignal(ctx context.Context, s shared.TradeSignal, collTrade *mongo.Collection, rdb *redis.Client, webhooks *shared.WebhookDispatcher) {
+	// Store to MongoDB time series
+	start := time.Now()
+	storeCtx, span := shared.StartSpan(ctx, "store signal", attribute.String("signal", s.Signal), attribute.String("reason", s.Reason))
+	err := insert(storeCtx, collTrade, s)
+	shared.EndSpan(span, err)
+	shared.ObserveStage("store", symbol, resolution, start)
+
+	publishCtx, span := shared.StartSpan(ctx, "publish signal")
+	err = shared.PublishSignal(publishCtx, rdb, s)
+	shared.EndSpan(span, err)
+	if err != nil {
+		signalLog.Warn("Redis signal publish failed", "error", err)
+	} else {
+		signalsPublished.WithLabelValues(symbol, resolution).Inc()
+	}
+
+	if webhooks != nil {
+		data, err := json.Marshal(s)
+		if err != nil {
+			signalLog.Warn("Failed marshaling the signal", "error", err)
+			return
+		}
+		webhooks.Dispatch(data)
+	}
+}
+
+// inserts doc into the collection, logging and counting the failures
+func insert(ctx context.Context, collection *mongo.Collection, doc any) error {
+	_, err := collection.InsertOne(ctx, doc)
+	if err != nil {
+		shared.MongoWriteErrors.WithLabelValues(collection.Name(), symbol, resolution).Inc()
+		storageLog.Error("MongoDB insert failed", "collection", collection.Name(), "error", err)
+	}
+	return err
+}
+
+// GET reports whether signal generation is paused, POST ?paused=true|false changes it and saves it
+func pauseHandler(paused *atomic.Bool, save func(bool) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			p, err := strconv.ParseBool(r.URL.Query().Get("paused"))
 			if err != nil {
-				log.Printf("[Error] Failed to insert to MongoDB: %v\n", err)
+				http.Error(w, "paused must be true or false", http.StatusBadRequest)
+				return
+			}
+			if paused.Swap(p) != p {
+				signalLog.Warn("Signal generation pause changed", "paused", p)
+			}
+			signalsPaused.Set(boolToFloat(p))
+			if err := save(p); err != nil {
+				signalLog.Error("Cannot save the signal pause", "error", err)
+				http.Error(w, "changed, but not saved, lost on restart: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		} else if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"paused": paused.Load()})
+	}
+}
+
+const controlID = "aggregator" // of the document in the control collection
+
+// whether signal generation was paused, false without a saved state
+func loadPaused(ctx context.Context, collection *mongo.Collection) (bool, error) {
+	var control struct {
+		SignalsPaused bool `bson:"signals_paused"`
+	}
+	err := collection.FindOne(ctx, bson.D{{Key: "_id", Value: controlID}}).Decode(&control)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	return control.SignalsPaused, err
+}
+
+func savePaused(ctx context.Context, collection *mongo.Collection, paused bool) error {
+	_, err := collection.UpdateOne(ctx, bson.D{{Key: "_id", Value: controlID}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "signals_paused", Value: paused}, {Key: "updated_at", Value: time.Now()}}}},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+// POST ?from=&to= (RFC 3339 or unix ms, to defaults to now) runs action on the range and replies its count
+func maintenanceHandler(action func(ctx context.Context, from, to time.Time) (int, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		from, err := shared.ParseTime(r.URL.Query().Get("from"))
+		if err != nil {
+			http.Error(w, "from must be RFC 3339 or unix milliseconds", http.StatusBadRequest)
+			return
+		}
+		to := time.Now()
+		if s := r.URL.Query().Get("to"); s != "" {
+			if to, err = shared.ParseTime(s); err != nil {
+				http.Error(w, "to must be RFC 3339 or unix milliseconds", http.StatusBadRequest)
+				return
 			}
 		}
+		if !from.Before(to) {
+			http.Error(w, "from must be before to", http.StatusBadRequest)
+			return
+		}
+		n, err := action(r.Context(), from, to)
+		if err != nil {
+			log.Printf("[Error] %v of [%v, %v) failed: %v\n", r.URL.Path, from, to, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"count": n})
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
 	}
+	return 0
 }
 
 // Example function to get last N items
-func LoadLastNIntoSmaBuffer(collection *mongo.Collection, n int, smaBuffer *SmaBuffer, period time.Duration) {
+func LoadLastNIntoSmaBuffer(collection *mongo.Collection, n int, smaBuffer *shared.SmaBuffer, period time.Duration) {
 	ctx := context.Background()
 	opts := options.Find().SetSort(bson.D{{Key: "lasttimestamp", Value: -1}}).SetLimit(int64(n))
 	cursor, err := collection.Find(ctx, bson.D{}, opts)
 	if err != nil {
-		log.Printf("[Error] Cannot find from MongoDB and will continue without loading from DB: %v\n", err)
+		storageLog.Error("Cannot find the last bars, continuing without them", "error", err)
 		return
 	}
 	defer cursor.Close(ctx)
 
-	var results []AggregatedTradeInfo
+	var results []shared.AggregatedTradeInfo
 	if err := cursor.All(ctx, &results); err != nil {
-		log.Printf("[Error] Cannot load from cursor and will continue without loading from DB: %v\n", err)
+		storageLog.Error("Cannot load the last bars, continuing without them", "error", err)
 		return
 	}
 
+	loadLog := shared.RateLimited(barLog, shared.LogRateLimit) // one line per bar otherwise
 	for i := len(results) - 1; i >= 0; i-- {
 		v := results[i]
 		smaBuffer.AddWithLinInterpFill(v.LastPrice, v.LastTime, period)
-		log.Printf("[Debug] Loaded from DB: Price %v Time %v\n", v.LastPrice, v.LastTime)
+		loadLog.Debug("Loaded from DB", "price", v.LastPrice, "time", v.LastTime)
 	}
+	barLog.Info("Loaded the last bars from the DB", "count", len(results))
 }
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	binance_connector "github.com/binance/binance-connector-go"
+	"github.com/kaanureyen/tradebot/cmd/shared"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// longest range a backfill fetches from the exchange
+const MaxBackfillRange = 24 * time.Hour
+
+// trade of the exchange history
+type histTrade struct {
+	Time     time.Time
+	Price    float64
+	Quantity float64
+}
+
+// fetches the trades in [from, to) in chronological order
+type TradeFetcher func(ctx context.Context, from, to time.Time) ([]histTrade, error)
+
+// TradeFetcher of the Binance aggregated trades of symbol
+func BinanceTradeFetcher(symbol string) TradeFetcher {
+	client := binance_connector.NewClient("", "")
+	return func(ctx context.Context, from, to time.Time) ([]histTrade, error) {
+		var trades []histTrade
+		// the endpoint takes at most an hour by time, the pages of a busy hour follow by ID
+		for ; from.Before(to); from = from.Add(time.Hour) {
+			end := from.Add(time.Hour)
+			if end.After(to) {
+				end = to
+			}
+			page, err := client.NewAggTradesListService().Symbol(symbol).
+				StartTime(uint64(from.UnixMilli())).EndTime(uint64(end.UnixMilli()) - 1).Limit(1000).Do(ctx)
+			for err == nil && len(page) > 0 {
+				for _, v := range page {
+					t := time.UnixMilli(int64(v.Time))
+					if !t.Before(end) {
+						break
+					}
+					p, err := strconv.ParseFloat(v.Price, 64)
+					if err != nil {
+						return nil, fmt.Errorf("price of trade %v: %w", v.AggTradeId, err)
+					}
+					q, err := strconv.ParseFloat(v.Qty, 64)
+					if err != nil {
+						return nil, fmt.Errorf("quantity of trade %v: %w", v.AggTradeId, err)
+					}
+					trades = append(trades, histTrade{Time: t, Price: p, Quantity: q})
+				}
+				last := page[len(page)-1]
+				if len(page) < 1000 || !time.UnixMilli(int64(last.Time)).Before(end) {
+					break
+				}
+				page, err = client.NewAggTradesListService().Symbol(symbol).FromId(int(last.AggTradeId + 1)).Limit(1000).Do(ctx)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return trades, nil
+	}
+}
+
+// bars of period from chronological trades
+func barsFromTrades(trades []histTrade, period time.Duration) []shared.AggregatedTradeInfo {
+	var bars []shared.AggregatedTradeInfo
+	for _, t := range trades {
+		n := len(bars)
+		if n == 0 || !bars[n-1].FirstTime.Truncate(period).Equal(t.Time.Truncate(period)) {
+			var bar shared.AggregatedTradeInfo
+			bar.SetDefault()
+			bars = append(bars, bar)
+			n++
+		}
+		bars[n-1].Update(t.Time, t.Price, t.Quantity)
+	}
+	return bars
+}
+
+// SMAs of the bars starting at from, the earlier bars only fill the buffer
+func computeSmas(bars []shared.AggregatedTradeInfo, from time.Time, params shared.StrategyParams, period time.Duration) []shared.SmaStruct {
+	smaBuffer := shared.SmaBuffer{}
+	smaBuffer.Init(params.SmaLongTerm)
+	var smas []shared.SmaStruct
+	for _, v := range bars {
+		smaBuffer.AddWithLinInterpFill(v.LastPrice, v.LastTime, period)
+		if v.LastTime.Before(from) || !smaBuffer.IsSmaReady(params.SmaLongTerm) {
+			continue
+		}
+		smaShortTerm, _ := smaBuffer.CalculateSma(params.SmaShortTerm)
+		smaLongTerm, _ := smaBuffer.CalculateSma(params.SmaLongTerm)
+		smas = append(smas, shared.SmaStruct{TimeStamp: v.LastTime, Sma50: smaShortTerm, Sma200: smaLongTerm})
+	}
+	return smas
+}
+
+// stored bars with the last trade in [from, to) in chronological order
+func loadBars(ctx context.Context, collAggr *mongo.Collection, from, to time.Time) ([]shared.AggregatedTradeInfo, error) {
+	filter := bson.D{{Key: "lasttimestamp", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}}}
+	cursor, err := collAggr.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "lasttimestamp", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var bars []shared.AggregatedTradeInfo
+	err = cursor.All(ctx, &bars)
+	return bars, err
+}
+
+// replaces the stored SMAs of the bars in [from, to) with ones computed from the stored bars. returns their number
+func Recompute(ctx context.Context, collAggr, collSma *mongo.Collection, params shared.StrategyParams, period time.Duration, from, to time.Time) (int, error) {
+	// bars before from fill the SMA buffer
+	bars, err := loadBars(ctx, collAggr, from.Add(-time.Duration(params.SmaLongTerm)*period), to)
+	if err != nil {
+		return 0, err
+	}
+	smas := computeSmas(bars, from, params, period)
+
+	filter := bson.D{{Key: "timestamp", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}}}
+	if _, err := collSma.DeleteMany(ctx, filter); err != nil {
+		return 0, err
+	}
+	if len(smas) == 0 {
+		return 0, nil
+	}
+	docs := make([]any, len(smas))
+	for i, s := range smas {
+		docs[i] = s
+	}
+	if _, err := collSma.InsertMany(ctx, docs); err != nil {
+		return 0, err
+	}
+	log.Printf("[Info] Recomputed %v SMAs in [%v, %v)\n", len(smas), from, to)
+	return len(smas), nil
+}
+
+// stores the bars in [from, to) missing from the DB, built from the trades of fetch. returns their number
+func Backfill(ctx context.Context, collAggr *mongo.Collection, fetch TradeFetcher, period time.Duration, from, to time.Time) (int, error) {
+	if to.Sub(from) > MaxBackfillRange {
+		return 0, fmt.Errorf("range is longer than %v", MaxBackfillRange)
+	}
+	stored, err := loadBars(ctx, collAggr, from, to)
+	if err != nil {
+		return 0, err
+	}
+	have := make(map[int64]bool) // bar starts in unix ms
+	for _, b := range stored {
+		have[b.FirstTime.Truncate(period).UnixMilli()] = true
+	}
+	trades, err := fetch(ctx, from, to)
+	if err != nil {
+		return 0, err
+	}
+	var docs []any
+	for _, b := range barsFromTrades(trades, period) {
+		if !have[b.FirstTime.Truncate(period).UnixMilli()] {
+			docs = append(docs, b)
+		}
+	}
+	if len(docs) == 0 {
+		return 0, nil
+	}
+	if _, err := collAggr.InsertMany(ctx, docs); err != nil {
+		return 0, err
+	}
+	log.Printf("[Info] Backfilled %v bars in [%v, %v) from %v trades\n", len(docs), from, to, len(trades))
+	return len(docs), nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kaanureyen/tradebot/cmd/shared"
+)
+
+type memoryStore struct {
+	bars    []shared.AggregatedTradeInfo
+	smas    []shared.SmaStruct
+	signals []shared.TradeSignal
+}
+
+func inRange[T any](items []T, at func(T) time.Time, from, to time.Time, limit int64) []T {
+	var out []T
+	for _, item := range items {
+		if t := at(item); !t.Before(from) && t.Before(to) && int64(len(out)) < limit {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func (s *memoryStore) Bars(ctx context.Context, from, to time.Time, limit int64) ([]shared.AggregatedTradeInfo, error) {
+	return inRange(s.bars, func(b shared.AggregatedTradeInfo) time.Time { return b.LastTime }, from, to, limit), nil
+}
+
+func (s *memoryStore) Smas(ctx context.Context, from, to time.Time, limit int64) ([]shared.SmaStruct, error) {
+	return inRange(s.smas, func(p shared.SmaStruct) time.Time { return p.TimeStamp }, from, to, limit), nil
+}
+
+func (s *memoryStore) Signals(ctx context.Context, from, to time.Time, limit int64) ([]shared.TradeSignal, error) {
+	return inRange(s.signals, func(p shared.TradeSignal) time.Time { return p.TimeStamp }, from, to, limit), nil
+}
+
+// a bar every AggregatePeriod for an hour, closing at 100+i
+func testStore(start time.Time) *memoryStore {
+	s := &memoryStore{}
+	for i := 0; i < 240; i++ {
+		first := start.Add(time.Duration(i) * shared.AggregatePeriod)
+		last := first.Add(shared.AggregatePeriod - time.Second)
+		price := 100 + float64(i)
+		s.bars = append(s.bars, shared.AggregatedTradeInfo{FirstTime: first, LastTime: last, MinPrice: price - 1, MaxPrice: price + 1, FirstPrice: price - 0.5, LastPrice: price, Volume: 1})
+		s.smas = append(s.smas, shared.SmaStruct{TimeStamp: last, Sma50: price, Sma200: price / 2})
+	}
+	s.signals = []shared.TradeSignal{
+		{TimeStamp: start.Add(10 * time.Minute), Signal: "BUY", Price: 140, Reason: "crossover"},
+		{TimeStamp: start.Add(20 * time.Minute), Signal: "SELL", Price: 180, Reason: "stop_loss"},
+		{TimeStamp: start.Add(30 * time.Minute), Signal: "BUY", Price: 220, Reason: "crossover"},
+	}
+	return s
+}
+
+func get(t *testing.T, server *httptest.Server, path string, params url.Values) *http.Response {
+	t.Helper()
+	res, err := http.Get(server.URL + path + "?" + params.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestCandlesPaging(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	server := httptest.NewServer((&API{Store: testStore(start)}).Handler())
+	defer server.Close()
+
+	params := url.Values{"resolution": {"5m"}, "from": {start.Add(time.Minute).Format(time.RFC3339)}, "to": {start.Add(time.Hour).Format(time.RFC3339)}, "limit": {"5"}}
+	var candles []Candle
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("paging does not end")
+		}
+		res := get(t, server, "/v1/candles", params)
+		var page response[Candle]
+		if err := json.NewDecoder(res.Body).Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		candles = append(candles, page.Data...)
+		if page.Next == "" {
+			break
+		}
+		params.Set("cursor", page.Next)
+	}
+
+	// from is rounded down to the candle, 20 bars in each
+	if len(candles) != 12 {
+		t.Fatalf("got %v candles, want 12", len(candles))
+	}
+	for i, c := range candles {
+		want := Candle{Time: start.Add(time.Duration(i) * 5 * time.Minute), Open: 99.5 + float64(20*i), High: 120 + float64(20*i), Low: 99 + float64(20*i), Close: 119 + float64(20*i), Volume: 20}
+		if !c.Time.Equal(want.Time) || c.Open != want.Open || c.High != want.High || c.Low != want.Low || c.Close != want.Close || c.Volume != want.Volume {
+			t.Errorf("candle %v = %+v, want %+v", i, c, want)
+		}
+	}
+}
+
+func TestIndicatorsCSV(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	server := httptest.NewServer((&API{Store: testStore(start)}).Handler())
+	defer server.Close()
+
+	params := url.Values{"resolution": {"30m"}, "from": {start.Format(time.RFC3339)}, "to": {start.Add(time.Hour).Format(time.RFC3339)}, "format": {"csv"}}
+	res := get(t, server, "/v1/indicators", params)
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/csv" {
+		t.Fatalf("content type %q", ct)
+	}
+	rows, err := csv.NewReader(res.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"time", "sma_short", "sma_long"},
+		{"2025-01-01T00:00:00Z", "219", "109.5"},
+		{"2025-01-01T00:30:00Z", "339", "169.5"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %v", rows)
+	}
+	for i := range want {
+		if strings.Join(rows[i], ",") != strings.Join(want[i], ",") {
+			t.Errorf("row %v = %v, want %v", i, rows[i], want[i])
+		}
+	}
+}
+
+func TestSignals(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	server := httptest.NewServer((&API{Store: testStore(start)}).Handler())
+	defer server.Close()
+
+	params := url.Values{"symbol": {"btcusdt"}, "from": {"1735689600000"}, "to": {start.Add(time.Hour).Format(time.RFC3339)}, "limit": {"2"}}
+	res := get(t, server, "/v1/signals", params)
+	var page response[shared.TradeSignal]
+	if err := json.NewDecoder(res.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if len(page.Data) != 2 || page.Data[1].Reason != "stop_loss" || page.Next != "2025-01-01T00:30:00Z" {
+		t.Fatalf("got %+v", page)
+	}
+	if got := res.Header.Get("X-Next-Cursor"); got != page.Next {
+		t.Errorf("X-Next-Cursor %q, want %q", got, page.Next)
+	}
+}
+
+func TestInvalidQuery(t *testing.T) {
+	server := httptest.NewServer((&API{Store: &memoryStore{}}).Handler())
+	defer server.Close()
+
+	for _, params := range []url.Values{
+		{"symbol": {"ETHUSDT"}},
+		{"resolution": {"10s"}},
+		{"resolution": {"48h"}},
+		{"from": {"yesterday"}},
+		{"limit": {"0"}},
+		{"format": {"xml"}},
+	} {
+		res := get(t, server, "/v1/candles", params)
+		res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("%v: status %v, want 400", params, res.StatusCode)
+		}
+	}
+
+	res := get(t, server, "/openapi.json", nil)
+	defer res.Body.Close()
+	var spec map[string]any
+	if err := json.NewDecoder(res.Body).Decode(&spec); err != nil || spec["openapi"] == nil {
+		t.Errorf("openapi.json: %v", err)
+	}
+}
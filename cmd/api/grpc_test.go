@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kaanureyen/tradebot/cmd/shared"
+	tradebotv1 "github.com/kaanureyen/tradebot/proto/tradebot/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func grpcClient(t *testing.T, api *API) tradebotv1.MarketDataClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	tradebotv1.RegisterMarketDataServer(server, &GrpcServer{API: api, QueueSize: 16})
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return tradebotv1.NewMarketDataClient(conn)
+}
+
+func TestGrpcHistory(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	client := grpcClient(t, &API{Store: testStore(start)})
+	ctx := context.Background()
+
+	req := &tradebotv1.HistoryRequest{Resolution: durationpb.New(30 * time.Minute), From: timestamppb.New(start), To: timestamppb.New(start.Add(time.Hour)), Limit: 1}
+	var bars []*tradebotv1.Bar
+	for {
+		res, err := client.GetBars(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bars = append(bars, res.Bars...)
+		if res.NextPageToken == "" {
+			break
+		}
+		req.PageToken = res.NextPageToken
+	}
+	if len(bars) != 2 || !bars[1].Start.AsTime().Equal(start.Add(30*time.Minute)) || bars[1].Close != 339 || bars[1].Volume != 120 || !bars[1].Closed {
+		t.Fatalf("bars %v", bars)
+	}
+
+	signals, err := client.GetSignals(ctx, &tradebotv1.HistoryRequest{From: timestamppb.New(start), To: timestamppb.New(start.Add(time.Hour))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signals.Signals) != 3 || signals.Signals[1].Signal != tradebotv1.Signal_SIGNAL_SELL || signals.Signals[1].Reason != "stop_loss" {
+		t.Fatalf("signals %v", signals)
+	}
+
+	_, err = client.GetIndicators(ctx, &tradebotv1.HistoryRequest{Resolution: durationpb.New(time.Second)})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("invalid resolution: %v", err)
+	}
+}
+
+func TestGrpcSubscribe(t *testing.T) {
+	hub := NewHub(nil)
+	client := grpcClient(t, &API{Store: &memoryStore{}, Hub: hub})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bars, err := client.SubscribeBars(ctx, &tradebotv1.SubscribeBarsRequest{Resolution: durationpb.New(time.Minute), IncludeUpdates: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signals, err := client.SubscribeSignals(ctx, &tradebotv1.SubscribeRequest{Symbol: "BTCUSDT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the subscriptions are registered when the streams are served
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		hub.mu.Lock()
+		n := len(hub.listeners)
+		hub.mu.Unlock()
+		if n == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%v listeners", n)
+		}
+	}
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	hub.OnBarUpdate(testBar(start, 0))
+	for i := 0; i < 4; i++ {
+		hub.OnBar(testBar(start, i))
+	}
+	update, err := bars.Recv()
+	if err != nil || update.Closed || update.Close != 100 {
+		t.Fatalf("update %v, %v", update, err)
+	}
+	bar, err := bars.Recv()
+	if err != nil || !bar.Closed || !bar.Start.AsTime().Equal(start) || bar.Volume != 4 || bar.Resolution.AsDuration() != time.Minute {
+		t.Fatalf("bar %v, %v", bar, err)
+	}
+
+	hub.OnSignal(shared.TradeSignal{TimeStamp: start, Signal: "BUY", Price: 103, Reason: "crossover"})
+	signal, err := signals.Recv()
+	if err != nil || signal.Signal != tradebotv1.Signal_SIGNAL_BUY || signal.Price != 103 {
+		t.Fatalf("signal %v, %v", signal, err)
+	}
+
+	hub.Close()
+	if _, err := signals.Recv(); status.Code(err) != codes.Unavailable {
+		t.Errorf("after shutdown: %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/kaanureyen/tradebot/cmd/shared"
+)
+
+func testBar(start time.Time, i int) shared.BarEvent {
+	price := 100 + float64(i)
+	return shared.BarEvent{
+		Symbol: shared.Symbol,
+		Start:  start.Add(time.Duration(i) * shared.AggregatePeriod),
+		Open:   price - 0.5, High: price + 1, Low: price - 1, Close: price, Volume: 1, Closed: true,
+	}
+}
+
+func TestCandleBuilder(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := &candleBuilder{resolution: time.Minute}
+
+	for i := 0; i < 3; i++ {
+		if closed := b.add(testBar(start, i)); len(closed) != 0 {
+			t.Fatalf("bar %v closed %+v", i, closed)
+		}
+	}
+	if closed := b.add(testBar(start, 2)); len(closed) != 0 {
+		t.Fatalf("repeated bar closed %+v", closed)
+	}
+	partial := b.partial(testBar(start, 3))
+	if partial.Open != 99.5 || partial.Close != 103 || partial.Volume != 4 {
+		t.Errorf("partial %+v", partial)
+	}
+	closed := b.add(testBar(start, 3))
+	if len(closed) != 1 || !closed[0].Time.Equal(start) || closed[0].High != 104 || closed[0].Low != 99 || closed[0].Volume != 4 {
+		t.Fatalf("closed %+v", closed)
+	}
+
+	// no trades in the last bar of the second minute, the third minute completes it
+	b.add(testBar(start, 4))
+	closed = b.add(testBar(start, 8))
+	if len(closed) != 1 || !closed[0].Time.Equal(start.Add(time.Minute)) || closed[0].Volume != 1 {
+		t.Fatalf("closed %+v", closed)
+	}
+}
+
+func dialHub(t *testing.T, server *httptest.Server) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/v1/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn, wantType string) map[string]any {
+	t.Helper()
+	var msg map[string]any
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg["type"] != wantType {
+		t.Fatalf("got %v, want a %v message", msg, wantType)
+	}
+	return msg
+}
+
+func TestHubStreams(t *testing.T) {
+	hub := NewHub(nil)
+	server := httptest.NewServer((&API{Store: &memoryStore{}, Hub: hub}).Handler())
+	defer server.Close()
+	defer hub.Close()
+
+	conn := dialHub(t, server)
+	defer conn.Close()
+	for _, req := range []wsRequest{
+		{Action: "subscribe", Stream: streamBars, Symbol: "BTCUSDT", Resolution: "1m"},
+		{Action: "subscribe", Stream: streamBarUpdates, Resolution: "1m"},
+		{Action: "subscribe", Stream: streamSignals},
+	} {
+		conn.WriteJSON(req)
+		readMessage(t, conn, "subscribed")
+	}
+	conn.WriteJSON(wsRequest{Action: "subscribe", Stream: streamBars, Resolution: "7s"})
+	readMessage(t, conn, "error")
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	hub.OnBar(testBar(start, 0))
+	update := testBar(start, 1)
+	update.Closed = false
+	hub.OnBarUpdate(update)
+	msg := readMessage(t, conn, "bar_update")
+	if data := msg["data"].(map[string]any); msg["resolution"] != "1m0s" || data["volume"] != 2.0 || data["close"] != 101.0 {
+		t.Errorf("bar update %v", msg)
+	}
+
+	for i := 1; i < 4; i++ {
+		hub.OnBar(testBar(start, i))
+	}
+	msg = readMessage(t, conn, "bar")
+	if data := msg["data"].(map[string]any); data["time"] != "2025-01-01T00:00:00Z" || data["volume"] != 4.0 {
+		t.Errorf("bar %v", msg)
+	}
+
+	hub.OnSignal(shared.TradeSignal{TimeStamp: start, Signal: "BUY", Price: 103})
+	msg = readMessage(t, conn, "signal")
+	if data := msg["data"].(map[string]any); data["signal"] != "BUY" {
+		t.Errorf("signal %v", msg)
+	}
+}
+
+func TestHubSlowConsumer(t *testing.T) {
+	hub := NewHub(nil)
+	hub.QueueSize = 1
+	registered := make(chan *wsClient, 1)
+	// clients whose queue is never written to the connection
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := hub.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		c := hub.register(conn)
+		c.subs[subscription{stream: streamSignals}] = true
+		c.subs[subscription{streamBarUpdates, shared.AggregatePeriod}] = true
+		registered <- c
+	}))
+	defer server.Close()
+	hub.builders[shared.AggregatePeriod] = &candleBuilder{resolution: shared.AggregatePeriod}
+
+	conn := dialHub(t, server)
+	defer conn.Close()
+	c := <-registered
+
+	// bar updates are dropped when the queue is full
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	hub.OnBarUpdate(testBar(start, 0))
+	hub.OnBarUpdate(testBar(start, 1))
+	select {
+	case <-c.done:
+		t.Fatal("disconnected on a dropped bar update")
+	default:
+	}
+
+	// signals are not, the client is disconnected instead
+	hub.OnSignal(shared.TradeSignal{TimeStamp: start, Signal: "BUY"})
+	select {
+	case <-c.done:
+	default:
+		t.Fatal("slow consumer not disconnected")
+	}
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Error("connection of the slow consumer is open")
+	}
+}
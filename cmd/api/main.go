@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kaanureyen/tradebot/cmd/shared"
+	tradebotv1 "github.com/kaanureyen/tradebot/proto/tradebot/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+)
+
+// prometheus metrics
+var apiRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "api_requests_total",
+		Help: "REST API requests by route and status code",
+	},
+	[]string{"route", "code"},
+)
+var wsClients = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "api_ws_clients",
+		Help: "Connected websocket clients",
+	},
+)
+var pushDroppedUpdates = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "api_push_dropped_updates_total",
+		Help: "Bar updates dropped because the queue of the websocket client or gRPC subscription was full",
+	},
+)
+var pushDisconnects = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "api_push_disconnects_total",
+		Help: "Websocket clients and gRPC subscriptions ended, by reason",
+	},
+	[]string{"reason"},
+)
+
+// records the status code written by the handler
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func main() {
+	shutdownOrchestrator, admin := shared.InitCommon("api") // set logger name, start admin server, initialize & start shutdownOrchestrator
+	defer func() {
+		<-shutdownOrchestrator.Done // closed once every phase of the shutdown finished or timed out, after a interrupt/terminate signal.
+		log.Println("[Info] Exiting...")
+	}()
+
+	// register the prometheus metrics
+	prometheus.MustRegister(apiRequests)
+	prometheus.MustRegister(wsClients)
+	prometheus.MustRegister(pushDroppedUpdates)
+	prometheus.MustRegister(pushDisconnects)
+
+	// connect to MongoDB
+	client, ctx := shared.MongoConnect()
+	shutdownOrchestrator.Register(shared.PhaseCloseConnections, "mongodb", client.Disconnect)
+	shared.Health.AddReadiness("mongodb", shared.MongoCheck(client))
+
+	store := &MongoStore{
+		Aggr:   shared.MongoAggregateCollection(client, ctx),
+		Sma:    shared.MongoSmaCollection(client, ctx),
+		Signal: shared.MongoTradeCollection(client, ctx),
+	}
+	hub := NewHub(store)
+	api := &API{Store: store, Hub: hub}
+	handler := api.Handler()
+
+	// the websocket clients and gRPC subscriptions are fed from the fetcher and aggregator output on Redis
+	log.Println("[Info] Start reading trades, bars, indicators and signals from Redis")
+	feed := func(channel string, handle func(msg string) error) {
+		msgs := shared.SubscribeRedis(shutdownOrchestrator.Context(shared.PhaseStopIngest, "subscription "+channel), channel)
+		_, finished := shutdownOrchestrator.Add(shared.PhaseDrainPipeline, "feed "+channel)
+		shared.Health.AddReadiness("subscription "+channel, shared.SubscriptionCheck(channel))
+		go func() {
+			defer finished()
+			for msg := range msgs {
+				if err := handle(msg); err != nil {
+					log.Printf("[Warning] Failed to unmarshal the message of %v. Skipping the data. Error:: %v\n", channel, err)
+				}
+			}
+		}()
+	}
+	feed(shared.RedisChannel, func(msg string) error {
+		var v shared.TradeDatePrice
+		if err := json.Unmarshal([]byte(msg), &v); err != nil {
+			return err
+		}
+		t := Trade{Time: time.UnixMilli(v.TradeDate)}
+		var err error
+		if t.Price, err = strconv.ParseFloat(v.Price, 64); err != nil {
+			return err
+		}
+		t.Quantity, _ = strconv.ParseFloat(v.Quantity, 64) // optional, older fetchers did not publish it
+		hub.OnTrade(t)
+		return nil
+	})
+	feed(shared.BarChannel, func(msg string) error {
+		var bar shared.BarEvent
+		err := json.Unmarshal([]byte(msg), &bar)
+		if err == nil {
+			hub.OnBar(bar)
+		}
+		return err
+	})
+	feed(shared.BarUpdateChannel, func(msg string) error {
+		var bar shared.BarEvent
+		err := json.Unmarshal([]byte(msg), &bar)
+		if err == nil {
+			hub.OnBarUpdate(bar)
+		}
+		return err
+	})
+	feed(shared.IndicatorChannel, func(msg string) error {
+		var sma shared.SmaStruct
+		err := json.Unmarshal([]byte(msg), &sma)
+		if err == nil {
+			hub.OnIndicator(IndicatorPoint{Time: sma.TimeStamp.Truncate(shared.AggregatePeriod), SmaShort: sma.Sma50, SmaLong: sma.Sma200})
+		}
+		return err
+	})
+	feed(shared.SignalChannel, func(msg string) error {
+		var s shared.TradeSignal
+		err := json.Unmarshal([]byte(msg), &s)
+		if err == nil {
+			hub.OnSignal(s)
+		}
+		return err
+	})
+
+	addr := os.Getenv("API_ADDR")
+	if addr == "" {
+		addr = ":8000"
+	}
+	admin.SetConfig("api_addr", addr)
+	server := &http.Server{
+		Addr: addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+			handler.ServeHTTP(rec, r)
+			apiRequests.WithLabelValues(r.Pattern, strconv.Itoa(rec.code)).Inc() // pattern set by the mux, "" when unmatched
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// gRPC service
+	grpcAddr := os.Getenv("GRPC_ADDR")
+	if grpcAddr == "" {
+		grpcAddr = ":50051"
+	}
+	admin.SetConfig("grpc_addr", grpcAddr)
+	lis, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		log.Fatal("[Fatal][Error] gRPC port could not be opened. Error: ", err)
+	}
+	grpcServer := grpc.NewServer()
+	tradebotv1.RegisterMarketDataServer(grpcServer, &GrpcServer{API: api, QueueSize: 256})
+	go func() {
+		log.Printf("[Info] Serving the gRPC API on %v\n", grpcAddr)
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Fatal("[Fatal][Error] gRPC API could not be served. Error: ", err)
+		}
+	}()
+
+	// no new requests once the shutdown starts. the push clients are served until the feeds are drained
+	shutdownOrchestrator.Register(shared.PhaseStopIngest, "rest server", server.Shutdown)
+	shutdownOrchestrator.Register(shared.PhaseCloseConnections, "push clients", shared.StopFunc(hub.Close)) // hijacked connections are not closed by Shutdown, subscriptions end too
+	shutdownOrchestrator.Register(shared.PhaseCloseConnections, "grpc server", func(ctx context.Context) error {
+		err := shared.StopFunc(grpcServer.GracefulStop)(ctx) // waits for the subscriptions
+		if err != nil {
+			grpcServer.Stop()
+		}
+		return err
+	})
+
+	log.Printf("[Info] Serving the REST API on %v\n", addr)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal("[Fatal][Error] REST API could not be served. Error: ", err)
+	}
+}
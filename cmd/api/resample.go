@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/kaanureyen/tradebot/cmd/shared"
+)
+
+type Trade struct {
+	Time     time.Time `json:"time"`
+	Price    float64   `json:"price"`
+	Quantity float64   `json:"quantity"`
+}
+
+type Candle struct {
+	Time   time.Time `json:"time"` // start of the candle
+	Open   float64   `json:"open"`
+	High   float64   `json:"high"`
+	Low    float64   `json:"low"`
+	Close  float64   `json:"close"`
+	Volume float64   `json:"volume"`
+}
+
+type IndicatorPoint struct {
+	Time     time.Time `json:"time"` // start of the candle the values are at the close of
+	SmaShort float64   `json:"sma_short"`
+	SmaLong  float64   `json:"sma_long"`
+}
+
+// extends the candle with the following one
+func (c *Candle) merge(next Candle) {
+	c.High = math.Max(c.High, next.High)
+	c.Low = math.Min(c.Low, next.Low)
+	c.Close = next.Close
+	c.Volume += next.Volume
+}
+
+// combines chronological bars into candles of resolution, a multiple of the bar period
+func resampleBars(bars []shared.AggregatedTradeInfo, resolution time.Duration) []Candle {
+	var candles []Candle
+	for _, b := range bars {
+		c := Candle{Time: b.FirstTime.Truncate(resolution), Open: b.FirstPrice, High: b.MaxPrice, Low: b.MinPrice, Close: b.LastPrice, Volume: b.Volume}
+		if n := len(candles); n > 0 && candles[n-1].Time.Equal(c.Time) {
+			candles[n-1].merge(c)
+			continue
+		}
+		candles = append(candles, c)
+	}
+	return candles
+}
+
+// keeps the last SMA values of each candle of resolution
+func resampleSmas(smas []shared.SmaStruct, resolution time.Duration) []IndicatorPoint {
+	var points []IndicatorPoint
+	for _, s := range smas {
+		start := s.TimeStamp.Truncate(resolution)
+		p := IndicatorPoint{Time: start, SmaShort: s.Sma50, SmaLong: s.Sma200}
+		if n := len(points); n > 0 && points[n-1].Time.Equal(start) {
+			points[n-1] = p
+			continue
+		}
+		points = append(points, p)
+	}
+	return points
+}
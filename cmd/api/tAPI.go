@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kaanureyen/tradebot/cmd/shared"
+)
+
+const (
+	supportedSymbol = shared.Symbol
+	defaultLimit    = 500
+	maxLimit        = 5000
+	maxResolution   = 24 * time.Hour
+)
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// read-only REST API of the stored candles, indicators and signals
+type API struct {
+	Store Store
+	Hub   *Hub // websocket push API on /v1/ws, optional
+}
+
+func (a *API) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/candles", a.candles)
+	mux.HandleFunc("GET /v1/indicators", a.indicators)
+	mux.HandleFunc("GET /v1/signals", a.signals)
+	if a.Hub != nil {
+		mux.Handle("GET /v1/ws", a.Hub)
+	}
+	mux.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPISpec)
+	})
+	return mux
+}
+
+// query parameters common to the endpoints
+type query struct {
+	symbol     string
+	resolution time.Duration
+	from, to   time.Time
+	limit      int
+	csv        bool
+}
+
+// parses symbol, resolution, from (or cursor), to, limit and format
+func parseQuery(r *http.Request) (query, error) {
+	v := r.URL.Query()
+	q := query{symbol: supportedSymbol, resolution: shared.AggregatePeriod, to: time.Now(), limit: defaultLimit}
+
+	if err := checkSymbol(v.Get("symbol")); err != nil {
+		return q, err
+	}
+	var err error
+	if s := v.Get("resolution"); s != "" {
+		if q.resolution, err = parseResolution(s); err != nil {
+			return q, err
+		}
+	}
+	from := v.Get("from")
+	if c := v.Get("cursor"); c != "" {
+		from = c
+	}
+	if from != "" {
+		if q.from, err = shared.ParseTime(from); err != nil {
+			return q, fmt.Errorf("from: %w", err)
+		}
+	}
+	if s := v.Get("to"); s != "" {
+		if q.to, err = shared.ParseTime(s); err != nil {
+			return q, fmt.Errorf("to: %w", err)
+		}
+	}
+	if s := v.Get("limit"); s != "" {
+		if q.limit, err = strconv.Atoi(s); err != nil || q.limit <= 0 || q.limit > maxLimit {
+			return q, fmt.Errorf("limit must be in [1, %v]", maxLimit)
+		}
+	}
+	switch v.Get("format") {
+	case "", "json":
+		q.csv = v.Get("format") == "" && strings.Contains(r.Header.Get("Accept"), "text/csv")
+	case "csv":
+		q.csv = true
+	default:
+		return q, fmt.Errorf("format must be json or csv")
+	}
+	return q, nil
+}
+
+// empty or supportedSymbol in any case
+func checkSymbol(s string) error {
+	if s != "" && !strings.EqualFold(s, supportedSymbol) {
+		return fmt.Errorf("unknown symbol %q, only %v is available", s, supportedSymbol)
+	}
+	return nil
+}
+
+// a multiple of the bar period up to maxResolution
+func checkResolution(d time.Duration) error {
+	if d <= 0 || d%shared.AggregatePeriod != 0 || d > maxResolution {
+		return fmt.Errorf("resolution must be a multiple of %v up to %v", shared.AggregatePeriod, maxResolution)
+	}
+	return nil
+}
+
+func parseResolution(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, checkResolution(0)
+	}
+	return d, checkResolution(d)
+}
+
+func (a *API) candles(w http.ResponseWriter, r *http.Request) {
+	q, err := parseQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	candles, next, err := a.candlePage(r.Context(), q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	write(w, q, candles, next, []string{"time", "open", "high", "low", "close", "volume"}, func(c Candle) []string {
+		return []string{formatTime(c.Time), formatFloat(c.Open), formatFloat(c.High), formatFloat(c.Low), formatFloat(c.Close), formatFloat(c.Volume)}
+	})
+}
+
+func (a *API) indicators(w http.ResponseWriter, r *http.Request) {
+	q, err := parseQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	points, next, err := a.indicatorPage(r.Context(), q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	write(w, q, points, next, []string{"time", "sma_short", "sma_long"}, func(p IndicatorPoint) []string {
+		return []string{formatTime(p.Time), formatFloat(p.SmaShort), formatFloat(p.SmaLong)}
+	})
+}
+
+func (a *API) signals(w http.ResponseWriter, r *http.Request) {
+	q, err := parseQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	signals, next, err := a.signalPage(r.Context(), q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	write(w, q, signals, next, []string{"timestamp", "signal", "price", "sma50", "sma200", "reason"}, func(s shared.TradeSignal) []string {
+		return []string{formatTime(s.TimeStamp), s.Signal, formatFloat(s.Price), formatFloat(s.Sma50), formatFloat(s.Sma200), s.Reason}
+	})
+}
+
+// candles of the query and the cursor of the next page
+func (a *API) candlePage(ctx context.Context, q query) ([]Candle, string, error) {
+	// enough bars for one candle more than the page, to know whether there is a next page
+	from := q.from.Truncate(q.resolution)
+	ratio := int64(q.resolution / shared.AggregatePeriod)
+	bars, err := a.Store.Bars(ctx, from, q.to, (int64(q.limit)+1)*ratio)
+	if err != nil {
+		return nil, "", err
+	}
+	candles, next := page(resampleBars(bars, q.resolution), q.limit, func(c Candle) time.Time { return c.Time })
+	return candles, next, nil
+}
+
+func (a *API) indicatorPage(ctx context.Context, q query) ([]IndicatorPoint, string, error) {
+	from := q.from.Truncate(q.resolution)
+	ratio := int64(q.resolution / shared.AggregatePeriod)
+	smas, err := a.Store.Smas(ctx, from, q.to, (int64(q.limit)+1)*ratio)
+	if err != nil {
+		return nil, "", err
+	}
+	points, next := page(resampleSmas(smas, q.resolution), q.limit, func(p IndicatorPoint) time.Time { return p.Time })
+	return points, next, nil
+}
+
+func (a *API) signalPage(ctx context.Context, q query) ([]shared.TradeSignal, string, error) {
+	signals, err := a.Store.Signals(ctx, q.from, q.to, int64(q.limit)+1)
+	if err != nil {
+		return nil, "", err
+	}
+	signals, next := page(signals, q.limit, func(s shared.TradeSignal) time.Time { return s.TimeStamp })
+	return signals, next, nil
+}
+
+// first limit items, and the cursor of the next page or "" on the last page
+func page[T any](items []T, limit int, start func(T) time.Time) ([]T, string) {
+	if len(items) <= limit {
+		return items, ""
+	}
+	return items[:limit], formatTime(start(items[limit]))
+}
+
+type response[T any] struct {
+	Symbol     string `json:"symbol"`
+	Resolution string `json:"resolution"`
+	Data       []T    `json:"data"`
+	Next       string `json:"next,omitempty"` // cursor of the next page
+}
+
+// writes the page as JSON or CSV. the CSV cursor of the next page is in the X-Next-Cursor header
+func write[T any](w http.ResponseWriter, q query, items []T, next string, header []string, row func(T) []string) {
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+	}
+	if !q.csv {
+		if items == nil {
+			items = []T{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response[T]{Symbol: q.symbol, Resolution: q.resolution.String(), Data: items, Next: next})
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	for _, item := range items {
+		cw.Write(row(item))
+	}
+	cw.Flush()
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
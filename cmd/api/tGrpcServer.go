@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/kaanureyen/tradebot/cmd/shared"
+	tradebotv1 "github.com/kaanureyen/tradebot/proto/tradebot/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// MarketData gRPC service: history from the API store, subscriptions from the hub
+type GrpcServer struct {
+	tradebotv1.UnimplementedMarketDataServer
+	API       *API
+	QueueSize int // messages waiting per subscription
+}
+
+func (s *GrpcServer) GetBars(ctx context.Context, req *tradebotv1.HistoryRequest) (*tradebotv1.BarsResponse, error) {
+	q, err := historyQuery(req)
+	if err != nil {
+		return nil, err
+	}
+	candles, next, err := s.API.candlePage(ctx, q)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	res := &tradebotv1.BarsResponse{NextPageToken: next}
+	now := time.Now()
+	for _, c := range candles {
+		res.Bars = append(res.Bars, pbBar(c, q.resolution, !c.Time.Add(q.resolution).After(now)))
+	}
+	return res, nil
+}
+
+func (s *GrpcServer) GetIndicators(ctx context.Context, req *tradebotv1.HistoryRequest) (*tradebotv1.IndicatorsResponse, error) {
+	q, err := historyQuery(req)
+	if err != nil {
+		return nil, err
+	}
+	points, next, err := s.API.indicatorPage(ctx, q)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	res := &tradebotv1.IndicatorsResponse{NextPageToken: next}
+	for _, p := range points {
+		res.Indicators = append(res.Indicators, pbIndicator(p))
+	}
+	return res, nil
+}
+
+func (s *GrpcServer) GetSignals(ctx context.Context, req *tradebotv1.HistoryRequest) (*tradebotv1.SignalsResponse, error) {
+	q, err := historyQuery(req)
+	if err != nil {
+		return nil, err
+	}
+	signals, next, err := s.API.signalPage(ctx, q)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	res := &tradebotv1.SignalsResponse{NextPageToken: next}
+	for _, sig := range signals {
+		res.Signals = append(res.Signals, pbSignal(sig))
+	}
+	return res, nil
+}
+
+func (s *GrpcServer) SubscribeTrades(req *tradebotv1.SubscribeRequest, stream grpc.ServerStreamingServer[tradebotv1.Trade]) error {
+	if err := checkSymbol(req.GetSymbol()); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return forward(s, stream, func(m wsMessage) *tradebotv1.Trade {
+		t := m.Data.(Trade)
+		return &tradebotv1.Trade{Symbol: supportedSymbol, Time: timestamppb.New(t.Time), Price: t.Price, Quantity: t.Quantity}
+	}, subscription{stream: streamTrades})
+}
+
+func (s *GrpcServer) SubscribeBars(req *tradebotv1.SubscribeBarsRequest, stream grpc.ServerStreamingServer[tradebotv1.Bar]) error {
+	if err := checkSymbol(req.GetSymbol()); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	resolution := shared.AggregatePeriod
+	if req.Resolution != nil {
+		resolution = req.Resolution.AsDuration()
+		if err := checkResolution(resolution); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	subs := []subscription{{streamBars, resolution}}
+	if req.IncludeUpdates {
+		subs = append(subs, subscription{streamBarUpdates, resolution})
+	}
+	return forward(s, stream, func(m wsMessage) *tradebotv1.Bar {
+		return pbBar(m.Data.(Candle), resolution, m.Type == "bar")
+	}, subs...)
+}
+
+func (s *GrpcServer) SubscribeIndicators(req *tradebotv1.SubscribeRequest, stream grpc.ServerStreamingServer[tradebotv1.Indicator]) error {
+	if err := checkSymbol(req.GetSymbol()); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return forward(s, stream, func(m wsMessage) *tradebotv1.Indicator {
+		return pbIndicator(m.Data.(IndicatorPoint))
+	}, subscription{stream: streamIndicators})
+}
+
+func (s *GrpcServer) SubscribeSignals(req *tradebotv1.SubscribeRequest, stream grpc.ServerStreamingServer[tradebotv1.TradeSignal]) error {
+	if err := checkSymbol(req.GetSymbol()); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return forward(s, stream, func(m wsMessage) *tradebotv1.TradeSignal {
+		return pbSignal(m.Data.(shared.TradeSignal))
+	}, subscription{stream: streamSignals})
+}
+
+// sends the messages of subs (one or two) until the client leaves or its subscription is ended by the hub
+func forward[T any](s *GrpcServer, stream grpc.ServerStreamingServer[T], convert func(wsMessage) *T, subs ...subscription) error {
+	var listeners [2]*hubListener
+	var chans [2]<-chan wsMessage // nil for the unused one, never ready
+	for i, sub := range subs {
+		listeners[i] = s.API.Hub.Listen(sub, s.QueueSize)
+		defer s.API.Hub.Unlisten(listeners[i])
+		chans[i] = listeners[i].C
+	}
+	for {
+		var msg wsMessage
+		var ok bool
+		var l *hubListener
+		select {
+		case msg, ok = <-chans[0]:
+			l = listeners[0]
+		case msg, ok = <-chans[1]:
+			l = listeners[1]
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		}
+		if !ok {
+			if l.Reason == "slow_consumer" {
+				return status.Error(codes.ResourceExhausted, "subscriber fell behind")
+			}
+			return status.Error(codes.Unavailable, "server is shutting down")
+		}
+		if err := stream.Send(convert(msg)); err != nil {
+			return err
+		}
+	}
+}
+
+// query of the request with the defaults and limits of the REST API
+func historyQuery(req *tradebotv1.HistoryRequest) (query, error) {
+	q := query{symbol: supportedSymbol, resolution: shared.AggregatePeriod, to: time.Now(), limit: defaultLimit}
+	if err := checkSymbol(req.GetSymbol()); err != nil {
+		return q, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.Resolution != nil {
+		q.resolution = req.Resolution.AsDuration()
+		if err := checkResolution(q.resolution); err != nil {
+			return q, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	if req.From != nil {
+		q.from = req.From.AsTime()
+	}
+	if req.PageToken != "" {
+		t, err := time.Parse(time.RFC3339Nano, req.PageToken)
+		if err != nil {
+			return q, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+		q.from = t
+	}
+	if req.To != nil {
+		q.to = req.To.AsTime()
+	}
+	if req.Limit != 0 {
+		if req.Limit < 0 || req.Limit > maxLimit {
+			return q, status.Errorf(codes.InvalidArgument, "limit must be in [1, %v]", maxLimit)
+		}
+		q.limit = int(req.Limit)
+	}
+	return q, nil
+}
+
+func pbBar(c Candle, resolution time.Duration, closed bool) *tradebotv1.Bar {
+	return &tradebotv1.Bar{
+		Symbol:     supportedSymbol,
+		Start:      timestamppb.New(c.Time),
+		Resolution: durationpb.New(resolution),
+		Open:       c.Open,
+		High:       c.High,
+		Low:        c.Low,
+		Close:      c.Close,
+		Volume:     c.Volume,
+		Closed:     closed,
+	}
+}
+
+func pbIndicator(p IndicatorPoint) *tradebotv1.Indicator {
+	return &tradebotv1.Indicator{Symbol: supportedSymbol, Time: timestamppb.New(p.Time), SmaShort: p.SmaShort, SmaLong: p.SmaLong}
+}
+
+func pbSignal(s shared.TradeSignal) *tradebotv1.TradeSignal {
+	signal := tradebotv1.Signal_SIGNAL_UNSPECIFIED
+	switch s.Signal {
+	case "BUY":
+		signal = tradebotv1.Signal_SIGNAL_BUY
+	case "SELL":
+		signal = tradebotv1.Signal_SIGNAL_SELL
+	}
+	return &tradebotv1.TradeSignal{
+		Symbol:   supportedSymbol,
+		Time:     timestamppb.New(s.TimeStamp),
+		Signal:   signal,
+		Price:    s.Price,
+		SmaShort: s.Sma50,
+		SmaLong:  s.Sma200,
+		Reason:   s.Reason,
+	}
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/kaanureyen/tradebot/cmd/shared"
+)
+
+// streams of the push APIs
+const (
+	streamTrades     = "trades"
+	streamBars       = "bars"
+	streamBarUpdates = "bar_updates"
+	streamIndicators = "indicators"
+	streamSignals    = "signals"
+)
+
+// request of a websocket client
+type wsRequest struct {
+	Action     string `json:"action"` // subscribe or unsubscribe
+	Stream     string `json:"stream"`
+	Symbol     string `json:"symbol"`
+	Resolution string `json:"resolution"` // of bars and bar_updates, the bar period by default
+}
+
+// message to a websocket client or a listener
+type wsMessage struct {
+	Type       string `json:"type"` // trade, bar, bar_update, indicator, signal, subscribed, unsubscribed or error
+	Stream     string `json:"stream,omitempty"`
+	Symbol     string `json:"symbol,omitempty"`
+	Resolution string `json:"resolution,omitempty"`
+	Data       any    `json:"data,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type subscription struct {
+	stream     string
+	resolution time.Duration // of bars and bar_updates, 0 for the other streams
+}
+
+type wsClient struct {
+	conn *websocket.Conn
+	send chan []byte
+	subs map[subscription]bool // guarded by the hub
+	done chan struct{}
+	once sync.Once
+}
+
+// in-process subscriber, e.g. a gRPC stream. C is closed when it falls behind or the hub closes
+type hubListener struct {
+	C      <-chan wsMessage
+	Reason string // why C was closed: slow_consumer, shutdown or closed. read after C is closed
+	sub    subscription
+	ch     chan wsMessage
+}
+
+func (c *wsClient) close() {
+	c.once.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// candles of one resolution, built from the closed bars
+type candleBuilder struct {
+	resolution time.Duration
+	candle     Candle // closed bars of the current candle
+	started    bool
+	last       time.Time // start of the last bar added
+}
+
+func barCandle(bar shared.BarEvent, resolution time.Duration) Candle {
+	return Candle{Time: bar.Start.Truncate(resolution), Open: bar.Open, High: bar.High, Low: bar.Low, Close: bar.Close, Volume: bar.Volume}
+}
+
+// adds a closed bar, returns the candles it completes. a candle without trades in its
+// last bar is completed by the first bar of a following candle
+func (b *candleBuilder) add(bar shared.BarEvent) []Candle {
+	if !b.last.IsZero() && !bar.Start.After(b.last) {
+		return nil // already added
+	}
+	b.last = bar.Start
+	var closed []Candle
+	c := barCandle(bar, b.resolution)
+	if b.started && !b.candle.Time.Equal(c.Time) {
+		closed = append(closed, b.candle)
+		b.started = false
+	}
+	if b.started {
+		b.candle.merge(c)
+	} else {
+		b.candle, b.started = c, true
+	}
+	if !bar.Start.Add(shared.AggregatePeriod).Before(b.candle.Time.Add(b.resolution)) {
+		closed = append(closed, b.candle)
+		b.started = false
+	}
+	return closed
+}
+
+// the candle in progress with the bar in progress
+func (b *candleBuilder) partial(bar shared.BarEvent) Candle {
+	c := barCandle(bar, b.resolution)
+	if b.started && b.candle.Time.Equal(c.Time) {
+		p := b.candle
+		p.merge(c)
+		return p
+	}
+	return c
+}
+
+// pushes the trades, bars, bar updates, indicators and signals to the subscribed websocket clients and listeners.
+// every client has a queue of QueueSize messages: bar updates that do not fit are dropped,
+// the client is disconnected when any other message does not fit or a write takes over WriteTimeout.
+type Hub struct {
+	Store        Store // seeds the candles of a resolution first subscribed mid-candle, optional
+	QueueSize    int
+	WriteTimeout time.Duration
+	PingInterval time.Duration // clients not answering for two intervals are disconnected
+
+	upgrader  websocket.Upgrader
+	mu        sync.Mutex
+	clients   map[*wsClient]struct{}
+	listeners map[*hubListener]struct{}
+	builders  map[time.Duration]*candleBuilder // by resolution, for the bars and bar_updates streams
+}
+
+func NewHub(store Store) *Hub {
+	return &Hub{
+		Store:        store,
+		QueueSize:    256,
+		WriteTimeout: 10 * time.Second,
+		PingInterval: 30 * time.Second,
+		upgrader:     websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}, // public market data
+		clients:      make(map[*wsClient]struct{}),
+		listeners:    make(map[*hubListener]struct{}),
+		builders:     make(map[time.Duration]*candleBuilder),
+	}
+}
+
+// trade from fetcher
+func (h *Hub) OnTrade(t Trade) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.broadcast(subscription{stream: streamTrades}, wsMessage{Type: "trade", Symbol: supportedSymbol, Data: t}, false)
+}
+
+// closed bar from aggregator
+func (h *Hub) OnBar(bar shared.BarEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for res, b := range h.builders {
+		for _, c := range b.add(bar) {
+			h.broadcast(subscription{streamBars, res}, wsMessage{Type: "bar", Symbol: bar.Symbol, Resolution: res.String(), Data: c}, false)
+		}
+	}
+}
+
+// bar in progress from aggregator
+func (h *Hub) OnBarUpdate(bar shared.BarEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for res, b := range h.builders {
+		h.broadcast(subscription{streamBarUpdates, res}, wsMessage{Type: "bar_update", Symbol: bar.Symbol, Resolution: res.String(), Data: b.partial(bar)}, true)
+	}
+}
+
+// indicators of a closed bar from aggregator
+func (h *Hub) OnIndicator(p IndicatorPoint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.broadcast(subscription{stream: streamIndicators}, wsMessage{Type: "indicator", Symbol: supportedSymbol, Data: p}, false)
+}
+
+func (h *Hub) OnSignal(s shared.TradeSignal) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.broadcast(subscription{stream: streamSignals}, wsMessage{Type: "signal", Symbol: supportedSymbol, Data: s}, false)
+}
+
+// disconnects every client and ends every listener
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		h.disconnect(c, "shutdown")
+	}
+	for l := range h.listeners {
+		h.unlisten(l, "shutdown")
+	}
+}
+
+// messages of sub, with the same backpressure as the websocket clients: the listener is
+// closed when a message other than a bar update does not fit in queueSize
+func (h *Hub) Listen(sub subscription, queueSize int) *hubListener {
+	if sub.resolution != 0 {
+		h.ensureBuilder(sub.resolution)
+	}
+	ch := make(chan wsMessage, queueSize)
+	l := &hubListener{C: ch, sub: sub, ch: ch}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listeners[l] = struct{}{}
+	return l
+}
+
+func (h *Hub) Unlisten(l *hubListener) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.unlisten(l, "closed")
+}
+
+// the lock must be held
+func (h *Hub) unlisten(l *hubListener, reason string) {
+	if _, ok := h.listeners[l]; !ok {
+		return
+	}
+	delete(h.listeners, l)
+	pushDisconnects.WithLabelValues(reason).Inc()
+	l.Reason = reason
+	close(l.ch)
+}
+
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // the upgrader replied with the error
+	}
+	c := h.register(conn)
+	go h.writeLoop(c)
+	h.readLoop(c)
+}
+
+func (h *Hub) register(conn *websocket.Conn) *wsClient {
+	c := &wsClient{conn: conn, send: make(chan []byte, h.QueueSize), subs: make(map[subscription]bool), done: make(chan struct{})}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[c] = struct{}{}
+	wsClients.Set(float64(len(h.clients)))
+	return c
+}
+
+// queues the message for the subscribers of sub. the lock must be held
+func (h *Hub) broadcast(sub subscription, msg wsMessage, droppable bool) {
+	for l := range h.listeners {
+		if l.sub != sub {
+			continue
+		}
+		select {
+		case l.ch <- msg:
+		default:
+			if droppable {
+				pushDroppedUpdates.Inc()
+				continue
+			}
+			h.unlisten(l, "slow_consumer")
+		}
+	}
+	var data []byte
+	for c := range h.clients {
+		if !c.subs[sub] {
+			continue
+		}
+		if data == nil {
+			var err error
+			if data, err = json.Marshal(msg); err != nil {
+				log.Printf("[Warning] Failed marshaling %v message: %v\n", msg.Type, err)
+				return
+			}
+		}
+		h.enqueue(c, data, droppable)
+	}
+}
+
+// the lock must be held
+func (h *Hub) enqueue(c *wsClient, data []byte, droppable bool) {
+	select {
+	case c.send <- data:
+	default:
+		if droppable {
+			pushDroppedUpdates.Inc()
+			return
+		}
+		h.disconnect(c, "slow_consumer")
+	}
+}
+
+func (h *Hub) reply(c *wsClient, msg wsMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("[Warning] Failed marshaling %v message: %v\n", msg.Type, err)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[c]; ok {
+		h.enqueue(c, data, false)
+	}
+}
+
+func (h *Hub) remove(c *wsClient, reason string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.disconnect(c, reason)
+}
+
+// the lock must be held
+func (h *Hub) disconnect(c *wsClient, reason string) {
+	if _, ok := h.clients[c]; !ok {
+		return
+	}
+	delete(h.clients, c)
+	wsClients.Set(float64(len(h.clients)))
+	pushDisconnects.WithLabelValues(reason).Inc()
+	c.close()
+}
+
+func (h *Hub) readLoop(c *wsClient) {
+	c.conn.SetReadLimit(4096)
+	c.conn.SetReadDeadline(time.Now().Add(2 * h.PingInterval))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(2 * h.PingInterval))
+	})
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			h.remove(c, "closed")
+			return
+		}
+		var req wsRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			h.reply(c, wsMessage{Type: "error", Error: "invalid request: " + err.Error()})
+			continue
+		}
+		h.handle(c, req)
+	}
+}
+
+func (h *Hub) writeLoop(c *wsClient) {
+	ping := time.NewTicker(h.PingInterval)
+	defer ping.Stop()
+	for {
+		var err error
+		select {
+		case data := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(h.WriteTimeout))
+			err = c.conn.WriteMessage(websocket.TextMessage, data)
+		case <-ping.C:
+			err = c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(h.WriteTimeout))
+		case <-c.done:
+			return
+		}
+		if err != nil {
+			reason := "write_error"
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				reason = "slow_consumer"
+			}
+			h.remove(c, reason)
+			return
+		}
+	}
+}
+
+func (h *Hub) handle(c *wsClient, req wsRequest) {
+	if req.Action != "subscribe" && req.Action != "unsubscribe" {
+		h.reply(c, wsMessage{Type: "error", Error: "action must be subscribe or unsubscribe"})
+		return
+	}
+	sub, err := parseSubscription(req)
+	if err != nil {
+		h.reply(c, wsMessage{Type: "error", Stream: req.Stream, Error: err.Error()})
+		return
+	}
+	if req.Action == "subscribe" && sub.resolution != 0 {
+		h.ensureBuilder(sub.resolution)
+	}
+	h.mu.Lock()
+	if req.Action == "subscribe" {
+		c.subs[sub] = true
+	} else {
+		delete(c.subs, sub)
+	}
+	h.mu.Unlock()
+
+	msg := wsMessage{Type: req.Action + "d", Stream: sub.stream, Symbol: supportedSymbol}
+	if sub.resolution != 0 {
+		msg.Resolution = sub.resolution.String()
+	}
+	h.reply(c, msg)
+}
+
+func parseSubscription(req wsRequest) (subscription, error) {
+	sub := subscription{stream: req.Stream}
+	if err := checkSymbol(req.Symbol); err != nil {
+		return sub, err
+	}
+	switch req.Stream {
+	case streamTrades, streamIndicators, streamSignals:
+		return sub, nil
+	case streamBars, streamBarUpdates:
+		sub.resolution = shared.AggregatePeriod
+		if req.Resolution == "" {
+			return sub, nil
+		}
+		var err error
+		sub.resolution, err = parseResolution(req.Resolution)
+		return sub, err
+	default:
+		return sub, fmt.Errorf("stream must be %v, %v, %v, %v or %v", streamTrades, streamBars, streamBarUpdates, streamIndicators, streamSignals)
+	}
+}
+
+// starts building the candles of resolution, from the stored bars of the current candle
+func (h *Hub) ensureBuilder(resolution time.Duration) {
+	h.mu.Lock()
+	_, ok := h.builders[resolution]
+	h.mu.Unlock()
+	if ok {
+		return
+	}
+
+	b := &candleBuilder{resolution: resolution}
+	if h.Store != nil && resolution > shared.AggregatePeriod {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		now := time.Now()
+		bars, err := h.Store.Bars(ctx, now.Truncate(resolution), now, int64(resolution/shared.AggregatePeriod))
+		if err != nil {
+			log.Printf("[Warning] Cannot load the bars of the current %v candle, it will be partial: %v\n", resolution, err)
+		}
+		for _, v := range bars {
+			b.add(shared.NewBarEvent(supportedSymbol, v, shared.AggregatePeriod, true))
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.builders[resolution]; !ok {
+		h.builders[resolution] = b
+	}
+}
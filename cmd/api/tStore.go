@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/kaanureyen/tradebot/cmd/shared"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// stored series in [from, to) in chronological order, at most limit items
+type Store interface {
+	Bars(ctx context.Context, from, to time.Time, limit int64) ([]shared.AggregatedTradeInfo, error)
+	Smas(ctx context.Context, from, to time.Time, limit int64) ([]shared.SmaStruct, error)
+	Signals(ctx context.Context, from, to time.Time, limit int64) ([]shared.TradeSignal, error)
+}
+
+// Store of the collections written by aggregator
+type MongoStore struct {
+	Aggr   *mongo.Collection
+	Sma    *mongo.Collection
+	Signal *mongo.Collection
+}
+
+func (s *MongoStore) Bars(ctx context.Context, from, to time.Time, limit int64) ([]shared.AggregatedTradeInfo, error) {
+	var results []shared.AggregatedTradeInfo
+	err := findRange(ctx, s.Aggr, "lasttimestamp", from, to, limit, &results)
+	return results, err
+}
+
+func (s *MongoStore) Smas(ctx context.Context, from, to time.Time, limit int64) ([]shared.SmaStruct, error) {
+	var results []shared.SmaStruct
+	err := findRange(ctx, s.Sma, "timestamp", from, to, limit, &results)
+	return results, err
+}
+
+func (s *MongoStore) Signals(ctx context.Context, from, to time.Time, limit int64) ([]shared.TradeSignal, error) {
+	var results []shared.TradeSignal
+	err := findRange(ctx, s.Signal, "timestamp", from, to, limit, &results)
+	return results, err
+}
+
+func findRange(ctx context.Context, collection *mongo.Collection, timeField string, from, to time.Time, limit int64, results any) error {
+	filter := bson.D{{Key: timeField, Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}}}
+	opts := options.Find().SetSort(bson.D{{Key: timeField, Value: 1}}).SetLimit(limit)
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	return cursor.All(ctx, results)
+}
@@ -1,7 +1,17 @@
 package main
 
 import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	binance_connector "github.com/binance/binance-connector-go"
+	"github.com/kaanureyen/tradebot/cmd/shared"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
 )
 
 func TestDummy(t *testing.T) {
@@ -12,3 +22,268 @@ func TestDummy(t *testing.T) {
 	}
 
 }
+
+// connections of a fake exchange, each one streams the trades sent on its feed
+type fakeExchange struct {
+	conns chan *fakeConn
+}
+
+type fakeConn struct {
+	feed    chan int64
+	stopped chan struct{}
+}
+
+func (x *fakeExchange) connect(symbol string, handler binance_connector.WsTradeHandler, errHandler binance_connector.ErrHandler) (chan struct{}, chan struct{}, error) {
+	doneCh, stopCh := make(chan struct{}), make(chan struct{})
+	c := &fakeConn{feed: make(chan int64), stopped: make(chan struct{})}
+	go func() {
+		defer close(doneCh)
+		for {
+			select {
+			case id := <-c.feed:
+				handler(&binance_connector.WsTradeEvent{Symbol: symbol, TradeID: id})
+			case <-stopCh:
+				close(c.stopped)
+				return
+			}
+		}
+	}()
+	x.conns <- c
+	return doneCh, stopCh, nil
+}
+
+func newTestStream(x *fakeExchange, trades chan int64) *Stream {
+	policy := &shared.ReconnectPolicy{BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond, Budget: 100, BudgetWindow: time.Minute, FailureThreshold: 5, OpenTime: 10 * time.Millisecond, StableAfter: time.Minute}
+	s := NewStream("BTCUSDT", "0", newTradeDeduper(func(e *binance_connector.WsTradeEvent) { trades <- e.TradeID }), policy, func(error) {}, func() {})
+	s.Connect = x.connect
+	s.StaleTimeout, s.MaxAge, s.Overlap = time.Hour, time.Hour, 50*time.Millisecond
+	return s
+}
+
+func waitConn(t *testing.T, x *fakeExchange) *fakeConn {
+	select {
+	case c := <-x.conns:
+		return c
+	case <-time.After(2 * time.Second):
+		t.Fatal("no connection")
+		return nil
+	}
+}
+
+func TestStreamStaleReconnect(t *testing.T) {
+	x := &fakeExchange{conns: make(chan *fakeConn, 4)}
+	trades := make(chan int64, 4)
+	s := newTestStream(x, trades)
+	s.StaleTimeout = 100 * time.Millisecond
+	quit, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { s.Run(quit); close(done) }()
+
+	first := waitConn(t, x)
+	first.feed <- 1
+	if got := <-trades; got != 1 {
+		t.Errorf("got trade %v; want 1", got)
+	}
+	// silent from now on
+	second := waitConn(t, x)
+	select {
+	case <-first.stopped:
+	case <-time.After(time.Second):
+		t.Error("the silent connection is not stopped")
+	}
+	second.feed <- 2
+	if got := <-trades; got != 2 {
+		t.Errorf("got trade %v; want 2", got)
+	}
+	cancel()
+	<-done
+}
+
+func TestStreamRotation(t *testing.T) {
+	x := &fakeExchange{conns: make(chan *fakeConn, 4)}
+	trades := make(chan int64, 8)
+	s := newTestStream(x, trades)
+	s.MaxAge, s.Overlap = 100*time.Millisecond, 500*time.Millisecond
+	quit, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { s.Run(quit); close(done) }()
+
+	old := waitConn(t, x)
+	old.feed <- 1
+	next := waitConn(t, x)
+	// both connections stream during the overlap, each trade is handled once
+	old.feed <- 2
+	next.feed <- 2
+	next.feed <- 3
+	select {
+	case <-old.stopped:
+	case <-time.After(time.Second):
+		t.Fatal("the old connection is not stopped after the overlap")
+	}
+	for _, want := range []int64{1, 2, 3} {
+		if got := <-trades; got != want {
+			t.Errorf("got trade %v; want %v", got, want)
+		}
+	}
+	if len(trades) != 0 {
+		t.Errorf("got %v more trades; want each once", len(trades))
+	}
+	cancel()
+	<-done
+	select {
+	case <-next.stopped:
+	default:
+		t.Error("the connection is not stopped at quit")
+	}
+}
+
+func TestRedundantStreams(t *testing.T) {
+	t.Setenv("FEED_CONNECTIONS", "2")
+	x := &fakeExchange{conns: make(chan *fakeConn, 4)}
+	trades := make(chan int64, 8)
+	streams := NewStreams("BTCUSDT", func(e *binance_connector.WsTradeEvent) { trades <- e.TradeID }, func(error) {}, func() {})
+	if len(streams) != 2 {
+		t.Fatalf("got %v streams; want 2", len(streams))
+	}
+	for _, s := range streams {
+		s.Connect = x.connect
+		s.StaleTimeout, s.MaxAge = time.Hour, time.Hour
+	}
+	first := func(connection string) float64 {
+		return testutil.ToFloat64(firstDeliveries.WithLabelValues(shared.Symbol, shared.TradeResolution, connection))
+	}
+	before0, before1 := first("0"), first("1")
+	quit, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { RunStreams(quit, streams); close(done) }()
+
+	a, b := waitConn(t, x), waitConn(t, x)
+	a.feed <- 1
+	b.feed <- 1
+	b.feed <- 2
+	a.feed <- 2
+	a.feed <- 3
+	b.feed <- 3
+	for _, want := range []int64{1, 2, 3} {
+		if got := <-trades; got != want {
+			t.Errorf("got trade %v; want %v", got, want)
+		}
+	}
+	cancel()
+	<-done
+	if len(trades) != 0 {
+		t.Errorf("got %v more trades; want each once", len(trades))
+	}
+	if n := first("0") + first("1") - before0 - before1; n != 3 {
+		t.Errorf("got %v first deliveries; want 3", n)
+	}
+}
+
+// the streams count their reconnects concurrently in the same window
+func TestConcurrentReconnects(t *testing.T) {
+	saved := rdb
+	rdb = redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}) // the storm incident fails fast
+	defer func() { rdb.Close(); rdb = saved }()
+	counted := func() float64 {
+		return testutil.ToFloat64(websocketReconnects.WithLabelValues(shared.Symbol, shared.TradeResolution))
+	}
+	before := counted()
+
+	t.Setenv("FEED_CONNECTIONS", "2")
+	streams := NewStreams("BTCUSDT", func(*binance_connector.WsTradeEvent) {}, func(error) {}, reconnectEvent)
+	for _, s := range streams {
+		s.Policy.BaseDelay, s.Policy.MaxDelay, s.Policy.Budget, s.Policy.FailureThreshold = 0, 0, 1000, 1000
+		s.StaleTimeout, s.MaxAge = time.Hour, time.Hour
+		// closes right away
+		s.Connect = func(string, binance_connector.WsTradeHandler, binance_connector.ErrHandler) (chan struct{}, chan struct{}, error) {
+			doneCh := make(chan struct{})
+			close(doneCh)
+			return doneCh, make(chan struct{}), nil
+		}
+	}
+	quit, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { RunStreams(quit, streams); close(done) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for counted()-before < 1000 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+	if n := counted() - before; n < 1000 {
+		t.Errorf("got %v reconnects; want at least 1000", n)
+	}
+	if n := recentReconnects.Count(time.Now()); float64(n) < counted()-before {
+		t.Errorf("got %v reconnects in the window; want every counted one", n)
+	}
+}
+
+func TestTradeDeduperOrder(t *testing.T) {
+	var handled []int64
+	d := newTradeDeduper(func(e *binance_connector.WsTradeEvent) { handled = append(handled, e.TradeID) })
+	// connection 1 lags behind connection 0, then gets ahead
+	for _, delivery := range []struct {
+		connection string
+		id         int64
+	}{{"0", 1}, {"0", 2}, {"1", 1}, {"0", 3}, {"1", 2}, {"1", 3}, {"1", 4}, {"0", 4}, {"1", 5}, {"0", 5}} {
+		d.Handle(delivery.connection, &binance_connector.WsTradeEvent{TradeID: delivery.id})
+	}
+	if len(handled) != 5 {
+		t.Fatalf("got %v; want each trade once", handled)
+	}
+	for i, id := range handled {
+		if id != int64(i+1) {
+			t.Errorf("got %v; want the trades in order", handled)
+			break
+		}
+	}
+}
+
+// the trades of concurrent connections are handed over one at a time, in order
+func TestTradeDeduperConcurrent(t *testing.T) {
+	var handling atomic.Int32
+	var handled []int64
+	d := newTradeDeduper(func(e *binance_connector.WsTradeEvent) {
+		if handling.Add(1) > 1 {
+			t.Error("trades handed over concurrently")
+		}
+		handled = append(handled, e.TradeID)
+		handling.Add(-1)
+	})
+	var wg sync.WaitGroup
+	for connection := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := int64(1); id <= 1000; id++ {
+				d.Handle(strconv.Itoa(connection), &binance_connector.WsTradeEvent{TradeID: id})
+			}
+		}()
+	}
+	wg.Wait()
+	for i := 1; i < len(handled); i++ {
+		if handled[i] <= handled[i-1] {
+			t.Fatalf("trade %v handed over after %v", handled[i], handled[i-1])
+		}
+	}
+	if handled[len(handled)-1] != 1000 {
+		t.Errorf("got last trade %v; want 1000", handled[len(handled)-1])
+	}
+}
+
+func TestStreamInvalidDurations(t *testing.T) {
+	for _, env := range []struct{ stale, age string }{{"0s", "5s"}, {"-1s", "1s"}, {"500ms", "-1h"}} {
+		t.Setenv("STALE_FEED_TIMEOUT", env.stale)
+		t.Setenv("MAX_CONNECTION_AGE", env.age)
+		s := NewStream("BTCUSDT", "0", newTradeDeduper(func(*binance_connector.WsTradeEvent) {}), shared.NewReconnectPolicy(), func(error) {}, func() {})
+		if s.StaleTimeout != shared.StaleFeedTimeout || s.MaxAge != shared.MaxConnectionAge {
+			t.Errorf("got %v, %v for %+v; want the defaults", s.StaleTimeout, s.MaxAge, env)
+		}
+	}
+	t.Setenv("STALE_FEED_TIMEOUT", "10s")
+	t.Setenv("MAX_CONNECTION_AGE", "1h")
+	s := NewStream("BTCUSDT", "0", newTradeDeduper(func(*binance_connector.WsTradeEvent) {}), shared.NewReconnectPolicy(), func(error) {}, func() {})
+	if s.StaleTimeout != 10*time.Second || s.MaxAge != time.Hour {
+		t.Errorf("got %v, %v; want 10s, 1h", s.StaleTimeout, s.MaxAge)
+	}
+}
@@ -3,17 +3,19 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/kaanureyen/tradebot/cmd/shared"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
 
 	binance_connector "github.com/binance/binance-connector-go"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // global redis & context to publish data
@@ -22,123 +24,243 @@ var rdb = redis.NewClient(&redis.Options{
 })
 var ctx = context.Background()
 
-// prometheus metrics
-var tradesReceived = prometheus.NewCounter(
+// prometheus metrics, by symbol and resolution. the latencies of receive and publish are in shared.StageLatency
+var tradesReceived = prometheus.NewCounterVec(
 	prometheus.CounterOpts{
 		Name: "trades_received_total",
 		Help: "Total number of trades received from Binance.",
 	},
+	[]string{"symbol", "resolution"},
 )
-var tradesPublished = prometheus.NewCounter(
+var tradesPublished = prometheus.NewCounterVec(
 	prometheus.CounterOpts{
 		Name: "trades_published_total",
 		Help: "Total number of trades published to Redis.",
 	},
+	[]string{"symbol", "resolution"},
 )
 
-var tradeEventDelay = prometheus.NewSummary(
-	prometheus.SummaryOpts{
-		Name:       "trade_event_delay_microseconds",
-		Help:       "Time taken to process and publish a trade event",
-		Objectives: map[float64]float64{0.5: 0.05, 0.95: 0.01, 0.99: 0.001},
+var websocketReconnects = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "websocket_reconnects_total",
+		Help: "Total number of reconnects to the Binance websocket stream.",
+	},
+	[]string{"symbol", "resolution"},
+)
+
+var staleReconnects = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "websocket_stale_reconnects_total",
+		Help: "Reconnects of open websocket connections that stopped delivering trades.",
 	},
+	[]string{"symbol", "resolution"},
 )
 
-var tradeInfoAge = prometheus.NewSummary(
-	prometheus.SummaryOpts{
-		Name:       "trade_info_age_milliseconds",
-		Help:       "Difference of local time and trade time in milliseconds",
-		Objectives: map[float64]float64{0.5: 0.05, 0.95: 0.01, 0.99: 0.001},
+var connectionRotations = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "websocket_rotations_total",
+		Help: "Connections replaced before the 24h limit of Binance.",
+	},
+	[]string{"symbol", "resolution"},
+)
+
+var duplicateTrades = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "websocket_duplicate_trades_total",
+		Help: "Trades received more than once, e.g. by both connections of a rotation, and published once.",
+	},
+	[]string{"symbol", "resolution"},
+)
+
+// connection that delivered each trade first, of the FEED_CONNECTIONS
+var firstDeliveries = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "websocket_first_deliveries_total",
+		Help: "Trades by the connection that delivered them first.",
+	},
+	[]string{"symbol", "resolution", "connection"},
+)
+
+// seconds since the last trade, since the start before the first one
+var started = time.Now()
+var lastEventAge = prometheus.NewGaugeFunc(
+	prometheus.GaugeOpts{
+		Name:        "websocket_last_event_age_seconds",
+		Help:        "Seconds since the last trade received from Binance.",
+		ConstLabels: prometheus.Labels{"symbol": shared.Symbol, "resolution": shared.TradeResolution},
+	},
+	func() float64 {
+		last := lastTrade.Last()
+		if last.IsZero() {
+			last = started
+		}
+		return time.Since(last).Seconds()
 	},
 )
 
+// reconnects in the last shared.ReconnectStormWindow
+var recentReconnects = shared.SlidingWindow{Window: shared.ReconnectStormWindow}
+
+// time the last trade was received, for the health checks
+var lastTrade shared.Heartbeat
+
+// loggers of the stream and the publishing, with the symbol once the logging is set up
+var (
+	wsLog      = slog.Default()
+	publishLog = slog.Default() // rate limited, fails for every trade while Redis is down
+)
+
 func main() {
-	shutdownOrchestrator := shared.InitCommon("fetcher") // set logger name, start http health endpoint, initialize & start shutdownOrchestrator
+	shutdownOrchestrator, admin := shared.InitCommon("fetcher") // set logger name, start admin server, initialize & start shutdownOrchestrator
 	defer func() {
-		<-shutdownOrchestrator.Done // blocks until every shutdownOrchestrator.Get()'s recv is sent an empty struct, after a interrupt/terminate signal.
+		<-shutdownOrchestrator.Done // closed once every phase of the shutdown finished or timed out, after a interrupt/terminate signal.
 		log.Println("[Info] Exiting...")
 	}()
+	wsLog = shared.NewLogger("websocket", shared.Symbol, 0)
+	publishLog = shared.RateLimited(shared.NewLogger("publish", shared.Symbol, 0), shared.LogRateLimit)
 
 	// register the prometheus metrics
 	prometheus.MustRegister(tradesReceived)
 	prometheus.MustRegister(tradesPublished)
-	prometheus.MustRegister(tradeEventDelay)
-	prometheus.MustRegister(tradeInfoAge)
-	// start prometheus metrics
-	go func() {
-		http.Handle("/metrics", promhttp.Handler())
-		log.Fatal("[Fatal][Error] Prometheus metrics endpoint could not be opened. Error: ", http.ListenAndServe(":2112", nil))
-	}()
+	prometheus.MustRegister(websocketReconnects)
+	prometheus.MustRegister(staleReconnects)
+	prometheus.MustRegister(connectionRotations)
+	prometheus.MustRegister(duplicateTrades)
+	prometheus.MustRegister(firstDeliveries)
+	prometheus.MustRegister(lastEventAge)
+
+	admin.SetConfig("symbol", "BTCUSDT")
+	admin.SetConfig("redis_channel", shared.RedisChannel)
+	streams := NewStreams("BTCUSDT", tradeEvent, errorEvent, reconnectEvent)
+	stream := streams[0]
+	admin.SetConfig("feed_connections", len(streams))
+	admin.SetConfig("reconnect_base_delay", stream.Policy.BaseDelay.String())
+	admin.SetConfig("reconnect_max_delay", stream.Policy.MaxDelay.String())
+	admin.SetConfig("connection_budget", fmt.Sprintf("%v per %v", stream.Policy.Budget, stream.Policy.BudgetWindow))
+	admin.SetConfig("stale_feed_timeout", stream.StaleTimeout.String())
+	admin.SetConfig("max_connection_age", stream.MaxAge.String())
+
+	// a silent feed is reconnected by the streams and backs off on the circuit breaker, a restart would bypass them
+	shared.Health.AddReadiness("last_trade", lastTrade.Check("trade", shared.ReadyMaxTradeAge))
+	shared.Health.AddReadiness("redis", shared.RedisCheck(rdb))
+	shared.Health.AddReadiness("reconnect_policy", stream.Policy.Check())
+
+	// state of the reconnect policy, shared by the streams
+	admin.Handle("GET /reconnect", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stream.Policy.Status(time.Now()))
+	}))
+	prometheus.MustRegister(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name:        "websocket_circuit_open",
+			Help:        "1 while the circuit breaker of the reconnects is open, 0.5 while half open.",
+			ConstLabels: prometheus.Labels{"symbol": shared.Symbol, "resolution": shared.TradeResolution},
+		},
+		func() float64 {
+			switch stream.Policy.Status(time.Now()).State {
+			case shared.CircuitOpen.String():
+				return 1
+			case shared.CircuitHalfOpen.String():
+				return 0.5
+			}
+			return 0
+		},
+	))
+	prometheus.MustRegister(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name:        "websocket_connection_budget_used",
+			Help:        "Connections opened in the budget window, of the limit of Binance.",
+			ConstLabels: prometheus.Labels{"symbol": shared.Symbol, "resolution": shared.TradeResolution},
+		},
+		func() float64 { return float64(stream.Policy.Status(time.Now()).Connections) },
+	))
+
+	// alerts of the feed, for deployments without Prometheus
+	alerts := shared.NewAlertEvaluator("fetcher")
+	received := &shared.Increase{Window: time.Minute}
+	alerts.Add(shared.AlertStaleTradeFeed, func(now time.Time) bool {
+		n, ok := received.Add(now, shared.CounterSum(tradesReceived))
+		return ok && n == 0
+	})
+	reconnects := &shared.Increase{Window: shared.ReconnectStormWindow}
+	alerts.Add(shared.AlertReconnectStorm, func(now time.Time) bool {
+		n, _ := reconnects.Add(now, shared.CounterSum(websocketReconnects))
+		return n >= shared.ReconnectStormCount
+	})
+	admin.Handle("GET /alerts", alerts)
+	alerts.Start(shutdownOrchestrator)
+
+	// the websocket stops first, the publishing client is closed last
+	quit, done := shutdownOrchestrator.Add(shared.PhaseStopIngest, "binance websocket")
+	shutdownOrchestrator.Register(shared.PhaseCloseConnections, "redis", func(context.Context) error {
+		return rdb.Close()
+	})
 
 	// fetch data from binance & publish on redis
-	fetchAndPublish("BTCUSDT", shutdownOrchestrator, tradeEvent, errorEvent)
+	RunStreams(quit, streams)
+	done() // tell orchestrator this is done
 }
 
 func tradeEvent(event *binance_connector.WsTradeEvent) {
 	// prepare & update stats
-	tradeInfoAge.Observe(float64(time.Now().UnixMilli() - event.TradeTime))
-	tradesReceived.Inc()
+	shared.ObserveStage("receive", shared.Symbol, shared.TradeResolution, time.UnixMilli(event.TradeTime))
+	tradesReceived.WithLabelValues(shared.Symbol, shared.TradeResolution).Inc()
 	start := time.Now()
+	lastTrade.Beat(start)
+	// the trace of the trade starts here, the consumers continue it from the context in the message
+	traceCtx, span := shared.StartSpan(ctx, "trade", attribute.String("symbol", event.Symbol), attribute.Int64("trade.id", event.TradeID))
+	defer span.End()
+	traceCtx, publishSpan := shared.StartSpan(traceCtx, "publish", attribute.String("channel", shared.RedisChannel))
+
 	// marshal into json
-	data, err := json.Marshal(shared.TradeDatePrice{TradeDate: event.TradeTime, Price: event.Price})
+	data, err := json.Marshal(shared.TradeDatePrice{TradeDate: event.TradeTime, Price: event.Price, Quantity: event.Quantity, Trace: shared.TraceCarrier(traceCtx)})
 	if err != nil {
-		log.Printf("[Warning] Failed marshaling data. Skipping data.\nErr: %v\nData: %v", err, data)
+		shared.EndSpan(publishSpan, err)
+		shared.DroppedTrades.WithLabelValues("marshal", shared.Symbol, shared.TradeResolution).Inc()
+		publishLog.Warn("Failed marshaling the trade, skipping it", "trade_id", event.TradeID, "error", err)
 		return
 	}
 
 	// publish into redis
-	err = rdb.Publish(ctx, shared.RedisChannel, data).Err()
+	err = rdb.Publish(traceCtx, shared.RedisChannel, data).Err()
+	shared.EndSpan(publishSpan, err)
 	if err != nil {
-		log.Println("[Warning] Redis Publish error:", err)
+		shared.DroppedTrades.WithLabelValues("publish", shared.Symbol, shared.TradeResolution).Inc()
+		publishLog.Warn("Redis publish failed", "channel", shared.RedisChannel, "error", err)
 		return
 	}
 	// update stats
-	tradeEventDelay.Observe(float64(time.Since(start).Microseconds()))
-	tradesPublished.Inc()
+	shared.ObserveStage("publish", shared.Symbol, shared.TradeResolution, start)
+	tradesPublished.WithLabelValues(shared.Symbol, shared.TradeResolution).Inc()
 }
 
 func errorEvent(err error) {
-	log.Println("[Warning] Error in Websocket stream:", err)
+	wsLog.Warn("Error in the websocket stream", "error", err)
 }
 
-func fetchAndPublish(exchange string, shutdownOrchestrator *shared.ShutdownOrchestrator, handleTradeEvent func(*binance_connector.WsTradeEvent), handleErrorEvent func(error)) {
-	stop, done := shutdownOrchestrator.Get() // get stop and done signals
-	defer func() { done <- struct{}{} }()    // tell orchestrator this is done
-
-	for { // connection will drop. reconnect when happens
-		log.Println("[Info] Connecting to Binance")
-		// connect to Binance Trade Websocket stream
-		websocketStreamClient := binance_connector.NewWebsocketStreamClient(false)
-		doneCh, stopCh, err := websocketStreamClient.WsTradeServe(exchange, handleTradeEvent, handleErrorEvent)
+// counts a reconnect. reports an incident when the reconnects within the window reach the storm count
+func reconnectEvent() {
+	websocketReconnects.WithLabelValues(shared.Symbol, shared.TradeResolution).Inc()
+	if n := recentReconnects.Add(time.Now()); n == shared.ReconnectStormCount {
+		wsLog.Warn("Reconnect storm", "reconnects", n, "window", shared.ReconnectStormWindow.String())
+		err := shared.PublishIncident(ctx, rdb, shared.Incident{
+			Time:    time.Now(),
+			Kind:    shared.IncidentReconnectStorm,
+			Service: "fetcher",
+			Message: fmt.Sprintf("%v reconnects to Binance in %v", n, shared.ReconnectStormWindow),
+		})
 		if err != nil {
-			log.Println("[Warning] Error while opening Websocket stream:", err)
-			log.Println("[Info] Retrying in:", shared.TimeBeforeReconnect)
-			time.Sleep(shared.TimeBeforeReconnect) // wait before retrying
-			continue                               // retry
-		}
-		log.Println("[Info] Connected to Binance")
-
-		// Wait for the WS stream to close OR quit signal
-		select {
-		case <-doneCh: // Binance is done, but we are not
-			log.Println("[Warning] Binance connection closed, reconnecting in:", shared.TimeBeforeReconnect)
-			time.Sleep(shared.TimeBeforeReconnect)
-			continue // reconnect
-
-		case <-stop: // stop command from shutdown orchestrator
-			log.Println("[Info] Telling Binance to quit.")
-			stopCh <- struct{}{}
-			log.Println("[Info] Waiting for Binance to close connection.")
-
-			// Wait for Binance to close connection OR timeout
-			select {
-			case <-doneCh:
-				log.Println("[Info] Binance connection is closed normally.")
-
-			case <-time.After(shared.TimeoutBeforeReturn):
-				log.Printf("[Warning] Timeout (%v) waiting for Binance to close connection", shared.TimeoutBeforeReturn)
-			}
-			return
+			publishLog.Warn("Redis publish failed", "channel", shared.IncidentChannel, "error", err)
 		}
 	}
 }
+
+// waits for d, false when quit is done first
+func sleep(quit context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-quit.Done():
+		return false
+	}
+}
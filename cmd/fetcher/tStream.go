@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	binance_connector "github.com/binance/binance-connector-go"
+	"github.com/kaanureyen/tradebot/cmd/shared"
+)
+
+// opens a trade stream, as WsTradeServe of the Binance client
+type connectFunc func(symbol string, handler binance_connector.WsTradeHandler, errHandler binance_connector.ErrHandler) (doneCh, stopCh chan struct{}, err error)
+
+func binanceConnect(symbol string, handler binance_connector.WsTradeHandler, errHandler binance_connector.ErrHandler) (chan struct{}, chan struct{}, error) {
+	return binance_connector.NewWebsocketStreamClient(false).WsTradeServe(symbol, handler, errHandler)
+}
+
+// trades of the connections of a symbol, each one handed over once
+type tradeDeduper struct {
+	HandleTrade func(*binance_connector.WsTradeEvent) // called once per trade, in the order of the trade IDs
+
+	mu   sync.Mutex
+	last int64 // highest trade ID handed over
+}
+
+func newTradeDeduper(handleTrade func(*binance_connector.WsTradeEvent)) *tradeDeduper {
+	return &tradeDeduper{HandleTrade: handleTrade, last: -1}
+}
+
+// hands the trade received on the connection over, unless it or a later one was before. true when it was handed over.
+// the trades are handed over one at a time, so a trade is never published after a later one
+func (d *tradeDeduper) Handle(connection string, event *binance_connector.WsTradeEvent) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// published already, or by a faster connection that is ahead
+	if event.TradeID <= d.last {
+		duplicateTrades.WithLabelValues(shared.Symbol, shared.TradeResolution).Inc()
+		return false
+	}
+	d.last = event.TradeID
+	firstDeliveries.WithLabelValues(shared.Symbol, shared.TradeResolution, connection).Inc()
+	d.HandleTrade(event)
+	return true
+}
+
+// trade stream of a symbol that stays connected:
+// reconnects when the connection closes or stays silent for StaleTimeout,
+// and replaces the connection before MaxAge with an overlapping one.
+// the trades of every Stream sharing Trades are published once
+type Stream struct {
+	Symbol       string
+	Name         string // of the connection, to tell the redundant ones apart
+	Connect      connectFunc
+	Trades       *tradeDeduper
+	HandleError  func(error)
+	OnReconnect  func() // called for every reconnect but the rotations
+	StaleTimeout time.Duration
+	MaxAge       time.Duration
+	Overlap      time.Duration
+	Policy       *shared.ReconnectPolicy // when to connect, shared by the streams
+
+	log *slog.Logger
+}
+
+func NewStream(symbol, name string, trades *tradeDeduper, policy *shared.ReconnectPolicy, handleError func(error), onReconnect func()) *Stream {
+	s := &Stream{
+		Symbol:       symbol,
+		Name:         name,
+		Connect:      binanceConnect,
+		Trades:       trades,
+		HandleError:  handleError,
+		OnReconnect:  onReconnect,
+		StaleTimeout: shared.StaleFeedTimeout,
+		MaxAge:       shared.MaxConnectionAge,
+		Overlap:      shared.ConnectionOverlap,
+		Policy:       policy,
+	}
+	s.log = wsLog.With("connection", name)
+	shared.EnvDuration("STALE_FEED_TIMEOUT", &s.StaleTimeout)
+	shared.EnvDuration("MAX_CONNECTION_AGE", &s.MaxAge)
+	// a shorter timeout reconnects a healthy feed over the gaps between its trades,
+	// and a zero or negative one would panic the watchdog ticking every StaleTimeout/4.
+	// a connection must outlive its overlap
+	if s.StaleTimeout < shared.MinStaleFeedTimeout {
+		s.log.Warn("STALE_FEED_TIMEOUT is too short, using the default", "value", s.StaleTimeout.String(), "min", shared.MinStaleFeedTimeout.String(), "default", shared.StaleFeedTimeout.String())
+		s.StaleTimeout = shared.StaleFeedTimeout
+	}
+	if s.MaxAge <= s.Overlap {
+		s.log.Warn("MAX_CONNECTION_AGE must be longer than the overlap, using the default", "value", s.MaxAge.String(), "overlap", s.Overlap.String(), "default", shared.MaxConnectionAge.String())
+		s.MaxAge = shared.MaxConnectionAge
+	}
+	return s
+}
+
+// streams of FEED_CONNECTIONS independent connections, their trades are deduplicated
+func NewStreams(symbol string, handleTrade func(*binance_connector.WsTradeEvent), handleError func(error), onReconnect func()) []*Stream {
+	n := shared.FeedConnectionsFromEnv()
+	trades := newTradeDeduper(handleTrade)
+	policy := shared.NewReconnectPolicy()
+	var streams []*Stream
+	for i := range n {
+		streams = append(streams, NewStream(symbol, strconv.Itoa(i), trades, policy, handleError, onReconnect))
+	}
+	return streams
+}
+
+// runs the streams until quit is done
+func RunStreams(quit context.Context, streams []*Stream) {
+	var wg sync.WaitGroup
+	for _, s := range streams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Run(quit)
+		}()
+	}
+	wg.Wait()
+}
+
+// an open websocket connection
+type connection struct {
+	doneCh, stopCh chan struct{}
+	opened         time.Time
+	lastEvent      shared.Heartbeat
+	stopped        atomic.Bool // the Binance client keeps reading after a stop, its events are ignored
+	log            *slog.Logger
+}
+
+// silence of the connection, since its last trade or its opening
+func (c *connection) silence(now time.Time) time.Duration {
+	last := c.lastEvent.Last()
+	if last.Before(c.opened) {
+		last = c.opened
+	}
+	return now.Sub(last)
+}
+
+// asks the connection to stop, waits for it to close up to timeout
+func (c *connection) stop(timeout time.Duration) {
+	c.stopped.Store(true)
+	select {
+	case c.stopCh <- struct{}{}:
+	case <-c.doneCh: // closed already
+		return
+	}
+	select {
+	case <-c.doneCh:
+	case <-time.After(timeout):
+		c.log.Warn("Timeout waiting for Binance to close the connection", "timeout", timeout.String())
+	}
+}
+
+func (s *Stream) connect() (*connection, error) {
+	c := &connection{opened: time.Now(), log: s.log}
+	handler := func(event *binance_connector.WsTradeEvent) {
+		if c.stopped.Load() {
+			return
+		}
+		c.lastEvent.Beat(time.Now())
+		s.Trades.Handle(s.Name, event)
+	}
+	var err error
+	c.doneCh, c.stopCh, err = s.Connect(s.Symbol, handler, s.HandleError)
+	return c, err
+}
+
+// connects when the Policy allows, until it succeeds. nil when quit is done first
+func (s *Stream) dial(quit context.Context) *connection {
+	for {
+		if d := s.Policy.Delay(time.Now()); d > 0 {
+			s.log.Info("Waiting before connecting", "retry_in", d.Round(time.Millisecond).String(), "circuit", s.Policy.Status(time.Now()).State)
+		}
+		if !s.Policy.Wait(quit) {
+			return nil
+		}
+		s.log.Info("Connecting to Binance")
+		c, err := s.connect()
+		if err == nil {
+			s.Policy.Success()
+			s.log.Info("Connected to Binance")
+			return c
+		}
+		s.Policy.Failure(time.Now())
+		s.log.Warn("Error while opening the websocket stream", "error", err)
+		s.OnReconnect()
+	}
+}
+
+// streams the trades until quit is done
+func (s *Stream) Run(quit context.Context) {
+	watchdog := time.NewTicker(s.StaleTimeout / 4)
+	defer watchdog.Stop()
+	for {
+		conn := s.dial(quit)
+		if conn == nil {
+			return
+		}
+		rotate := time.NewTimer(s.MaxAge)
+	watch:
+		for {
+			select {
+			case <-conn.doneCh: // Binance is done, but we are not
+				s.log.Warn("Binance connection closed", "lived", time.Since(conn.opened).Round(time.Second).String())
+				rotate.Stop()
+				s.Policy.Closed(time.Now(), time.Since(conn.opened))
+				s.OnReconnect()
+				break watch
+
+			case now := <-watchdog.C: // open but silent
+				if silence := conn.silence(now); silence > s.StaleTimeout {
+					s.log.Warn("No trade on the open connection, reconnecting", "silence", silence.Round(time.Second).String(), "limit", s.StaleTimeout.String())
+					rotate.Stop()
+					staleReconnects.WithLabelValues(shared.Symbol, shared.TradeResolution).Inc()
+					s.OnReconnect()
+					conn.stop(shared.TimeoutBeforeReturn)
+					s.Policy.Closed(now, now.Sub(conn.opened))
+					break watch
+				}
+
+			case <-rotate.C: // before the connection limit of Binance, the new connection streams before the old one stops
+				if d := s.Policy.Reserve(time.Now()); d > 0 {
+					rotate.Reset(d)
+					continue
+				}
+				s.log.Info("Replacing the connection before its age limit", "age", time.Since(conn.opened).Round(time.Second).String())
+				next, err := s.connect()
+				if err != nil {
+					s.Policy.Failure(time.Now())
+					s.log.Warn("Error while opening the replacing connection", "error", err)
+					rotate.Reset(s.Policy.Delay(time.Now()))
+					continue
+				}
+				s.Policy.Success()
+				if !sleep(quit, s.Overlap) {
+					next.stop(shared.TimeoutBeforeReturn)
+					conn.stop(shared.TimeoutBeforeReturn)
+					return
+				}
+				conn.stop(shared.TimeoutBeforeReturn)
+				conn = next
+				rotate.Reset(s.MaxAge)
+				connectionRotations.WithLabelValues(shared.Symbol, shared.TradeResolution).Inc()
+
+			case <-quit.Done(): // stop command from shutdown orchestrator
+				s.log.Info("Telling Binance to quit, waiting for it to close the connection")
+				rotate.Stop()
+				conn.stop(shared.TimeoutBeforeReturn)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kaanureyen/tradebot/cmd/shared"
+)
+
+func main() {
+	addr := flag.String("addr", ":8090", "address of the Binance compatible REST API")
+	symbol := flag.String("symbol", "BTCUSDT", "symbol of the replayed trades")
+	usdt := flag.Float64("usdt", 1000, "starting USDT balance")
+	btc := flag.Float64("btc", 0, "starting BTC balance")
+	replay := flag.String("replay", "", "JSON lines file of TradeDatePrice to replay instead of the live trades from Redis")
+	speed := flag.Float64("speed", 1, "replay speed multiplier. 0 replays as fast as possible")
+	latency := flag.Duration("latency", 0, "orders become active this long after they are placed")
+	participation := flag.Float64("participation", 0, "upper limit of fills as a fraction of the trade quantity. 0 for no limit")
+	flag.Parse()
+
+	shutdownOrchestrator, admin := shared.InitCommon("mockexchange") // set logger name, start admin server, initialize & start shutdownOrchestrator
+	defer func() {
+		<-shutdownOrchestrator.Done // closed once every phase of the shutdown finished or timed out, after a interrupt/terminate signal.
+		log.Println("[Info] Exiting...")
+	}()
+
+	flag.VisitAll(func(f *flag.Flag) {
+		admin.SetConfig(f.Name, f.Value.String())
+	})
+
+	exchange := shared.NewMockExchange(map[string]float64{"USDT": *usdt, "BTC": *btc})
+	exchange.Latency = *latency
+	exchange.MaxParticipation = *participation
+
+	go func() {
+		log.Println("[Info] Mock exchange listening on", *addr)
+		log.Fatal("[Fatal][Error] Mock exchange endpoint could not be opened. Error: ", http.ListenAndServe(*addr, exchange))
+	}()
+
+	stop := shutdownOrchestrator.Context(shared.PhaseStopIngest, "trades")
+	_, finished := shutdownOrchestrator.Add(shared.PhaseDrainPipeline, "matching")
+	var trades chan shared.TradeDatePrice
+	if *replay != "" {
+		log.Println("[Info] Replaying trades from", *replay)
+		trades = replayFile(*replay, *speed, stop)
+	} else {
+		log.Println("[Info] Matching orders against live trades from Redis")
+		trades = shared.UnmarshalTradeDatePrice(shared.SubscribeRedis(stop, shared.RedisChannel))
+		shared.Health.AddReadiness("trade_subscription", shared.SubscriptionCheck(shared.RedisChannel))
+	}
+
+	for v := range trades {
+		p, err := strconv.ParseFloat(v.Price, 64)
+		if err != nil {
+			log.Println("[Warning] while parsing price as float. Skipping the data. Error:: ", err)
+			continue
+		}
+		q, _ := strconv.ParseFloat(v.Quantity, 64) // optional, 0 means unknown
+		exchange.OnTrade(*symbol, time.UnixMilli(v.TradeDate), p, q)
+	}
+	finished()
+}
+
+// sends the trades of a JSON lines file, keeping their time differences divided by speed.
+// the channel is closed when stop is done, also after the end of the file.
+func replayFile(path string, speed float64, stop context.Context) chan shared.TradeDatePrice {
+	out := make(chan shared.TradeDatePrice)
+	go func() {
+		defer close(out)
+		f, err := os.Open(path)
+		if err != nil {
+			log.Printf("[Error] Cannot open replay file: %v\n", err)
+			<-stop.Done()
+			return
+		}
+		defer f.Close()
+
+		var last int64
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var v shared.TradeDatePrice
+			if err := json.Unmarshal(scanner.Bytes(), &v); err != nil {
+				log.Println("[Warning] Failed to unmarshal to TradeDatePrice. Skipping the data. Error::", err)
+				continue
+			}
+			var wait <-chan time.Time
+			if speed > 0 && last != 0 && v.TradeDate > last {
+				wait = time.After(time.Duration(float64(time.Duration(v.TradeDate-last)*time.Millisecond) / speed))
+			} else {
+				ch := make(chan time.Time, 1)
+				ch <- time.Time{}
+				wait = ch
+			}
+			select {
+			case <-wait:
+			case <-stop.Done():
+				return
+			}
+			last = v.TradeDate
+			select {
+			case out <- v:
+			case <-stop.Done():
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			log.Printf("[Error] Cannot read replay file: %v\n", err)
+		}
+		log.Println("[Info] Replay finished")
+		<-stop.Done()
+	}()
+	return out
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplayFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trades.jsonl")
+	data := `{"TradeDate":1000,"Price":"100","Quantity":"1"}
+not json
+{"TradeDate":2000,"Price":"101"}
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stop, cancel := context.WithCancel(context.Background())
+	trades := replayFile(path, 0, stop)
+	first, second := <-trades, <-trades
+	if first.Price != "100" || first.Quantity != "1" || second.TradeDate != 2000 {
+		t.Errorf("got %+v, %+v; want the two valid trades", first, second)
+	}
+	cancel()
+	if _, ok := <-trades; ok {
+		t.Errorf("channel not closed after stop")
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/kaanureyen/tradebot/cmd/shared"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// prometheus metrics
+var notificationsSent = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "notifications_sent_total",
+		Help: "Chat notifications by sink and result",
+	},
+	[]string{"sink", "result"},
+)
+
+func main() {
+	shutdownOrchestrator, admin := shared.InitCommon("notifier") // set logger name, start admin server, initialize & start shutdownOrchestrator
+	defer func() {
+		<-shutdownOrchestrator.Done // closed once every phase of the shutdown finished or timed out, after a interrupt/terminate signal.
+		log.Println("[Info] Exiting...")
+	}()
+
+	// register the prometheus metrics
+	prometheus.MustRegister(notificationsSent)
+
+	notifier, err := NotifierFromEnv()
+	if err != nil {
+		log.Fatalf("[Fatal][Error] Invalid notifier configuration: %v\n", err)
+	}
+	notifier.OnResult = func(sink string, err error) {
+		if err != nil {
+			log.Printf("[Warning] Notification to %v failed: %v\n", sink, err)
+			notificationsSent.WithLabelValues(sink, "error").Inc()
+			return
+		}
+		notificationsSent.WithLabelValues(sink, "ok").Inc()
+	}
+	sinks := []string{}
+	for _, s := range notifier.Sinks {
+		sinks = append(sinks, s.Name())
+	}
+	admin.SetConfig("sinks", sinks) // names only, the URLs and tokens are secrets
+	if len(notifier.Sinks) == 0 {
+		log.Println("[Warning] No chat sink configured, notifications are only logged")
+	}
+
+	// signals of the aggregator and incidents of the other services
+	log.Println("[Info] Start reading signals and incidents from Redis")
+	signals := shared.SubscribeRedis(shutdownOrchestrator.Context(shared.PhaseStopIngest, "signal subscription"), shared.SignalChannel)
+	incidents := shared.SubscribeRedis(shutdownOrchestrator.Context(shared.PhaseStopIngest, "incident subscription"), shared.IncidentChannel)
+	shared.Health.AddReadiness("signal_subscription", shared.SubscriptionCheck(shared.SignalChannel))
+	shared.Health.AddReadiness("incident_subscription", shared.SubscriptionCheck(shared.IncidentChannel))
+	// the messages read before the shutdown are still sent
+	_, finished := shutdownOrchestrator.Add(shared.PhaseDrainPipeline, "notifications")
+
+	ctx := context.Background()
+	for signals != nil || incidents != nil {
+		select {
+		case msg, ok := <-signals:
+			if !ok {
+				signals = nil
+				continue
+			}
+			var s shared.TradeSignal
+			if err := json.Unmarshal([]byte(msg), &s); err != nil {
+				log.Println("[Warning] Failed to unmarshal to TradeSignal. Skipping the data. Error::", err)
+				continue
+			}
+			log.Printf("[Info] Signal %v at %v\n", s.Signal, s.Price)
+			notifier.NotifySignal(ctx, s)
+
+		case msg, ok := <-incidents:
+			if !ok {
+				incidents = nil
+				continue
+			}
+			var i shared.Incident
+			if err := json.Unmarshal([]byte(msg), &i); err != nil {
+				log.Println("[Warning] Failed to unmarshal to Incident. Skipping the data. Error::", err)
+				continue
+			}
+			log.Printf("[Info] Incident %v from %v: %v\n", i.Kind, i.Service, i.Message)
+			notifier.NotifyIncident(ctx, i)
+		}
+	}
+	finished()
+}
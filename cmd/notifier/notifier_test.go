@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kaanureyen/tradebot/cmd/shared"
+)
+
+// local stand-in of the chat APIs, records the JSON bodies by path
+func chatStandIn(t *testing.T) (*httptest.Server, map[string]map[string]string) {
+	received := map[string]map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("invalid JSON body: %v", err)
+		}
+		received[r.URL.Path] = body
+		if r.URL.Path == "/failing" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	return server, received
+}
+
+func TestNotifier(t *testing.T) {
+	server, received := chatStandIn(t)
+	defer server.Close()
+	t.Setenv("NOTIFY_SLACK_WEBHOOK", server.URL+"/slack")
+	t.Setenv("NOTIFY_DISCORD_WEBHOOK", server.URL+"/discord")
+	t.Setenv("NOTIFY_TELEGRAM_TOKEN", "123:abc")
+	t.Setenv("NOTIFY_TELEGRAM_CHAT_ID", "42")
+	t.Setenv("NOTIFY_TELEGRAM_API", server.URL+"/")
+	t.Setenv("NOTIFY_CHART_URL", "http://chart")
+
+	n, err := NotifierFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signal := shared.TradeSignal{TimeStamp: time.Now(), Signal: "BUY", Price: 100000.5, Sma50: 99000, Sma200: 98000.25, Reason: shared.ExitReasonCrossover}
+	if err := n.NotifySignal(context.Background(), signal); err != nil {
+		t.Fatalf("notify failed: %v", err)
+	}
+
+	want := "BUY BTCUSDT at 100000.50 (crossover)\nSMA short 99000.00 / SMA long 98000.25\nhttp://chart"
+	if got := received["/slack"]["text"]; got != want {
+		t.Errorf("slack: got %q; want %q", got, want)
+	}
+	if got := received["/discord"]["content"]; got != want {
+		t.Errorf("discord: got %q; want %q", got, want)
+	}
+	if got := received["/bot123:abc/sendMessage"]; got["text"] != want || got["chat_id"] != "42" {
+		t.Errorf("telegram: got %v; want text %q to chat 42", got, want)
+	}
+
+	incident := shared.Incident{Kind: shared.IncidentReconnectStorm, Service: "fetcher", Message: "5 reconnects"}
+	n.NotifyIncident(context.Background(), incident)
+	if got := received["/slack"]["text"]; !strings.HasPrefix(got, "[fetcher] reconnect_storm: 5 reconnects") {
+		t.Errorf("slack: got %q; want the incident", got)
+	}
+}
+
+func TestNotifierFailingSink(t *testing.T) {
+	server, _ := chatStandIn(t)
+	defer server.Close()
+	t.Setenv("NOTIFY_DISCORD_WEBHOOK", server.URL+"/failing")
+	t.Setenv("NOTIFY_SIGNAL_TEMPLATE", "{{.Signal}} {{.Price}}")
+
+	n, err := NotifierFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := map[string]error{}
+	n.OnResult = func(sink string, err error) { results[sink] = err }
+	if err := n.NotifySignal(context.Background(), shared.TradeSignal{Signal: "SELL", Price: 1}); err == nil {
+		t.Errorf("got no error from the failing sink")
+	}
+	if results["discord"] == nil {
+		t.Errorf("got results %v; want an error for discord", results)
+	}
+
+	t.Setenv("NOTIFY_SIGNAL_TEMPLATE", "{{.Signal")
+	if _, err := NotifierFromEnv(); err == nil {
+		t.Errorf("invalid template: got no error")
+	}
+}
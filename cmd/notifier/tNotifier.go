@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/kaanureyen/tradebot/cmd/shared"
+)
+
+const (
+	defaultSignalTemplate = `{{.Signal}} BTCUSDT at {{printf "%.2f" .Price}}{{if .Reason}} ({{.Reason}}){{end}}
+SMA short {{printf "%.2f" .Sma50}} / SMA long {{printf "%.2f" .Sma200}}
+{{.ChartURL}}`
+	defaultIncidentTemplate = `[{{.Service}}] {{.Kind}}: {{.Message}}
+{{.ChartURL}}`
+	defaultChartURL    = "http://localhost:3000/d/bd94b057-3c92-42d1-8346-eb5ecac31489/services"
+	defaultTelegramAPI = "https://api.telegram.org"
+)
+
+// chat destination of the messages
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, text string) error
+}
+
+// Slack incoming webhook
+type SlackSink struct {
+	URL string
+}
+
+func (s SlackSink) Name() string { return "slack" }
+
+func (s SlackSink) Send(ctx context.Context, text string) error {
+	return postJSON(ctx, s.URL, map[string]string{"text": text})
+}
+
+// Discord webhook, or any webhook taking {"content": text}
+type DiscordSink struct {
+	URL string
+}
+
+func (s DiscordSink) Name() string { return "discord" }
+
+func (s DiscordSink) Send(ctx context.Context, text string) error {
+	return postJSON(ctx, s.URL, map[string]string{"content": text})
+}
+
+// Telegram bot sendMessage. APIURL can point to a stand-in.
+type TelegramSink struct {
+	APIURL string
+	Token  string
+	ChatID string
+}
+
+func (s TelegramSink) Name() string { return "telegram" }
+
+func (s TelegramSink) Send(ctx context.Context, text string) error {
+	return postJSON(ctx, s.APIURL+"/bot"+s.Token+"/sendMessage", map[string]string{"chat_id": s.ChatID, "text": text})
+}
+
+func postJSON(ctx context.Context, url string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("status %v", res.Status)
+	}
+	return nil
+}
+
+// renders signals and incidents with templates and sends them to every sink
+type Notifier struct {
+	Sinks    []Sink
+	Signal   *template.Template // executed with signalMessage
+	Incident *template.Template // executed with incidentMessage
+	ChartURL string
+	OnResult func(sink string, err error) // optional, called after each send
+}
+
+type signalMessage struct {
+	shared.TradeSignal
+	ChartURL string
+}
+
+type incidentMessage struct {
+	shared.Incident
+	ChartURL string
+}
+
+// sinks of NOTIFY_SLACK_WEBHOOK, NOTIFY_DISCORD_WEBHOOK and NOTIFY_TELEGRAM_TOKEN with NOTIFY_TELEGRAM_CHAT_ID
+// (NOTIFY_TELEGRAM_API for another API URL), templates of NOTIFY_SIGNAL_TEMPLATE and NOTIFY_INCIDENT_TEMPLATE,
+// chart link of NOTIFY_CHART_URL
+func NotifierFromEnv() (*Notifier, error) {
+	n := &Notifier{ChartURL: envOr("NOTIFY_CHART_URL", defaultChartURL)}
+	if u := os.Getenv("NOTIFY_SLACK_WEBHOOK"); u != "" {
+		n.Sinks = append(n.Sinks, SlackSink{URL: u})
+	}
+	if u := os.Getenv("NOTIFY_DISCORD_WEBHOOK"); u != "" {
+		n.Sinks = append(n.Sinks, DiscordSink{URL: u})
+	}
+	if token := os.Getenv("NOTIFY_TELEGRAM_TOKEN"); token != "" {
+		n.Sinks = append(n.Sinks, TelegramSink{
+			APIURL: strings.TrimSuffix(envOr("NOTIFY_TELEGRAM_API", defaultTelegramAPI), "/"),
+			Token:  token,
+			ChatID: os.Getenv("NOTIFY_TELEGRAM_CHAT_ID"),
+		})
+	}
+	var err error
+	if n.Signal, err = template.New("signal").Parse(envOr("NOTIFY_SIGNAL_TEMPLATE", defaultSignalTemplate)); err != nil {
+		return nil, fmt.Errorf("signal template: %w", err)
+	}
+	if n.Incident, err = template.New("incident").Parse(envOr("NOTIFY_INCIDENT_TEMPLATE", defaultIncidentTemplate)); err != nil {
+		return nil, fmt.Errorf("incident template: %w", err)
+	}
+	return n, nil
+}
+
+func (n *Notifier) NotifySignal(ctx context.Context, s shared.TradeSignal) error {
+	return n.send(ctx, n.Signal, signalMessage{TradeSignal: s, ChartURL: n.ChartURL})
+}
+
+func (n *Notifier) NotifyIncident(ctx context.Context, i shared.Incident) error {
+	return n.send(ctx, n.Incident, incidentMessage{Incident: i, ChartURL: n.ChartURL})
+}
+
+// sends to all sinks, returns the last error
+func (n *Notifier) send(ctx context.Context, t *template.Template, data any) error {
+	var text bytes.Buffer
+	if err := t.Execute(&text, data); err != nil {
+		return err
+	}
+	var lastErr error
+	for _, sink := range n.Sinks {
+		err := sink.Send(ctx, strings.TrimSpace(text.String()))
+		if err != nil {
+			lastErr = fmt.Errorf("%v: %w", sink.Name(), err)
+		}
+		if n.OnResult != nil {
+			n.OnResult(sink.Name(), err)
+		}
+	}
+	return lastErr
+}
+
+func envOr(name string, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
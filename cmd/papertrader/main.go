@@ -0,0 +1,469 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kaanureyen/tradebot/cmd/shared"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// prometheus metrics
+var paperEquity = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "papertrader_equity_usdt",
+		Help: "Paper account equity in USDT at the last trade price",
+	},
+)
+var paperBalance = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "papertrader_balance_usdt",
+		Help: "Paper account USDT balance",
+	},
+)
+var paperPosition = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "papertrader_position_btc",
+		Help: "Paper account BTC position, negative while short",
+	},
+)
+var paperRealizedPnl = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "papertrader_realized_pnl_usdt",
+		Help: "Profit of the closed paper trades in USDT",
+	},
+)
+var paperUnrealizedPnl = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "papertrader_unrealized_pnl_usdt",
+		Help: "Profit of the open paper position in USDT at the last trade price",
+	},
+)
+var paperFills = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "papertrader_fills_total",
+		Help: "Paper order fills",
+	},
+)
+var paperSignals = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "papertrader_signals_total",
+		Help: "Trade signals acted on",
+	},
+)
+var paperBlockedSignals = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "papertrader_blocked_signals_total",
+		Help: "Trade signals whose entry was blocked by the risk limits, by reason",
+	},
+	[]string{"reason"},
+)
+var paperReconcileMismatches = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "papertrader_reconciliation_mismatches_total",
+		Help: "Differences between the stored orders and wallet and the executor found at startup",
+	},
+)
+var paperKillSwitch = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "papertrader_kill_switch",
+		Help: "1 while entries are stopped by the kill switch or the drawdown cutoff",
+	},
+)
+
+func main() {
+	shutdownOrchestrator, admin := shared.InitCommon("papertrader") // set logger name, start admin server, initialize & start shutdownOrchestrator
+	defer func() {
+		<-shutdownOrchestrator.Done // closed once every phase of the shutdown finished or timed out, after a interrupt/terminate signal.
+		log.Println("[Info] Exiting...")
+	}()
+
+	// register the prometheus metrics
+	prometheus.MustRegister(paperEquity)
+	prometheus.MustRegister(paperBalance)
+	prometheus.MustRegister(paperPosition)
+	prometheus.MustRegister(paperRealizedPnl)
+	prometheus.MustRegister(paperUnrealizedPnl)
+	prometheus.MustRegister(paperFills)
+	prometheus.MustRegister(paperSignals)
+	prometheus.MustRegister(paperBlockedSignals)
+	prometheus.MustRegister(paperKillSwitch)
+	prometheus.MustRegister(paperReconcileMismatches)
+
+	// connect to MongoDB
+	client, ctx := shared.MongoConnect()
+	shutdownOrchestrator.Register(shared.PhaseCloseConnections, "mongodb", client.Disconnect)
+
+	collAccount := shared.MongoPaperAccountCollection(client, ctx)
+	collPaperTrade := shared.MongoPaperTradeCollection(client, ctx)
+	collAggr := shared.MongoAggregateCollection(client, ctx)
+	collTrade := shared.MongoTradeCollection(client, ctx)
+	collBlocked := shared.MongoBlockedSignalCollection(client, ctx)
+
+	// strategy parameters. paper orders are filled against the live trades, market orders by default
+	params := shared.StrategyParamsFromEnv()
+	if params.Orders.EntryType == "" {
+		params.Orders.EntryType = shared.OrderTypeMarket
+	}
+	usdt := 1000.0
+	if v, err := strconv.ParseFloat(os.Getenv("PAPER_USDT"), 64); err == nil {
+		usdt = v
+	}
+
+	admin.SetConfig("strategy", params)
+	admin.SetConfig("paper_usdt", usdt)
+	admin.SetConfig("executor", os.Getenv("EXECUTOR"))
+
+	account, err := LoadAccount(collAccount, shared.PaperAccountID, params, usdt)
+	if err != nil {
+		log.Fatalf("[Fatal][Error] Cannot load paper account: %v\n", err)
+	}
+	trader := &account.Trader
+
+	// orders go to an exchange instead of the local fill engine when EXECUTOR is set
+	switch executor := os.Getenv("EXECUTOR"); executor {
+	case "":
+	case "binance":
+		baseURL := os.Getenv("BINANCE_BASE_URL")
+		if baseURL == "" {
+			baseURL = shared.MockExchangeURL
+		}
+		log.Println("[Info] Placing orders on", baseURL)
+		admin.SetConfig("binance_base_url", shared.RedactURI(baseURL))
+		trader.Executor = shared.NewBinanceExecutor(os.Getenv("BINANCE_API_KEY"), os.Getenv("BINANCE_SECRET_KEY"), baseURL)
+		trader.Symbol = shared.PaperAccountID
+		trader.Store = &shared.MongoOrderStore{Collection: shared.MongoOrderCollection(client, ctx), Account: account.ID}
+	default:
+		log.Fatalf("[Fatal][Error] Unknown EXECUTOR: %v\n", executor)
+	}
+
+	// orders in flight before a restart
+	mismatches, err := shared.Reconcile(context.Background(), trader, time.Now())
+	if err != nil {
+		log.Printf("[Error] Reconciliation with the executor failed: %v\n", err)
+	}
+	for _, m := range mismatches {
+		log.Printf("[Error] Reconciliation mismatch: %v\n", m)
+		paperReconcileMismatches.Inc()
+	}
+	save(account, collAccount, collPaperTrade)
+
+	// ATR for the sizer from the stored bars
+	atr := shared.Atr{}
+	atr.Init(max(params.Sizing.AtrPeriod, 1))
+	for _, v := range loadBarsSince(collAggr, time.Time{}, int64(params.Sizing.AtrPeriod+1)) {
+		atr.Add(v.MaxPrice, v.MinPrice, v.LastPrice)
+		account.LastBarTime = v.LastTime
+	}
+	trader.Atr = atr.Value()
+
+	// start read from Redis
+	log.Println("[Info] Start paper trading on live trades from Redis")
+	stop := shutdownOrchestrator.Context(shared.PhaseStopIngest, "trade subscription")
+	trades := shared.UnmarshalTradeDatePrice(shared.SubscribeRedis(stop, shared.RedisChannel))
+	// signals are acted on as they are published, the DB is polled for the missed ones
+	stopSignals := shutdownOrchestrator.Context(shared.PhaseStopIngest, "signal subscription")
+	signals := shared.SubscribeRedis(stopSignals, shared.SignalChannel)
+	// the account is saved once the trades read before the shutdown are processed
+	_, finished := shutdownOrchestrator.Add(shared.PhaseDrainPipeline, "paper trading")
+
+	ticker := time.NewTicker(shared.PaperPollInterval)
+	defer ticker.Stop()
+
+	// kill switch requests are applied by the loop below, which owns the trader
+	commands := make(chan func())
+	loopDone := make(chan struct{}) // closed when the loop returns, the requests stop waiting for it
+	defer close(loopDone)
+	admin.HandleFunc("/killswitch", killSwitchHandler(trader, commands, loopDone))
+
+	// alerts of the paper account writes, for deployments without Prometheus
+	alerts := shared.NewAlertEvaluator("papertrader")
+	mongoErrors := &shared.Increase{Window: 5 * time.Minute}
+	alerts.Add(shared.AlertMongoWriteFailures, func(now time.Time) bool {
+		n, _ := mongoErrors.Add(now, shared.CounterSum(shared.MongoWriteErrors))
+		return n > 0
+	})
+	admin.Handle("GET /alerts", alerts)
+	alerts.Start(shutdownOrchestrator)
+
+	// risk limit breaches are reported to the notifier
+	rdb := redis.NewClient(&redis.Options{
+		Addr: shared.RedisAddress,
+	})
+	shutdownOrchestrator.Register(shared.PhaseCloseConnections, "redis", func(context.Context) error {
+		return rdb.Close()
+	})
+
+	// health checks
+	var lastTrade shared.Heartbeat
+	shared.Health.AddReadiness("redis", shared.RedisCheck(rdb))
+	shared.Health.AddReadiness("mongodb", shared.MongoCheck(client))
+	shared.Health.AddReadiness("trade_subscription", shared.SubscriptionCheck(shared.RedisChannel))
+	shared.Health.AddReadiness("signal_subscription", shared.SubscriptionCheck(shared.SignalChannel))
+	shared.Health.AddReadiness("last_trade", lastTrade.Check("trade", shared.ReadyMaxTradeAge))
+	reportRiskBreach := func(message string, details map[string]string) {
+		err := shared.PublishIncident(context.Background(), rdb, shared.Incident{
+			Time:    time.Now(),
+			Kind:    shared.IncidentRiskBreach,
+			Service: "papertrader",
+			Message: message,
+			Details: details,
+		})
+		if err != nil {
+			log.Println("[Warning] Redis Publish error:", err)
+		}
+	}
+	killed := trader.Risk.Killed
+	watchKillSwitch := func() {
+		if trader.Risk.Killed && !killed {
+			reportRiskBreach("Entries stopped: "+trader.Risk.KillReason, map[string]string{"reason": trader.Risk.KillReason})
+		}
+		killed = trader.Risk.Killed
+		paperKillSwitch.Set(boolToFloat(killed))
+	}
+
+	onSignal := func(s shared.TradeSignal) {
+		if !account.MarkSignal(s) {
+			return // already processed
+		}
+		if s.Reason != "" && s.Reason != shared.ExitReasonCrossover {
+			return // protective exits of the aggregator, the paper trader applies its own
+		}
+		log.Printf("[Info] Signal %v at %v\n", s.Signal, s.Price)
+		paperSignals.Inc()
+		if s.CloseOnly {
+			trader.OnCloseSignal(s.Signal, s.Price, time.Now())
+			return
+		}
+		if rejection := trader.OnSignal(s.Signal, s.Price, time.Now()); rejection != "" {
+			log.Printf("[Warning] Entry of signal %v at %v blocked: %v\n", s.Signal, s.Price, rejection)
+			paperBlockedSignals.WithLabelValues(rejection).Inc()
+			reportRiskBreach(fmt.Sprintf("%v signal at %.2f blocked: %v", s.Signal, s.Price, rejection), map[string]string{"reason": rejection})
+			blocked := shared.BlockedSignal{TradeSignal: s, Rejection: rejection, Account: account.ID}
+			if _, err := collBlocked.InsertOne(context.Background(), blocked); err != nil {
+				shared.MongoWriteErrors.WithLabelValues(collBlocked.Name(), shared.Symbol, shared.AggregatePeriod.String()).Inc()
+				log.Printf("[Error] Failed to insert to MongoDB: %v\n", err)
+			}
+		}
+	}
+
+	lastPrice := math.NaN()
+	for {
+		select {
+		case v, ok := <-trades:
+			if !ok {
+				save(account, collAccount, collPaperTrade)
+				finished()
+				return
+			}
+			lastTrade.Beat(time.Now())
+			p, err := strconv.ParseFloat(v.Price, 64)
+			if err != nil {
+				log.Println("[Warning] while parsing price as float. Skipping the data. Error:: ", err)
+				continue
+			}
+			q, _ := strconv.ParseFloat(v.Quantity, 64) // optional, 0 means unknown
+			lastPrice = p
+
+			fills := trader.NumFills
+			trader.OnTrade(time.UnixMilli(v.TradeDate), p, q)
+			watchKillSwitch()
+			if trader.NumFills != fills {
+				paperFills.Add(float64(trader.NumFills - fills))
+				log.Printf("[Info] Paper fill at %v. Wallet: %+v\n", p, trader.Wallet)
+				save(account, collAccount, collPaperTrade)
+			}
+
+		case msg, ok := <-signals:
+			if !ok {
+				signals = nil // stopped, reported when the trades stop
+				continue
+			}
+			var s shared.TradeSignal
+			if err := json.Unmarshal([]byte(msg), &s); err != nil {
+				log.Println("[Warning] Failed to unmarshal to TradeSignal. Skipping the data. Error::", err)
+				continue
+			}
+			onSignal(s)
+			save(account, collAccount, collPaperTrade)
+
+		case command := <-commands:
+			command()
+			watchKillSwitch()
+			save(account, collAccount, collPaperTrade)
+
+		case <-ticker.C:
+			// fills of the orders on the exchange
+			fills := trader.NumFills
+			if err := trader.SyncOrders(context.Background(), time.Now()); err != nil {
+				log.Printf("[Error] Cannot query orders: %v\n", err)
+			}
+			if trader.NumFills != fills {
+				paperFills.Add(float64(trader.NumFills - fills))
+				log.Printf("[Info] Exchange fill. Wallet: %+v\n", trader.Wallet)
+			}
+
+			// new bars update the ATR of the sizer
+			for _, v := range loadBarsSince(collAggr, account.LastBarTime, 0) {
+				atr.Add(v.MaxPrice, v.MinPrice, v.LastPrice)
+				account.LastBarTime = v.LastTime
+			}
+			trader.Atr = atr.Value()
+
+			// new signals
+			for _, s := range loadSignalsSince(collTrade, account.LastSignalTime) {
+				onSignal(s)
+			}
+			save(account, collAccount, collPaperTrade)
+
+			watchKillSwitch()
+			if !math.IsNaN(lastPrice) {
+				paperEquity.Set(trader.Wallet.Equity(lastPrice))
+				paperUnrealizedPnl.Set(trader.UnrealizedPnL(lastPrice))
+			}
+		}
+	}
+}
+
+// GET reports the kill switch, POST ?engage=true stops the entries, POST ?engage=false resumes them.
+// commands are run by the trading loop, 503 when it has stopped or the request is canceled first.
+func killSwitchHandler(trader *shared.Trader, commands chan<- func(), loopDone <-chan struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			engage, err := strconv.ParseBool(r.URL.Query().Get("engage"))
+			if err != nil {
+				http.Error(w, "engage must be true or false", http.StatusBadRequest)
+				return
+			}
+			ok := runCommand(r.Context(), commands, loopDone, func() {
+				if engage {
+					log.Println("[Warning] Kill switch engaged")
+					trader.Kill(shared.RiskRejectKillSwitch, time.Now())
+				} else {
+					log.Println("[Info] Kill switch released")
+					trader.Risk.Resume()
+				}
+			})
+			if !ok {
+				http.Error(w, "trading loop is not running", http.StatusServiceUnavailable)
+				return
+			}
+		} else if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var status map[string]any
+		ok := runCommand(r.Context(), commands, loopDone, func() {
+			status = map[string]any{"killed": trader.Risk.Killed, "reason": trader.Risk.KillReason}
+		})
+		if !ok {
+			http.Error(w, "trading loop is not running", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	}
+}
+
+// runs command on the trading loop and waits for it. false when ctx is done or the loop stopped first
+func runCommand(ctx context.Context, commands chan<- func(), loopDone <-chan struct{}, command func()) bool {
+	done := make(chan struct{})
+	select {
+	case commands <- func() { command(); close(done) }:
+	case <-loopDone:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+	select {
+	case <-done:
+		return true
+	case <-loopDone:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// stores the closed trades and the account, updates the account metrics
+func save(account *Account, collAccount *mongo.Collection, collPaperTrade *mongo.Collection) {
+	trader := &account.Trader
+	for _, t := range trader.Trades {
+		account.RealizedPnL += t.PnL
+		log.Printf("[Info] Paper trade closed (%v): PnL %.2f\n", t.ExitReason, t.PnL)
+		if _, err := collPaperTrade.InsertOne(context.Background(), t); err != nil {
+			shared.MongoWriteErrors.WithLabelValues(collPaperTrade.Name(), shared.Symbol, shared.AggregatePeriod.String()).Inc()
+			log.Printf("[Error] Failed to insert to MongoDB: %v\n", err)
+		}
+	}
+	trader.Trades = trader.Trades[:0]
+
+	if err := account.Save(collAccount); err != nil {
+		shared.MongoWriteErrors.WithLabelValues(collAccount.Name(), shared.Symbol, shared.AggregatePeriod.String()).Inc()
+		log.Printf("[Error] Failed to save paper account to MongoDB: %v\n", err)
+	}
+
+	paperBalance.Set(trader.Wallet.USDT)
+	paperPosition.Set(trader.Wallet.BTC)
+	paperRealizedPnl.Set(account.RealizedPnL)
+}
+
+// bars after since in chronological order. limit 0 for no limit, otherwise the last limit bars.
+func loadBarsSince(collection *mongo.Collection, since time.Time, limit int64) []shared.AggregatedTradeInfo {
+	ctx := context.Background()
+	opts := options.Find().SetSort(bson.D{{Key: "lasttimestamp", Value: -1}}).SetLimit(limit)
+	cursor, err := collection.Find(ctx, bson.D{{Key: "lasttimestamp", Value: bson.D{{Key: "$gt", Value: since}}}}, opts)
+	if err != nil {
+		log.Printf("[Error] Cannot find from MongoDB: %v\n", err)
+		return nil
+	}
+	defer cursor.Close(ctx)
+
+	var results []shared.AggregatedTradeInfo
+	if err := cursor.All(ctx, &results); err != nil {
+		log.Printf("[Error] Cannot load from cursor: %v\n", err)
+		return nil
+	}
+	for i, j := 0, len(results)-1; i < j; i, j = i+1, j-1 {
+		results[i], results[j] = results[j], results[i]
+	}
+	return results
+}
+
+// signals from since on in chronological order, those at since may be processed already
+func loadSignalsSince(collection *mongo.Collection, since time.Time) []shared.TradeSignal {
+	ctx := context.Background()
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := collection.Find(ctx, bson.D{{Key: "timestamp", Value: bson.D{{Key: "$gte", Value: since}}}}, opts)
+	if err != nil {
+		log.Printf("[Error] Cannot find from MongoDB: %v\n", err)
+		return nil
+	}
+	defer cursor.Close(ctx)
+
+	var results []shared.TradeSignal
+	if err := cursor.All(ctx, &results); err != nil {
+		log.Printf("[Error] Cannot load from cursor: %v\n", err)
+		return nil
+	}
+	return results
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kaanureyen/tradebot/cmd/shared"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestDummy(t *testing.T) {
+	got := 1
+	want := 1
+	if got != want {
+		t.Errorf("Executed. got %v; want %v", got, want)
+	}
+
+}
+
+func TestKillSwitchHandler(t *testing.T) {
+	trader := shared.NewTrader(shared.StrategyParams{Sizing: shared.DefaultSizingConfig()}, shared.Wallet{USDT: 1000})
+	commands := make(chan func())
+	loopDone := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case command := <-commands:
+				command()
+			case <-loopDone:
+				return
+			}
+		}
+	}()
+	handler := killSwitchHandler(trader, commands, loopDone)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/killswitch?engage=true", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"killed":true`) {
+		t.Errorf("got %v %s; want the kill switch engaged", rec.Code, rec.Body)
+	}
+
+	// once the loop stopped, the requests do not block
+	close(loopDone)
+	result := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/killswitch", nil))
+		result <- rec.Code
+	}()
+	select {
+	case code := <-result:
+		if code != http.StatusServiceUnavailable {
+			t.Errorf("got %v; want 503 without the trading loop", code)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the request blocks after the trading loop stopped")
+	}
+}
+
+// the account saved is the account loaded after a restart, its open order included
+func TestAccountRoundTrip(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("save and load", func(mt *mtest.T) {
+		params := shared.StrategyParams{Sizing: shared.DefaultSizingConfig(), Orders: shared.OrderConfig{EntryType: shared.OrderTypeLimit, EntryOffset: 0.01, TimeInForce: shared.TimeInForceGTC}}
+		at := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.accounts", mtest.FirstBatch)) // not found, a new one
+		account, err := LoadAccount(mt.Coll, "test", params, 1000)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		account.Trader.OnSignal(shared.SideBuy, 100, at)
+		account.RealizedPnL, account.LastSignalTime, account.LastBarTime = 12.5, at, at
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+		if err := account.Save(mt.Coll); err != nil {
+			mt.Fatal(err)
+		}
+
+		// load what was saved
+		var saved bson.D
+		for _, e := range mt.GetAllStartedEvents() {
+			if e.CommandName == "update" {
+				updates := e.Command.Lookup("updates").Array()
+				values, _ := updates.Values()
+				saved = bson.D{}
+				if err := bson.Unmarshal(values[0].Document().Lookup("u").Document(), &saved); err != nil {
+					mt.Fatal(err)
+				}
+			}
+		}
+		if saved == nil {
+			mt.Fatal("nothing saved")
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.accounts", mtest.FirstBatch, saved))
+		loaded, err := LoadAccount(mt.Coll, "test", params, 1000)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if loaded.RealizedPnL != 12.5 || !loaded.LastSignalTime.Equal(at) || loaded.Trader.Wallet != account.Trader.Wallet {
+			t.Errorf("got %+v; want %+v", loaded, account)
+		}
+		want, got := account.Trader.Engine.OpenOrders(), loaded.Trader.Engine.OpenOrders()
+		if len(got) != 1 || len(want) != 1 || got[0].ID != want[0].ID || got[0].LimitPrice != want[0].LimitPrice || got[0].Quantity != want[0].Quantity {
+			t.Errorf("got open orders %+v; want %+v", got, want)
+		}
+	})
+}
+
+// signals of the same millisecond are all processed once, whether from Redis or the DB
+func TestAccountMarkSignal(t *testing.T) {
+	at := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	account := Account{LastSignalTime: at.Add(-time.Minute)}
+	exit := shared.TradeSignal{ID: primitive.NewObjectID(), TimeStamp: at.Add(100 * time.Microsecond), Signal: "SELL", Reason: shared.ExitReasonStopLoss}
+	crossover := shared.TradeSignal{ID: primitive.NewObjectID(), TimeStamp: at.Add(300 * time.Microsecond), Signal: "SELL", Reason: shared.ExitReasonCrossover}
+	if !account.MarkSignal(exit) || !account.MarkSignal(crossover) {
+		t.Fatal("got a signal of the millisecond dropped; want both processed")
+	}
+	stored := crossover
+	stored.TimeStamp = stored.TimeStamp.Truncate(time.Millisecond) // as loaded from the DB
+	if account.MarkSignal(exit) || account.MarkSignal(stored) {
+		t.Error("got a signal processed twice")
+	}
+	if account.MarkSignal(shared.TradeSignal{ID: primitive.NewObjectID(), TimeStamp: at.Add(-time.Second)}) {
+		t.Error("got an older signal processed")
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/kaanureyen/tradebot/cmd/shared"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// paper trading account persisted in MongoDB
+type Account struct {
+	ID             string               `bson:"_id"`
+	Trader         shared.Trader        `bson:"trader"`
+	RealizedPnL    float64              `bson:"realized_pnl"`
+	LastSignalTime time.Time            `bson:"last_signal_time"` // signals up to this time are processed
+	LastSignalIDs  []primitive.ObjectID `bson:"last_signal_ids"`  // signals processed at LastSignalTime
+	LastBarTime    time.Time            `bson:"last_bar_time"`    // bars up to this time are added to the ATR
+	UpdatedAt      time.Time            `bson:"updated_at"`
+}
+
+// loads the account or creates a new one with the given USDT balance.
+// a new account only acts on signals created after now.
+func LoadAccount(collection *mongo.Collection, id string, params shared.StrategyParams, usdt float64) (*Account, error) {
+	var account Account
+	err := collection.FindOne(context.Background(), bson.D{{Key: "_id", Value: id}}).Decode(&account)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("[Info] Creating paper account %v with %v USDT\n", id, usdt)
+		account = Account{
+			ID:             id,
+			Trader:         *shared.NewTrader(params, shared.Wallet{USDT: usdt}),
+			LastSignalTime: time.Now(),
+		}
+		return &account, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[Info] Loaded paper account %v: %+v\n", id, account.Trader.Wallet)
+	account.Trader.Params = params
+	account.Trader.Init()
+	return &account, nil
+}
+
+// records the signal as processed, false when it already was.
+// signals of the same millisecond, the precision of the DB, are told apart by their ID.
+func (a *Account) MarkSignal(s shared.TradeSignal) bool {
+	at := s.TimeStamp.Truncate(time.Millisecond)
+	switch {
+	case at.Before(a.LastSignalTime):
+		return false
+	case at.Equal(a.LastSignalTime):
+		if slices.Contains(a.LastSignalIDs, s.ID) {
+			return false
+		}
+		a.LastSignalIDs = append(a.LastSignalIDs, s.ID)
+	default:
+		a.LastSignalTime, a.LastSignalIDs = at, []primitive.ObjectID{s.ID}
+	}
+	return true
+}
+
+func (a *Account) Save(collection *mongo.Collection) error {
+	a.UpdatedAt = time.Now()
+	_, err := collection.ReplaceOne(context.Background(), bson.D{{Key: "_id", Value: a.ID}}, a, options.Replace().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,110 @@
+package shared
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// service level objectives of the pipeline, recorded as ratios by the recording rules
+const (
+	SloBarEmitLatency      = 5 * time.Second // bar end to its processing by the aggregator
+	SloBarEmitRatio        = 0.95
+	SloTradeReceiveLatency = time.Second // trade time to its receipt by the fetcher
+	SloTradeReceiveRatio   = 0.99
+)
+
+// alert of the pipeline. Prometheus evaluates Expr, the services evaluate the same condition with AlertEvaluator
+type AlertRule struct {
+	Name     string
+	Expr     string // PromQL
+	For      time.Duration
+	Severity string // "warning" or "critical"
+	Summary  string
+}
+
+// Prometheus recording rule
+type RecordingRule struct {
+	Record string
+	Expr   string
+}
+
+var (
+	AlertStaleTradeFeed = AlertRule{
+		Name:     "StaleTradeFeed",
+		Expr:     `sum by (symbol) (rate(trades_received_total[1m])) == 0`,
+		For:      time.Minute,
+		Severity: "critical",
+		Summary:  "No trade received from Binance for 2 minutes",
+	}
+	AlertBarEmissionLag = AlertRule{
+		Name: "BarEmissionLag",
+		Expr: fmt.Sprintf(`sum by (symbol, resolution) (rate(tradebot_stage_latency_seconds_bucket{stage="bar_emit",le="%v"}[5m])) / sum by (symbol, resolution) (rate(tradebot_stage_latency_seconds_count{stage="bar_emit"}[5m])) < %v`,
+			SloBarEmitLatency.Seconds(), SloBarEmitRatio),
+		For:      5 * time.Minute,
+		Severity: "warning",
+		Summary:  fmt.Sprintf("Less than %v%% of the bars are processed within %v of their end", SloBarEmitRatio*100, SloBarEmitLatency),
+	}
+	AlertSignalGenerationStopped = AlertRule{
+		Name:     "SignalGenerationStopped",
+		Expr:     `sum by (symbol, resolution) (increase(tradebot_stage_latency_seconds_count{stage="bar_emit"}[10m])) > 0 unless sum by (symbol, resolution) (increase(tradebot_stage_latency_seconds_count{stage="strategy"}[10m])) > 0`,
+		For:      5 * time.Minute,
+		Severity: "critical",
+		Summary:  "Bars are emitted but the strategy has not run for 10 minutes",
+	}
+	AlertMongoWriteFailures = AlertRule{
+		Name:     "MongoWriteFailures",
+		Expr:     `sum by (job, collection) (increase(tradebot_mongo_write_errors_total[5m])) > 0`,
+		Severity: "critical",
+		Summary:  "MongoDB writes failed in the last 5 minutes",
+	}
+	AlertReconnectStorm = AlertRule{
+		Name:     "ReconnectStorm",
+		Expr:     fmt.Sprintf(`sum by (symbol) (increase(websocket_reconnects_total[%v])) >= %v`, promDuration(ReconnectStormWindow), ReconnectStormCount),
+		Severity: "warning",
+		Summary:  fmt.Sprintf("%v or more reconnects to Binance in %v", ReconnectStormCount, ReconnectStormWindow),
+	}
+
+	AlertRules = []AlertRule{AlertStaleTradeFeed, AlertBarEmissionLag, AlertSignalGenerationStopped, AlertMongoWriteFailures, AlertReconnectStorm}
+
+	RecordingRules = []RecordingRule{
+		{"tradebot:stage_latency_seconds:p95_5m", `histogram_quantile(0.95, sum by (le, stage, symbol, resolution) (rate(tradebot_stage_latency_seconds_bucket[5m])))`},
+		{"tradebot:trades_received:rate1m", `sum by (symbol) (rate(trades_received_total[1m]))`},
+		{"tradebot:dropped_trades:rate5m", `sum by (reason, symbol, resolution) (rate(tradebot_dropped_trades_total[5m]))`},
+		{"tradebot:slo_bar_emit:ratio_rate5m", fmt.Sprintf(`sum by (symbol, resolution) (rate(tradebot_stage_latency_seconds_bucket{stage="bar_emit",le="%v"}[5m])) / sum by (symbol, resolution) (rate(tradebot_stage_latency_seconds_count{stage="bar_emit"}[5m]))`, SloBarEmitLatency.Seconds())},
+		{"tradebot:slo_trade_receive:ratio_rate5m", fmt.Sprintf(`sum by (symbol) (rate(tradebot_stage_latency_seconds_bucket{stage="receive",le="%v"}[5m])) / sum by (symbol) (rate(tradebot_stage_latency_seconds_count{stage="receive"}[5m]))`, SloTradeReceiveLatency.Seconds())},
+	}
+)
+
+// the rules in the Prometheus rule file format, served on /alerts/rules and shipped as configs/prometheus-rules.yml
+func WritePrometheusRules(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# generated from cmd/shared/alerts.go, the services serve it on /alerts/rules\n")
+	b.WriteString("groups:\n  - name: tradebot-recording\n    rules:\n")
+	for _, r := range RecordingRules {
+		fmt.Fprintf(&b, "      - record: %v\n        expr: %v\n", r.Record, yamlQuote(r.Expr))
+	}
+	b.WriteString("  - name: tradebot-alerts\n    rules:\n")
+	for _, r := range AlertRules {
+		fmt.Fprintf(&b, "      - alert: %v\n        expr: %v\n", r.Name, yamlQuote(r.Expr))
+		if r.For > 0 {
+			fmt.Fprintf(&b, "        for: %v\n", promDuration(r.For))
+		}
+		fmt.Fprintf(&b, "        labels:\n          severity: %v\n        annotations:\n          summary: %v\n", r.Severity, yamlQuote(r.Summary))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func yamlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// whole minutes or seconds, as Prometheus writes them
+func promDuration(d time.Duration) string {
+	if d%time.Minute == 0 {
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return fmt.Sprintf("%ds", d/time.Second)
+}
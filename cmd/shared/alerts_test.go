@@ -0,0 +1,122 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var update = flag.Bool("update", false, "rewrite configs/prometheus-rules.yml")
+
+const rulesFile = "../../configs/prometheus-rules.yml"
+
+// the shipped rule file must be the one the services serve
+func TestPrometheusRulesFile(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WritePrometheusRules(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if *update {
+		if err := os.WriteFile(rulesFile, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	shipped, err := os.ReadFile(rulesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(shipped, buf.Bytes()) {
+		t.Errorf("%v is out of date, run go test ./cmd/shared -run TestPrometheusRulesFile -update", rulesFile)
+	}
+	for _, want := range []string{"- alert: StaleTradeFeed", "for: 5m", `le="5"`, "websocket_reconnects_total[5m])) >= 5"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("rules miss %q", want)
+		}
+	}
+}
+
+func TestAlertEvaluator(t *testing.T) {
+	var received []alertNotification
+	done := make(chan struct{}, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n alertNotification
+		json.NewDecoder(r.Body).Decode(&n)
+		received = append(received, n)
+		done <- struct{}{}
+	}))
+	defer server.Close()
+
+	t.Setenv("ALERT_WEBHOOKS", server.URL)
+	e := NewAlertEvaluator("test")
+	e.Webhooks.Start(10)
+	firing := false
+	e.Add(AlertRule{Name: "Test", For: time.Minute, Severity: "warning", Summary: "test alert"}, func(time.Time) bool { return firing })
+
+	now := time.Now()
+	at := func(d time.Duration) []Alert { return e.Evaluate(now.Add(d)) }
+	if changed := at(0); len(changed) != 0 {
+		t.Errorf("got %v; want nothing before the condition", changed)
+	}
+	firing = true
+	if changed := at(15 * time.Second); len(changed) != 0 {
+		t.Errorf("got %v; want pending before For", changed)
+	}
+	if changed := at(75 * time.Second); len(changed) != 1 || changed[0].Status != "firing" {
+		t.Errorf("got %v; want firing after For", changed)
+	}
+	if changed := at(90 * time.Second); len(changed) != 0 {
+		t.Errorf("got %v; want no repeat while firing", changed)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/alerts", nil))
+	if body, _ := io.ReadAll(rec.Body); !strings.Contains(string(body), `"alertname":"Test"`) {
+		t.Errorf("got %s; want the firing alert", body)
+	}
+
+	firing = false
+	if changed := at(105 * time.Second); len(changed) != 1 || changed[0].Status != "resolved" || !changed[0].EndsAt.Equal(now.Add(105*time.Second)) {
+		t.Errorf("got %v; want resolved", changed)
+	}
+	e.Webhooks.Close()
+	<-done
+	<-done
+	if len(received) != 2 || received[0].Status != "firing" || received[1].Status != "resolved" || received[0].Alerts[0].Labels["service"] != "test" {
+		t.Errorf("got notifications %+v; want firing then resolved", received)
+	}
+}
+
+func TestIncrease(t *testing.T) {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_total"}, []string{"l"})
+	i := &Increase{Window: time.Minute}
+	now := time.Now()
+	if _, ok := i.Add(now, CounterSum(c)); ok {
+		t.Error("ok before the samples span the window")
+	}
+	c.WithLabelValues("a").Add(2)
+	i.Add(now.Add(30*time.Second), CounterSum(c))
+	c.WithLabelValues("b").Add(3)
+	if n, ok := i.Add(now.Add(time.Minute), CounterSum(c)); !ok || n != 5 {
+		t.Errorf("got %v %v; want 5 over the window", n, ok)
+	}
+	if n, _ := i.Add(now.Add(100*time.Second), CounterSum(c)); n != 3 {
+		t.Errorf("got %v; want 3 since the sample at 30s", n)
+	}
+
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_seconds", Buckets: []float64{1, 5}})
+	h.Observe(0.5)
+	h.Observe(3)
+	h.Observe(10)
+	if within, total := HistogramCounts(h, 5); within != 2 || total != 3 {
+		t.Errorf("got %v of %v; want 2 of 3", within, total)
+	}
+}
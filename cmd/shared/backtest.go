@@ -0,0 +1,170 @@
+package shared
+
+import (
+	"log"
+	"math"
+	"sort"
+	"time"
+)
+
+type EquityPoint struct {
+	Time   time.Time
+	Equity float64
+}
+
+type BacktestResult struct {
+	Params      StrategyParams
+	StartEquity float64
+	EndEquity   float64
+	Return      float64 // relative, 0.1 is 10%
+	MaxDrawdown float64 // relative, 0.1 is 10%
+	NumTrades   int     // fills, an entry and an exit are at least two
+	EndWallet   Wallet
+	Trades      []Trade
+	Long        SideMetrics
+	Short       SideMetrics
+	Equity      []EquityPoint
+}
+
+// runs the SMA crossover strategy over bars with the given wallet.
+// the first warmup bars only feed the SMA buffer and strategy state, no trades are made on them.
+// execution, sizing, exits and margin are handled by a Trader, see its description.
+func Backtest(bars []AggregatedTradeInfo, warmup int, params StrategyParams, wallet Wallet) BacktestResult {
+	result := BacktestResult{Params: params}
+	trader := NewTrader(params, wallet)
+
+	smaBuffer := SmaBuffer{}
+	smaBuffer.Init(params.SmaLongTerm)
+	atr := Atr{}
+	atr.Init(max(params.Sizing.AtrPeriod, 1))
+
+	lastDiff := 0.0
+	for i, v := range bars {
+		smaBuffer.Add(v.LastPrice, v.LastTime)
+		atr.Add(v.MaxPrice, v.MinPrice, v.LastPrice)
+		trader.Atr = atr.Value()
+
+		signal := ""
+		if smaBuffer.IsSmaReady(params.SmaLongTerm) {
+			smaShortTerm, _ := smaBuffer.CalculateSma(params.SmaShortTerm)
+			smaLongTerm, _ := smaBuffer.CalculateSma(params.SmaLongTerm)
+			diff := smaShortTerm - smaLongTerm
+			signal = CrossoverSignal(diff, lastDiff)
+			lastDiff = diff
+		}
+
+		if i < warmup {
+			continue
+		}
+		if i == warmup {
+			result.StartEquity = trader.Wallet.Equity(v.LastPrice)
+			// position carried over from a previous run is treated as opened now
+			trader.AdoptPosition(v.FirstPrice, v.FirstTime)
+		}
+
+		trader.OnBar(v)
+		if signal != "" {
+			trader.OnSignal(signal, v.LastPrice, v.LastTime)
+		}
+		result.Equity = append(result.Equity, EquityPoint{Time: v.LastTime, Equity: trader.Wallet.Equity(v.LastPrice)})
+	}
+
+	result.EndWallet = trader.Wallet
+	result.NumTrades = trader.NumFills
+	result.Trades = trader.Trades
+	if len(result.Equity) > 0 {
+		result.EndEquity = result.Equity[len(result.Equity)-1].Equity
+		result.MaxDrawdown = maxDrawdown(result.Equity)
+	}
+	if result.StartEquity > 0 {
+		result.Return = result.EndEquity/result.StartEquity - 1
+	}
+	result.Long, result.Short = SummarizeTrades(result.Trades)
+	return result
+}
+
+func maxDrawdown(equity []EquityPoint) float64 {
+	peak := math.Inf(-1)
+	maxDd := 0.0
+	for _, p := range equity {
+		peak = math.Max(peak, p.Equity)
+		if peak > 0 {
+			maxDd = math.Max(maxDd, (peak-p.Equity)/peak)
+		}
+	}
+	return maxDd
+}
+
+// strategy parameter values to search over. combinations with short term >= long term are skipped.
+type ParamGrid struct {
+	SmaShortTerms []int
+	SmaLongTerms  []int
+	Sizing        SizingConfig // used by every combination
+	Exits         ExitRules    // used by every combination
+	Margin        MarginConfig // used by every combination
+	Orders        OrderConfig  // used by every combination
+}
+
+func (g ParamGrid) Combinations() []StrategyParams {
+	var out []StrategyParams
+	for _, s := range g.SmaShortTerms {
+		for _, l := range g.SmaLongTerms {
+			if s > 0 && s < l {
+				out = append(out, StrategyParams{SmaShortTerm: s, SmaLongTerm: l, Sizing: g.Sizing, Exits: g.Exits, Margin: g.Margin, Orders: g.Orders})
+			}
+		}
+	}
+	return out
+}
+
+// longest SMA of the grid, which is the history needed before the strategy can trade
+func (g ParamGrid) MaxLongTerm() int {
+	max := 0
+	for _, l := range g.SmaLongTerms {
+		if l > max {
+			max = l
+		}
+	}
+	return max
+}
+
+// backtests every combination of the grid. results are sorted best first: by return, then by lower drawdown.
+func GridSearch(bars []AggregatedTradeInfo, warmup int, grid ParamGrid, wallet Wallet) []BacktestResult {
+	var results []BacktestResult
+	for _, params := range grid.Combinations() {
+		results = append(results, Backtest(bars, warmup, params, wallet))
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Return != results[j].Return {
+			return results[i].Return > results[j].Return
+		}
+		return results[i].MaxDrawdown < results[j].MaxDrawdown
+	})
+	return results
+}
+
+// inserts linearly interpolated bars where more than one period elapsed between consecutive bars,
+// the same way the aggregator fills its SMA buffer.
+func FillBarGaps(bars []AggregatedTradeInfo, period time.Duration) []AggregatedTradeInfo {
+	if len(bars) == 0 {
+		return bars
+	}
+	out := make([]AggregatedTradeInfo, 0, len(bars))
+	out = append(out, bars[0])
+	for _, v := range bars[1:] {
+		last := out[len(out)-1]
+		deltaDate := v.LastTime.Sub(last.LastTime)
+		deltaPrice := v.LastPrice - last.LastPrice
+		numPeriodsSinceLast := int(math.Round(float64(deltaDate) / float64(period)))
+		if numPeriodsSinceLast > 1 {
+			log.Printf("[Info] Gap of %v periods before %v. Missing bars will be linearly interpolated.\n", numPeriodsSinceLast, v.LastTime)
+			for i := 1; i < numPeriodsSinceLast; i++ {
+				p := last.LastPrice + (float64(i) * deltaPrice / float64(numPeriodsSinceLast))
+				d := last.LastTime.Add(time.Duration(i) * deltaDate / time.Duration(numPeriodsSinceLast))
+				out = append(out, AggregatedTradeInfo{FirstTime: d, LastTime: d, MinPrice: p, MaxPrice: p, FirstPrice: p, LastPrice: p})
+			}
+		}
+		out = append(out, v)
+	}
+	return out
+}
@@ -0,0 +1,89 @@
+package shared
+
+import (
+	"testing"
+	"time"
+)
+
+// bars with the given closing prices, one per AggregatePeriod
+func testBars(prices ...float64) []AggregatedTradeInfo {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	bars := make([]AggregatedTradeInfo, len(prices))
+	for i, p := range prices {
+		d := start.Add(time.Duration(i) * AggregatePeriod)
+		bars[i] = AggregatedTradeInfo{FirstTime: d, LastTime: d, MinPrice: p, MaxPrice: p, FirstPrice: p, LastPrice: p}
+	}
+	return bars
+}
+
+func TestBacktestCrossover(t *testing.T) {
+	bars := testBars(10, 10, 10, 12, 14, 16, 14, 12, 10, 8, 8)
+	res := Backtest(bars, 0, StrategyParams{SmaShortTerm: 1, SmaLongTerm: 3}, Wallet{USDT: 100})
+
+	if res.NumTrades != 2 {
+		t.Errorf("got %v trades; want 2", res.NumTrades)
+	}
+	if res.EndWallet.BTC != 0 {
+		t.Errorf("got %v BTC at the end; want 0", res.EndWallet.BTC)
+	}
+	// bought at 12, sold at 14
+	if want := 100.0 * 14 / 12; res.EndEquity != want {
+		t.Errorf("got end equity %v; want %v", res.EndEquity, want)
+	}
+	if res.MaxDrawdown <= 0 {
+		t.Errorf("got max drawdown %v; want > 0", res.MaxDrawdown)
+	}
+}
+
+func TestFillBarGaps(t *testing.T) {
+	bars := testBars(10, 20)
+	bars[1].LastTime = bars[0].LastTime.Add(4 * AggregatePeriod)
+
+	got := FillBarGaps(bars, AggregatePeriod)
+	if len(got) != 5 {
+		t.Fatalf("got %v bars; want 5", len(got))
+	}
+	if got[2].LastPrice != 15 {
+		t.Errorf("got interpolated price %v; want 15", got[2].LastPrice)
+	}
+}
+
+func TestWalkForward(t *testing.T) {
+	var prices []float64
+	for i := 0; i < 200; i++ {
+		prices = append(prices, float64(100+(i%40)))
+	}
+	grid := ParamGrid{SmaShortTerms: []int{2, 5}, SmaLongTerms: []int{10, 20}}
+	res, err := WalkForward(testBars(prices...), WalkForwardConfig{InSample: 50, OutOfSample: 25}, grid, Wallet{USDT: 1000})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.Windows) != 6 {
+		t.Errorf("got %v windows; want 6", len(res.Windows))
+	}
+	if len(res.Equity) != 6*25 {
+		t.Errorf("got %v stitched equity points; want %v", len(res.Equity), 6*25)
+	}
+	if res.StartEquity != 1000 {
+		t.Errorf("got start equity %v; want 1000", res.StartEquity)
+	}
+
+	if _, err := WalkForward(testBars(prices...), WalkForwardConfig{InSample: 5, OutOfSample: 25}, grid, Wallet{USDT: 1000}); err == nil {
+		t.Errorf("expected error for an in-sample window shorter than the longest SMA")
+	}
+}
+
+func TestBacktestStopLoss(t *testing.T) {
+	bars := testBars(10, 10, 10, 12, 14, 16, 12, 16, 18, 20)
+	params := StrategyParams{SmaShortTerm: 1, SmaLongTerm: 3, Exits: ExitRules{TrailingStop: 0.2}}
+	res := Backtest(bars, 0, params, Wallet{USDT: 100})
+
+	if len(res.Trades) != 1 {
+		t.Fatalf("got %v trades; want 1", len(res.Trades))
+	}
+	trade := res.Trades[0]
+	// highest 16 before the drop to 12, trailing stop at 12.8
+	if trade.ExitReason != ExitReasonTrailingStop || trade.ExitPrice != 12 {
+		t.Errorf("got exit %v at %v; want %v at 12 (bar opening below the stop)", trade.ExitReason, trade.ExitPrice, ExitReasonTrailingStop)
+	}
+}
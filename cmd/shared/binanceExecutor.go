@@ -0,0 +1,273 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	binance_connector "github.com/binance/binance-connector-go"
+	"github.com/binance/binance-connector-go/handlers"
+)
+
+// error codes of the Binance API: an unknown order, and the responses that leave the order's status unknown
+const (
+	binanceCodeNoSuchOrder     = -2013
+	binanceCodeUnknownResponse = -1006
+	binanceCodeResponseTimeout = -1007
+)
+
+// an error response of the exchange about a new order, other than the ones that leave its status unknown
+func isBinanceRejection(code int64) bool {
+	return code != binanceCodeUnknownResponse && code != binanceCodeResponseTimeout
+}
+
+// Executor of the Binance spot REST API. BaseURL can point to a MockExchange.
+// quantities and prices are snapped to the filters of the symbol from exchangeInfo, loaded once per symbol.
+type BinanceExecutor struct {
+	client *binance_connector.Client
+
+	mu      sync.Mutex
+	filters map[string]SymbolFilters
+}
+
+func NewBinanceExecutor(apiKey string, secretKey string, baseURL string) *BinanceExecutor {
+	return &BinanceExecutor{client: binance_connector.NewClient(apiKey, secretKey, baseURL), filters: map[string]SymbolFilters{}}
+}
+
+// order filters of a symbol. 0 when the exchange does not set one
+type SymbolFilters struct {
+	StepSize    float64 // LOT_SIZE, quantities are multiples of it
+	MinQty      float64
+	TickSize    float64 // PRICE_FILTER, prices are multiples of it
+	MinNotional float64 // MIN_NOTIONAL or NOTIONAL, of limit and stop orders
+}
+
+// rounds the quantity down to the step size and the prices to the tick size.
+// fails with ErrOrderRejected when the quantity or the notional is below the minimum
+func (f SymbolFilters) Apply(o Order) (Order, error) {
+	o.Quantity = snapDown(o.Quantity, f.StepSize)
+	o.LimitPrice = snap(o.LimitPrice, f.TickSize)
+	o.StopPrice = snap(o.StopPrice, f.TickSize)
+	if o.Quantity <= 0 || o.Quantity < f.MinQty {
+		return o, fmt.Errorf("%w: quantity %v below the minimum %v", ErrOrderRejected, o.Quantity, max(f.MinQty, f.StepSize))
+	}
+	price := o.LimitPrice
+	if o.Type == OrderTypeStop {
+		price = o.StopPrice
+	}
+	if price > 0 && o.Quantity*price < f.MinNotional {
+		return o, fmt.Errorf("%w: notional %v below the minimum %v", ErrOrderRejected, o.Quantity*price, f.MinNotional)
+	}
+	return o, nil
+}
+
+// decimals of a step like 0.00100000, the rounded values print without binary noise
+func stepDecimals(step float64) float64 {
+	return math.Pow(10, math.Max(0, math.Ceil(-math.Log10(step)-1e-9)))
+}
+
+func snapDown(v, step float64) float64 {
+	if step <= 0 {
+		return v
+	}
+	scale := stepDecimals(step)
+	return math.Round(math.Floor(v/step+1e-9)*step*scale) / scale
+}
+
+func snap(v, step float64) float64 {
+	if step <= 0 {
+		return v
+	}
+	scale := stepDecimals(step)
+	return math.Round(math.Round(v/step)*step*scale) / scale
+}
+
+// filters of the symbol, from exchangeInfo on the first use
+func (e *BinanceExecutor) Filters(ctx context.Context, symbol string) (SymbolFilters, error) {
+	e.mu.Lock()
+	f, ok := e.filters[symbol]
+	e.mu.Unlock()
+	if ok {
+		return f, nil
+	}
+	res, err := e.client.NewExchangeInfoService().Symbol(symbol).Do(ctx)
+	if err != nil {
+		return f, err
+	}
+	for _, s := range res.Symbols {
+		if s.Symbol != symbol {
+			continue
+		}
+		for _, sf := range s.Filters {
+			switch sf.FilterType {
+			case "LOT_SIZE":
+				f.StepSize, f.MinQty = parseFloat(sf.StepSize), parseFloat(sf.MinQty)
+			case "PRICE_FILTER":
+				f.TickSize = parseFloat(sf.TickSize)
+			case "MIN_NOTIONAL", "NOTIONAL":
+				f.MinNotional = parseFloat(sf.MinNotional)
+			}
+		}
+		e.mu.Lock()
+		e.filters[symbol] = f
+		e.mu.Unlock()
+		return f, nil
+	}
+	return f, fmt.Errorf("%w: symbol %v not in exchangeInfo", ErrOrderRejected, symbol)
+}
+
+// Binance spot order types of the Order* types. stop orders are STOP_LOSS, a market order on the stop price
+func binanceOrderType(orderType string) string {
+	if orderType == OrderTypeStop {
+		return "STOP_LOSS"
+	}
+	return orderType
+}
+
+func orderTypeFromBinance(orderType string) string {
+	if orderType == "STOP_LOSS" {
+		return OrderTypeStop
+	}
+	return orderType
+}
+
+func (e *BinanceExecutor) PlaceOrder(ctx context.Context, symbol string, order Order) (Order, error) {
+	if order.ClientOrderID == "" {
+		order.ClientOrderID = NewClientOrderID()
+	}
+	filters, err := e.Filters(ctx, symbol)
+	if err != nil {
+		return order, fmt.Errorf("%w: cannot load the filters of %v: %v", ErrOrderRejected, symbol, err) // not sent
+	}
+	if order, err = filters.Apply(order); err != nil {
+		return order, err
+	}
+	s := e.client.NewCreateOrderService().
+		Symbol(symbol).
+		Side(order.Side).
+		Type(binanceOrderType(order.Type)).
+		Quantity(order.Quantity).
+		NewClientOrderId(order.ClientOrderID).
+		NewOrderRespType("RESULT")
+	switch order.Type {
+	case OrderTypeLimit:
+		s.Price(order.LimitPrice).TimeInForce(order.TimeInForce)
+	case OrderTypeStop:
+		s.StopPrice(order.StopPrice)
+	}
+	res, err := s.Do(ctx)
+	if apiErr := (*handlers.APIError)(nil); errors.As(err, &apiErr) && isBinanceRejection(apiErr.Code) {
+		return order, fmt.Errorf("%w: %v", ErrOrderRejected, err)
+	}
+	if err != nil {
+		return order, err
+	}
+	r := res.(*binance_connector.CreateOrderResponseRESULT)
+	order.ID = r.OrderId
+	order.Status = r.Status
+	order.FilledQty = parseFloat(r.ExecutedQty)
+	order.AvgPrice = avgPrice(r.CummulativeQuoteQty, order.FilledQty)
+	order.CreatedAt = time.UnixMilli(int64(r.TransactTime))
+	return order, nil
+}
+
+func (e *BinanceExecutor) CancelOrder(ctx context.Context, symbol string, clientOrderID string) (Order, error) {
+	r, err := e.client.NewCancelOrderService().Symbol(symbol).OrigClientOrderId(clientOrderID).Do(ctx)
+	if err != nil {
+		return Order{}, err
+	}
+	filled := parseFloat(r.ExecutedQty)
+	return Order{
+		ID:            r.OrderId,
+		ClientOrderID: r.OrigClientOrderId,
+		Side:          r.Side,
+		Type:          orderTypeFromBinance(r.Type),
+		TimeInForce:   r.TimeInForce,
+		Quantity:      parseFloat(r.OrigQty),
+		LimitPrice:    parseFloat(r.Price),
+		StopPrice:     parseFloat(r.StopPrice),
+		FilledQty:     filled,
+		AvgPrice:      avgPrice(r.CummulativeQuoteQty, filled),
+		Status:        r.Status,
+	}, nil
+}
+
+func (e *BinanceExecutor) QueryOrder(ctx context.Context, symbol string, clientOrderID string) (Order, error) {
+	r, err := e.client.NewGetOrderService().Symbol(symbol).OrigClientOrderId(clientOrderID).Do(ctx)
+	if apiErr := (*handlers.APIError)(nil); errors.As(err, &apiErr) && apiErr.Code == binanceCodeNoSuchOrder {
+		return Order{}, fmt.Errorf("%w: %v", ErrOrderNotFound, err)
+	}
+	if err != nil {
+		return Order{}, err
+	}
+	filled := parseFloat(r.ExecutedQty)
+	return Order{
+		ID:            r.OrderId,
+		ClientOrderID: r.ClientOrderId,
+		Side:          r.Side,
+		Type:          orderTypeFromBinance(r.Type),
+		TimeInForce:   r.TimeInForce,
+		Quantity:      parseFloat(r.OrigQty),
+		LimitPrice:    parseFloat(r.Price),
+		StopPrice:     parseFloat(r.StopPrice),
+		CreatedAt:     time.UnixMilli(int64(r.Time)),
+		FilledQty:     filled,
+		AvgPrice:      avgPrice(r.CummulativeQuoteQty, filled),
+		Status:        r.Status,
+	}, nil
+}
+
+func (e *BinanceExecutor) OpenOrders(ctx context.Context, symbol string) ([]Order, error) {
+	res, err := e.client.NewGetOpenOrdersService().Symbol(symbol).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	orders := make([]Order, 0, len(res))
+	for _, r := range res {
+		filled := parseFloat(r.ExecutedQty)
+		orders = append(orders, Order{
+			ID:            r.OrderId,
+			ClientOrderID: r.ClientOrderId,
+			Side:          r.Side,
+			Type:          orderTypeFromBinance(r.Type),
+			TimeInForce:   r.TimeInForce,
+			Quantity:      parseFloat(r.OrigQty),
+			LimitPrice:    parseFloat(r.Price),
+			StopPrice:     parseFloat(r.StopPrice),
+			CreatedAt:     time.UnixMilli(int64(r.Time)),
+			FilledQty:     filled,
+			AvgPrice:      avgPrice(r.CummulativeQuoteQty, filled),
+			Status:        r.Status,
+		})
+	}
+	return orders, nil
+}
+
+func (e *BinanceExecutor) Balances(ctx context.Context) (map[string]Balance, error) {
+	res, err := e.client.NewGetAccountService().Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	balances := make(map[string]Balance, len(res.Balances))
+	for _, b := range res.Balances {
+		balances[b.Asset] = Balance{Asset: b.Asset, Free: parseFloat(b.Free), Locked: parseFloat(b.Locked)}
+	}
+	return balances, nil
+}
+
+// parses the decimal strings of the API, 0 when empty or invalid
+func parseFloat(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+func avgPrice(cummulativeQuoteQty string, filled float64) float64 {
+	if filled == 0 {
+		return 0
+	}
+	return parseFloat(cummulativeQuoteQty) / filled
+}
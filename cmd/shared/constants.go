@@ -6,13 +6,49 @@ const (
 	// common
 	HealthEndpointFirstPort = 8080
 	HealthEndpointLastPort  = 8100
+	Symbol                  = "BTCUSDT"       // the only symbol fetched
+	ShutdownPhaseTimeout    = 5 * time.Second // default deadline of each shutdown phase
+	HealthCheckTimeout      = 2 * time.Second // default timeout of the /livez and /readyz checks
+	ReadyMaxTradeAge        = time.Minute     // not ready when the last trade is older
+	ReadyMaxBarAge          = 4 * AggregatePeriod
+	LogRateLimit            = 10 * time.Second // noisy messages are logged at most this often
+	AlertEvalInterval       = 15 * time.Second // of the AlertEvaluator, the scrape interval of Prometheus
 	// aggregator
-	RedisChannel = "binance:trade:btcusdt"
-	SmaLongTerm  = 200
-	SmaShortTerm = 50
+	RedisChannel      = "binance:trade:btcusdt"
+	BarChannel        = "tradebot:bar:btcusdt"        // BarEvent of each closed bar
+	BarUpdateChannel  = "tradebot:bar_update:btcusdt" // BarEvent of the bar in progress, at most every BarUpdateInterval
+	BarUpdateInterval = time.Second
+	IndicatorChannel  = "tradebot:indicator:btcusdt" // SmaStruct of each closed bar
+	SignalChannel     = "tradebot:signal:btcusdt"    // TradeSignal events, published as they are generated
+	SignalStream      = "tradebot:signals:btcusdt"   // same events in a stream, for consumers that catch up
+	SignalStreamLen   = 10000                        // approximate upper limit of the stream length
+	AggregatePeriod   = 15 * time.Second             // price bucketing period
+	SmaLongTerm       = 200
+	SmaShortTerm      = 50
 	// fetcher
-	TimeBeforeReconnect = 5 * time.Second // 300 connections per 5 minutes is the limit. this should be fine
-	TimeoutBeforeReturn = 5 * time.Second // arbitrary. gets done <1ms, I don't think it's over network
+	ReconnectBaseDelay     = time.Second     // first backoff, doubled by each consecutive failure
+	ReconnectMaxDelay      = 2 * time.Minute // longest backoff
+	ReconnectJitter        = 0.5             // share of the backoff randomized, the connections do not retry in step
+	ConnectionBudget       = 300             // connections per ConnectionBudgetWindow, the limit of Binance per IP
+	ConnectionBudgetWindow = 5 * time.Minute
+	CircuitFailures        = 5               // consecutive failures that open the circuit
+	CircuitOpenTime        = time.Minute     // no connection while open, then one trial
+	StableConnection       = time.Minute     // a connection dropping before is a failure, one lasting resets the backoff
+	TimeoutBeforeReturn    = 5 * time.Second // arbitrary. gets done <1ms, I don't think it's over network
+	ReconnectStormCount    = 5               // reconnects within ReconnectStormWindow reported as a storm
+	ReconnectStormWindow   = 5 * time.Minute
+	StaleFeedTimeout       = 30 * time.Second              // an open stream without a trade for this long is reconnected, STALE_FEED_TIMEOUT
+	MinStaleFeedTimeout    = time.Second                   // shorter ones fall back to the default, even a busy market has gaps this long
+	MaxConnectionAge       = 23*time.Hour + 30*time.Minute // Binance closes the connections at 24h, they are replaced before, MAX_CONNECTION_AGE
+	ConnectionOverlap      = 5 * time.Second               // both connections stream while one replaces the other
+	FeedConnections        = 1                             // independent connections per symbol, FEED_CONNECTIONS=2 for a redundant feed
+	// notifications
+	IncidentChannel = "tradebot:incident"
+	// orders
+	EntryOffset = 0.001 // of the LIMIT/STOP entries from the signal price, ORDER_ENTRY_OFFSET
+	// papertrader
+	PaperAccountID    = "BTCUSDT"
+	PaperPollInterval = 5 * time.Second // how often new bars and signals are read from the DB
 )
 
 // not a constant but only known in runtime.
@@ -31,4 +67,11 @@ var (
 			return "mongodb://localhost:27017"
 		}
 	}()
+	MockExchangeURL = func() string { // detect whether running under docker in runtime
+		if IsRunningInDocker() {
+			return "http://mockexchange:8090"
+		} else {
+			return "http://localhost:8090"
+		}
+	}()
 )
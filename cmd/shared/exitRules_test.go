@@ -0,0 +1,42 @@
+package shared
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPositionExits(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		rules      ExitRules
+		bars       [][4]float64 // open, high, low, close
+		wantPrice  float64
+		wantReason string
+	}{
+		{"stop loss", ExitRules{StopLoss: 0.1}, [][4]float64{{100, 101, 95, 96}, {96, 97, 85, 88}}, 90, ExitReasonStopLoss},
+		{"gap below stop fills at open", ExitRules{StopLoss: 0.1}, [][4]float64{{80, 82, 79, 81}}, 80, ExitReasonStopLoss},
+		{"take profit", ExitRules{TakeProfit: 0.1}, [][4]float64{{100, 112, 99, 105}}, 110, ExitReasonTakeProfit},
+		{"trailing stop", ExitRules{StopLoss: 0.2, TrailingStop: 0.1}, [][4]float64{{100, 120, 100, 118}, {118, 119, 105, 106}}, 108, ExitReasonTrailingStop},
+		{"stop before take profit", ExitRules{StopLoss: 0.1, TakeProfit: 0.1}, [][4]float64{{100, 115, 85, 100}}, 90, ExitReasonStopLoss},
+		{"time exit", ExitRules{MaxHold: time.Minute}, [][4]float64{{100, 101, 99, 100}, {100, 101, 99, 101}}, 101, ExitReasonTimeExit},
+		{"no exit", ExitRules{StopLoss: 0.5, TakeProfit: 0.5}, [][4]float64{{100, 110, 90, 100}}, 0, ""},
+	}
+	for _, tt := range tests {
+		p := PositionExits{Rules: tt.rules}
+		p.Open(100, start)
+		var price float64
+		var reason string
+		for i, b := range tt.bars {
+			price, reason = p.Check(b[0], b[1], b[2], b[3], start.Add(time.Duration(i+1)*30*time.Second))
+			if reason != "" {
+				break
+			}
+		}
+		if math.Abs(price-tt.wantPrice) > 1e-9 || reason != tt.wantReason {
+			t.Errorf("%v: got %v %q; want %v %q", tt.name, price, reason, tt.wantPrice, tt.wantReason)
+		}
+	}
+}
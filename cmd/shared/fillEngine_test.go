@@ -0,0 +1,96 @@
+package shared
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFillEngine(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	bar := func(i int, open, high, low, close, volume float64) AggregatedTradeInfo {
+		d := start.Add(time.Duration(i) * AggregatePeriod)
+		return AggregatedTradeInfo{FirstTime: d, LastTime: d.Add(AggregatePeriod - time.Second), FirstPrice: open, MaxPrice: high, MinPrice: low, LastPrice: close, Volume: volume}
+	}
+
+	e := FillEngine{MaxParticipation: 0.5}
+	market := e.Submit(Order{Side: SideBuy, Type: OrderTypeMarket, Quantity: 1, CreatedAt: start})
+	limit := e.Submit(Order{Side: SideBuy, Type: OrderTypeLimit, Quantity: 1, LimitPrice: 95, CreatedAt: start})
+	stop := e.Submit(Order{Side: SideSell, Type: OrderTypeStop, Quantity: 1, StopPrice: 90, CreatedAt: start})
+	ioc := e.Submit(Order{Side: SideBuy, Type: OrderTypeLimit, TimeInForce: TimeInForceIOC, Quantity: 1, LimitPrice: 50, CreatedAt: start})
+	fok := e.Submit(Order{Side: SideBuy, Type: OrderTypeMarket, TimeInForce: TimeInForceFOK, Quantity: 10, CreatedAt: start})
+
+	fills := e.OnBar(bar(1, 100, 101, 94, 96, 4))
+	if len(fills) != 2 {
+		t.Fatalf("got %v fills; want 2: %+v", len(fills), fills)
+	}
+	if market.Status != OrderStatusFilled || market.AvgPrice != 100 {
+		t.Errorf("market: got %v at %v; want FILLED at 100", market.Status, market.AvgPrice)
+	}
+	if limit.Status != OrderStatusFilled || limit.AvgPrice != 95 {
+		t.Errorf("limit: got %v at %v; want FILLED at 95", limit.Status, limit.AvgPrice)
+	}
+	if stop.Status != OrderStatusNew {
+		t.Errorf("stop: got %v; want NEW", stop.Status)
+	}
+	if ioc.Status != OrderStatusExpired || fok.Status != OrderStatusExpired {
+		t.Errorf("got ioc %v, fok %v; want both EXPIRED", ioc.Status, fok.Status)
+	}
+
+	// gaps below the stop, volume limits the fill to 0.5
+	e.OnBar(bar(2, 85, 88, 80, 86, 1))
+	if stop.Status != OrderStatusPartiallyFilled || stop.FilledQty != 0.5 || stop.AvgPrice != 85 {
+		t.Errorf("stop: got %v %v at %v; want PARTIALLY_FILLED 0.5 at 85", stop.Status, stop.FilledQty, stop.AvgPrice)
+	}
+	e.OnTrade(start.Add(3*AggregatePeriod), 87, 2)
+	if stop.Status != OrderStatusFilled || stop.AvgPrice != 86 {
+		t.Errorf("stop: got %v at %v; want FILLED at 86", stop.Status, stop.AvgPrice)
+	}
+	if len(e.OpenOrders()) != 0 {
+		t.Errorf("got %v open orders; want 0", len(e.OpenOrders()))
+	}
+}
+
+// the orders share the volume of a bar
+func TestFillEngineParticipation(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	e := FillEngine{MaxParticipation: 0.1}
+	first := e.Submit(Order{Side: SideBuy, Type: OrderTypeMarket, Quantity: 0.6, CreatedAt: start})
+	second := e.Submit(Order{Side: SideBuy, Type: OrderTypeMarket, Quantity: 0.6, CreatedAt: start})
+	e.OnTrade(start.Add(time.Second), 100, 10)
+	if first.FilledQty != 0.6 || second.FilledQty != 0.4 {
+		t.Errorf("got %v and %v filled; want 0.6 and 0.4, 1 of the volume of 10", first.FilledQty, second.FilledQty)
+	}
+}
+
+func TestFillEngineLatency(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	e := FillEngine{Latency: 2 * time.Second}
+	o := e.Submit(Order{Side: SideBuy, Type: OrderTypeMarket, Quantity: 1, CreatedAt: start})
+
+	if fills := e.OnTrade(start.Add(time.Second), 100, 1); len(fills) != 0 {
+		t.Errorf("got fill before the order became active")
+	}
+	// active in the middle of the bar: fills at its close
+	e.OnBar(AggregatedTradeInfo{FirstTime: start.Add(time.Second), LastTime: start.Add(10 * time.Second), FirstPrice: 100, MaxPrice: 105, MinPrice: 95, LastPrice: 102})
+	if o.Status != OrderStatusFilled || o.AvgPrice != 102 {
+		t.Errorf("got %v at %v; want FILLED at 102", o.Status, o.AvgPrice)
+	}
+}
+
+func TestBacktestLimitEntry(t *testing.T) {
+	bars := testBars(10, 10, 10, 12, 14, 16, 14, 12, 10, 8, 8)
+	params := StrategyParams{SmaShortTerm: 1, SmaLongTerm: 3, Orders: OrderConfig{EntryType: OrderTypeLimit, EntryOffset: 0.5}}
+	res := Backtest(bars, 0, params, Wallet{USDT: 100})
+
+	// the BUY at 12 waits for 6, which is never reached
+	if res.NumTrades != 0 || res.EndEquity != 100 {
+		t.Errorf("got %v fills, end equity %v; want no fills", res.NumTrades, res.EndEquity)
+	}
+
+	params.Orders = OrderConfig{EntryType: OrderTypeMarket}
+	res = Backtest(bars, 0, params, Wallet{USDT: 100})
+	// BUY at the close of 12 fills at the next bar (14), SELL at the close of 14 fills at 12
+	if len(res.Trades) != 1 || res.Trades[0].EntryPrice != 14 || res.Trades[0].ExitPrice != 12 {
+		t.Errorf("got trades %+v; want entry at 14, exit at 12", res.Trades)
+	}
+}
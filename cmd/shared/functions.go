@@ -3,10 +3,11 @@ package shared
 import (
 	"context"
 	"log"
-	"net/http"
 	"os"
 	"strconv"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -19,50 +20,26 @@ func IsRunningInDocker() bool {
 	return false
 }
 
-// initializes logger, starts health endpoint, inits&returns pointer to a shutdownOrchestrator
-func InitCommon(moduleName string) *ShutdownOrchestrator {
-	logger("[" + moduleName + "] ") // set logger and print start msg
-	healthEndpoint(moduleName)      // start health endpoint and print msg
-
-	// start shutdown orchestrator
-	var shutdownOrchestrator ShutdownOrchestrator
-	shutdownOrchestrator.Start()
-	return &shutdownOrchestrator
-}
-
-func logger(s string) {
-	// show line number in logs, show microseconds, add prefix
-	log.SetFlags(log.LstdFlags | log.Lshortfile | log.Lmicroseconds)
-	log.SetPrefix(s)
+// sets up logging and tracing, starts the admin server, inits&returns pointers to a shutdownOrchestrator and the admin server
+func InitCommon(moduleName string) (*ShutdownOrchestrator, *AdminServer) {
+	SetupLogging(moduleName, os.Stderr) // JSON logs with the service name, the log package included
 	log.Println("[Info] Started")
-}
 
-func healthEndpoint(moduleName string) {
-	go func() {
-		http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-			w.Write([]byte(moduleName + " is OK"))
-		})
-
-		port := os.Getenv("HEALTH_PORT")
-		if port != "" { // found HEALTH_PORT. will only try it.
-			log.Printf("[Info] Health endpoint (http://localhost:%v/healthz) listening on :%v\n", port, port)
-			if err := http.ListenAndServe(":"+port, nil); err != nil {
-				log.Fatalf("[Fatal][Error] Error starting health endpoint: %v", err)
-			}
-
-		} else { // will try ports in range [HealthEndpointFirstPort, HealthEndpointLastPort] one by one
-			for port := HealthEndpointFirstPort; port < HealthEndpointLastPort; port++ {
-				log.Printf("[Info] Health endpoint (http://localhost:%v/healthz) listening on :%v\n", port, port)
-				if err := http.ListenAndServe(":"+strconv.Itoa(port), nil); err != nil {
-					log.Printf("[Warning] Error starting health endpoint: %v", err)
-					log.Printf("[Info] Trying next port.")
-					continue
-				}
-				return
-			}
-			log.Fatalf("[Fatal][Error] Could not find an empty port for health endpoint for %v in range [%v,%v]\n", moduleName, HealthEndpointFirstPort, HealthEndpointLastPort)
-		}
-	}()
+	// start admin server: health, metrics, pprof, build info, config and the control actions of the service
+	admin := NewAdminServer(moduleName)
+	admin.SetConfig("redis_address", RedisAddress)
+	admin.SetConfig("mongo_uri", RedactURI(MongoUri))
+	otlpEndpoint, flushTraces := InitTracing(moduleName)
+	admin.SetConfig("otlp_endpoint", otlpEndpoint)
+	prometheus.MustRegister(PipelineMetrics...)
+	admin.Start()
+
+	// start shutdown orchestrator. the admin server is closed last
+	shutdownOrchestrator := NewShutdownOrchestrator()
+	shutdownOrchestrator.Register(PhaseFlushStorage, "traces", flushTraces)
+	shutdownOrchestrator.Register(PhaseCloseConnections, "admin server", admin.Shutdown)
+	shutdownOrchestrator.Start()
+	return shutdownOrchestrator, admin
 }
 
 func MongoConnect() (*mongo.Client, context.Context) {
@@ -169,3 +146,136 @@ func MongoTradeCollection(client *mongo.Client, ctx context.Context) *mongo.Coll
 	}
 	return collection
 }
+
+func MongoPaperAccountCollection(client *mongo.Client, ctx context.Context) *mongo.Collection {
+	// regular collection, one document per account
+	return client.Database("tradebot").Collection("paper_account")
+}
+
+func MongoControlCollection(client *mongo.Client, ctx context.Context) *mongo.Collection {
+	// regular collection, one document per service with the state set by the operator
+	return client.Database("tradebot").Collection("control")
+}
+
+func MongoDeadLetterCollection(client *mongo.Client, ctx context.Context) *mongo.Collection {
+	// regular collection, payloads undeliverable to the signal webhooks
+	return client.Database("tradebot").Collection("signal_dead_letters")
+}
+
+func MongoOrderCollection(client *mongo.Client, ctx context.Context) *mongo.Collection {
+	// regular collection, one document per client order ID
+	collection := client.Database("tradebot").Collection("orders")
+
+	// open orders of an account are loaded at startup
+	_, err := collection.Indexes().CreateOne(
+		ctx,
+		mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "account", Value: 1},
+				{Key: "state", Value: 1},
+			},
+			Options: nil,
+		},
+	)
+	if err != nil {
+		log.Fatalf("[Error] Failed to create index: %v\n", err)
+	}
+	return collection
+}
+
+func MongoPaperTradeCollection(client *mongo.Client, ctx context.Context) *mongo.Collection {
+	// try to create timeseries collection.
+	opts := options.CreateCollection().SetTimeSeriesOptions(
+		options.TimeSeries().
+			SetTimeField("exit_time"),
+	)
+
+	err := client.Database("tradebot").CreateCollection(ctx, "paper_trades", opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	collection := client.Database("tradebot").Collection("paper_trades")
+
+	// set indexing to descending
+	_, err = collection.Indexes().CreateOne(
+		ctx,
+		mongo.IndexModel{
+			Keys: bson.D{
+				{
+					Key:   "exit_time",
+					Value: -1},
+			}, // descending index
+			Options: nil,
+		},
+	)
+	if err != nil {
+		log.Fatalf("[Error] Failed to create index: %v\n", err)
+	}
+	return collection
+}
+
+func MongoBlockedSignalCollection(client *mongo.Client, ctx context.Context) *mongo.Collection {
+	// try to create timeseries collection.
+	opts := options.CreateCollection().SetTimeSeriesOptions(
+		options.TimeSeries().
+			SetTimeField("timestamp"),
+	)
+
+	err := client.Database("tradebot").CreateCollection(ctx, "price_stats_sma_trade_blocked", opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	collection := client.Database("tradebot").Collection("price_stats_sma_trade_blocked")
+
+	// set indexing to descending
+	_, err = collection.Indexes().CreateOne(
+		ctx,
+		mongo.IndexModel{
+			Keys: bson.D{
+				{
+					Key:   "timestamp",
+					Value: -1},
+			}, // descending index
+			Options: nil,
+		},
+	)
+	if err != nil {
+		log.Fatalf("[Error] Failed to create index: %v\n", err)
+	}
+	return collection
+}
+
+// gets the last n bars in chronological order, with gaps interpolated
+func LoadLastNBars(collection *mongo.Collection, n int) []AggregatedTradeInfo {
+	ctx := context.Background()
+	opts := options.Find().SetSort(bson.D{{Key: "lasttimestamp", Value: -1}}).SetLimit(int64(n))
+	cursor, err := collection.Find(ctx, bson.D{}, opts)
+	if err != nil {
+		log.Printf("[Error] Cannot find from MongoDB: %v\n", err)
+		return nil
+	}
+	defer cursor.Close(ctx)
+
+	var results []AggregatedTradeInfo
+	if err := cursor.All(ctx, &results); err != nil {
+		log.Printf("[Error] Cannot load from cursor: %v\n", err)
+		return nil
+	}
+
+	// reverse into chronological order
+	for i, j := 0, len(results)-1; i < j; i, j = i+1, j-1 {
+		results[i], results[j] = results[j], results[i]
+	}
+	log.Printf("[Info] Loaded %v bars\n", len(results))
+	return FillBarGaps(results, AggregatePeriod)
+}
+
+// RFC 3339 or unix milliseconds
+func ParseTime(s string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
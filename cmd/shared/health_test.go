@@ -0,0 +1,66 @@
+package shared
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	h := &HealthChecks{Timeout: 50 * time.Millisecond}
+	var lastTrade Heartbeat
+	h.AddLiveness("last_trade", lastTrade.Check("trade", time.Minute))
+	h.AddReadiness("redis", func(context.Context) error { return nil })
+	h.AddReadiness("mongodb", func(context.Context) error { return errors.New("connection refused") })
+	h.AddReadiness("slow", func(ctx context.Context) error { // held up past the timeout
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	get := func(handler http.HandlerFunc) (int, HealthReport) {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		var report HealthReport
+		if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		return rec.Code, report
+	}
+
+	code, report := get(h.ReadinessHandler())
+	if code != http.StatusServiceUnavailable || report.Status != "fail" {
+		t.Errorf("got %v %v; want 503 fail", code, report.Status)
+	}
+	if c := report.Checks["redis"]; c.Status != "ok" {
+		t.Errorf("got redis %+v; want ok", c)
+	}
+	if c := report.Checks["mongodb"]; c.Status != "fail" || c.Error != "connection refused" {
+		t.Errorf("got mongodb %+v; want the error", c)
+	}
+	if c := report.Checks["slow"]; c.Status != "fail" || c.Error != context.DeadlineExceeded.Error() {
+		t.Errorf("got slow %+v; want the timeout", c)
+	}
+
+	// no trade yet, then a recent one, then a stale one
+	if code, report := get(h.LivenessHandler()); code != http.StatusServiceUnavailable || report.Checks["last_trade"].Error != "no trade yet" {
+		t.Errorf("got %v %+v; want 503 before the first trade", code, report)
+	}
+	lastTrade.Beat(time.Now())
+	if code, report := get(h.LivenessHandler()); code != http.StatusOK || report.Status != "ok" {
+		t.Errorf("got %v %+v; want 200 after a trade", code, report)
+	}
+	lastTrade.Beat(time.Now().Add(-2 * time.Minute))
+	if code, _ := get(h.LivenessHandler()); code != http.StatusServiceUnavailable {
+		t.Errorf("got %v; want 503 after a stale trade", code)
+	}
+}
+
+func TestSubscriptionCheck(t *testing.T) {
+	if err := SubscriptionCheck("unknown:channel")(context.Background()); err == nil {
+		t.Error("unknown subscription passed")
+	}
+}
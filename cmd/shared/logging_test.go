@@ -0,0 +1,139 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sets up the logging into a buffer, restored at the end of the test
+func testLogging(t *testing.T) *bytes.Buffer {
+	prev, level := slog.Default(), LogLevel.Level()
+	t.Cleanup(func() {
+		slog.SetDefault(prev)
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+		LogLevel.Set(level)
+	})
+	var buf bytes.Buffer
+	SetupLogging("test", &buf)
+	LogLevel.Set(slog.LevelInfo)
+	return &buf
+}
+
+// the JSON lines logged
+func records(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var m map[string]any
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", line, err)
+		}
+		out = append(out, m)
+	}
+	buf.Reset()
+	return out
+}
+
+func TestLogPackageBridge(t *testing.T) {
+	buf := testLogging(t)
+	log.Printf("[Debug] Loaded from DB: Price %v\n", 1.5)
+	log.Printf("[Warning] Redis Publish error: %v\n", "EOF")
+	log.Println("[Fatal][Error] Could not start")
+	log.Println("no prefix")
+
+	got := records(t, buf)
+	want := []struct{ level, msg string }{
+		{"WARN", "Redis Publish error: EOF"},
+		{"FATAL", "Could not start"},
+		{"INFO", "no prefix"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v records; want %v, debug filtered out: %v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		if got[i]["level"] != w.level || got[i]["msg"] != w.msg || got[i]["service"] != "test" {
+			t.Errorf("got %v; want %v %q of service test", got[i], w.level, w.msg)
+		}
+		if src, _ := got[i]["source"].(string); !strings.HasPrefix(src, "logging_test.go:") {
+			t.Errorf("got source %q; want logging_test.go:line", src)
+		}
+	}
+
+	NewLogger("bars", "BTCUSDT", 15*time.Second).Info("Bar closed", "price", 2.5)
+	got = records(t, buf)
+	if len(got) != 1 || got[0]["component"] != "bars" || got[0]["symbol"] != "BTCUSDT" || got[0]["resolution"] != "15s" || got[0]["price"] != 2.5 {
+		t.Errorf("got %v; want the component fields", got)
+	}
+	if src, _ := got[0]["source"].(string); !strings.HasPrefix(src, "logging_test.go:") {
+		t.Errorf("got source %q; want logging_test.go:line", src)
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	buf := testLogging(t)
+	logger := RateLimited(NewLogger("bars", "", 0), time.Hour)
+	for i := 0; i < 5; i++ {
+		logger.Warn("Discarding the trade", "i", i)
+	}
+	logger.With("extra", true).Warn("Discarding the trade") // derived loggers share the limit
+	logger.Warn("Another message")
+	logger.Debug("Disabled") // not counted
+
+	got := records(t, buf)
+	if len(got) != 2 || got[0]["msg"] != "Discarding the trade" || got[1]["msg"] != "Another message" {
+		t.Fatalf("got %v; want one line per message", got)
+	}
+
+	// suppressed count on the next line after the period
+	l := &logLimiter{every: time.Minute, seen: make(map[string]*limitState)}
+	now := time.Now()
+	l.allow("m", now)
+	l.allow("m", now.Add(time.Second))
+	l.allow("m", now.Add(2*time.Second))
+	if ok, n := l.allow("m", now.Add(time.Minute)); !ok || n != 2 {
+		t.Errorf("got %v %v; want true 2", ok, n)
+	}
+}
+
+func TestLogLevelHandler(t *testing.T) {
+	buf := testLogging(t)
+	do := func(method, query string) (int, string) {
+		rec := httptest.NewRecorder()
+		LogLevelHandler(rec, httptest.NewRequest(method, "/loglevel"+query, nil))
+		return rec.Code, strings.TrimSpace(rec.Body.String())
+	}
+
+	if code, body := do(http.MethodGet, ""); code != http.StatusOK || body != `{"level":"INFO"}` {
+		t.Errorf("got %v %v; want INFO", code, body)
+	}
+	if code, body := do(http.MethodPost, "?level=debug"); code != http.StatusOK || body != `{"level":"DEBUG"}` {
+		t.Errorf("got %v %v; want DEBUG", code, body)
+	}
+	log.Println("[Debug] now shown")
+	if code, _ := do(http.MethodPost, "?level=verbose"); code != http.StatusBadRequest {
+		t.Errorf("got %v for an unknown level; want 400", code)
+	}
+	if code, body := do(http.MethodPost, "?level=Warning"); code != http.StatusOK || body != `{"level":"WARN"}` {
+		t.Errorf("got %v %v; want WARN", code, body)
+	}
+
+	got := records(t, buf)
+	var msgs []string
+	for _, r := range got {
+		msgs = append(msgs, r["msg"].(string))
+	}
+	if strings.Join(msgs, ",") != "Log level changed,now shown,Log level changed" {
+		t.Errorf("got %v; want the changes and the debug line", msgs)
+	}
+}
@@ -0,0 +1,60 @@
+package shared
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMarginConfig(t *testing.T) {
+	c := MarginConfig{AllowShort: true, MaxLeverage: 3, InitialMargin: 0.5, MaintenanceMargin: 0.1, BorrowRate: 0.1}
+
+	// initial margin limits the leverage to 2
+	if got := c.MaxShortQty(1000, 100); got != 20 {
+		t.Errorf("got max short qty %v; want 20", got)
+	}
+
+	w := Wallet{USDT: 1000}
+	w.Short(5, 100) // USDT 1500, BTC -5
+	if got := c.Interest(w, 100, yearDuration); math.Abs(got-50) > 1e-9 {
+		t.Errorf("got yearly interest %v; want 50", got)
+	}
+	// 1500 - 5p = 0.1*5p -> p = 1500/5.5
+	if got, want := c.LiquidationPrice(w), 1500/5.5; math.Abs(got-want) > 1e-9 {
+		t.Errorf("got liquidation price %v; want %v", got, want)
+	}
+	if !math.IsInf(c.LiquidationPrice(Wallet{BTC: 1}), 1) {
+		t.Errorf("got finite liquidation price for a long wallet")
+	}
+}
+
+func TestBacktestShort(t *testing.T) {
+	bars := testBars(10, 10, 10, 8, 6, 4, 6, 8, 10)
+	params := StrategyParams{SmaShortTerm: 1, SmaLongTerm: 3, Margin: MarginConfig{AllowShort: true, MaxLeverage: 1, InitialMargin: 1, BorrowRate: 0}}
+	res := Backtest(bars, 0, params, Wallet{USDT: 100})
+
+	if res.Short.Trades != 1 || res.Short.Wins != 1 {
+		t.Fatalf("got short metrics %+v; want 1 winning trade", res.Short)
+	}
+	// shorted 12.5 BTC at 8, covered at 6 on the BUY crossover
+	if math.Abs(res.Short.PnL-25) > 1e-9 {
+		t.Errorf("got short PnL %v; want 25", res.Short.PnL)
+	}
+	if res.Long.Trades != 0 {
+		t.Errorf("got %v long trades; want 0 (long position still open)", res.Long.Trades)
+	}
+}
+
+func TestBacktestLiquidation(t *testing.T) {
+	bars := testBars(10, 10, 10, 8, 8, 8, 20)
+	bars[6].FirstPrice = 8
+	params := StrategyParams{SmaShortTerm: 1, SmaLongTerm: 3, Margin: MarginConfig{AllowShort: true, MaxLeverage: 2, InitialMargin: 0.5, MaintenanceMargin: 0.1}}
+	res := Backtest(bars, 0, params, Wallet{USDT: 100})
+
+	if res.Short.Liquidations != 1 {
+		t.Fatalf("got %v liquidations; want 1", res.Short.Liquidations)
+	}
+	// 12.5 BTC shorted at 8: 200 USDT / (12.5 * 1.1)
+	if got, want := res.Trades[0].ExitPrice, 200/13.75; math.Abs(got-want) > 1e-9 {
+		t.Errorf("got liquidation at %v; want %v", got, want)
+	}
+}
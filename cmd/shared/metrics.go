@@ -0,0 +1,94 @@
+package shared
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// resolution label of the metrics of the trade stream, before the aggregation into bars
+const TradeResolution = "trade"
+
+// labels of the pipeline metrics, every one has the symbol and the resolution
+var pipelineLabels = []string{"symbol", "resolution"}
+
+func withPipelineLabels(labels ...string) []string {
+	return append(labels, pipelineLabels...)
+}
+
+// latency of each pipeline stage:
+// receive (trade time to the fetcher), publish, unmarshal, aggregate (per trade), bar_emit (bar end to its processing), store, indicator, strategy
+var StageLatency = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "tradebot_stage_latency_seconds",
+		Help:    "Latency of each pipeline stage",
+		Buckets: []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}, // 1 and 5 are SLO thresholds
+	},
+	withPipelineLabels("stage"),
+)
+
+// messages waiting in the buffers between the stages, e.g. of a Redis subscription
+var QueueDepth = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "tradebot_queue_depth",
+		Help: "Messages waiting in a pipeline queue",
+	},
+	withPipelineLabels("queue"),
+)
+
+var BarTrades = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "tradebot_bar_trades",
+		Help:    "Trades aggregated into each bar",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 8), // 1 to 16384
+	},
+	pipelineLabels,
+)
+
+var EmptyBars = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "tradebot_empty_bars_total",
+		Help: "Periods without a trade, no bar is emitted for them",
+	},
+	pipelineLabels,
+)
+
+var InterpolatedBars = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "tradebot_interpolated_bars_total",
+		Help: "Missing bars linearly interpolated for the SMAs",
+	},
+	pipelineLabels,
+)
+
+// trades lost by reason: late, invalid, marshal, unmarshal or publish
+var DroppedTrades = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "tradebot_dropped_trades_total",
+		Help: "Trades dropped by the pipeline by reason",
+	},
+	withPipelineLabels("reason"),
+)
+
+var MongoWriteErrors = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "tradebot_mongo_write_errors_total",
+		Help: "Failed MongoDB writes by collection",
+	},
+	withPipelineLabels("collection"),
+)
+
+// registered by InitCommon. series appear once a service uses them
+var PipelineMetrics = []prometheus.Collector{StageLatency, QueueDepth, BarTrades, EmptyBars, InterpolatedBars, DroppedTrades, MongoWriteErrors}
+
+// symbol and resolution of the messages of a Redis channel
+func channelLabels(channel string) (string, string) {
+	if channel == RedisChannel {
+		return Symbol, TradeResolution
+	}
+	return Symbol, AggregatePeriod.String()
+}
+
+func ObserveStage(stage, symbol, resolution string, start time.Time) {
+	StageLatency.WithLabelValues(stage, symbol, resolution).Observe(time.Since(start).Seconds())
+}
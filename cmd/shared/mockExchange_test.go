@@ -0,0 +1,168 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBinanceExecutorOnMockExchange(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	m := NewMockExchange(map[string]float64{"USDT": 1000})
+	m.MaxParticipation = 1 // fills up to the trade quantity
+	server := httptest.NewServer(m)
+	defer server.Close()
+	e := NewBinanceExecutor("key", "secret", server.URL)
+
+	if _, err := e.PlaceOrder(ctx, "BTCUSDT", Order{Side: SideBuy, Type: OrderTypeMarket, Quantity: 1}); err == nil {
+		t.Errorf("market order without a trade price: got no error")
+	}
+	m.OnTrade("BTCUSDT", start, 100, 5)
+
+	limit, err := e.PlaceOrder(ctx, "BTCUSDT", Order{Side: SideBuy, Type: OrderTypeLimit, TimeInForce: TimeInForceGTC, Quantity: 2, LimitPrice: 95})
+	if err != nil {
+		t.Fatalf("cannot place limit order: %v", err)
+	}
+	if limit.ID == 0 || limit.ClientOrderID == "" || limit.Status != OrderStatusNew {
+		t.Errorf("got %+v; want a NEW order with ids", limit)
+	}
+	if _, err := e.PlaceOrder(ctx, "BTCUSDT", Order{Side: SideBuy, Type: OrderTypeLimit, TimeInForce: TimeInForceGTC, Quantity: 10, LimitPrice: 95}); err == nil {
+		t.Errorf("order over the free balance: got no error")
+	}
+	balances, err := e.Balances(ctx)
+	if err != nil {
+		t.Fatalf("cannot get balances: %v", err)
+	}
+	if b := balances["USDT"]; b.Free != 810 || b.Locked != 190 {
+		t.Errorf("got USDT %+v; want 810 free, 190 locked", b)
+	}
+
+	m.OnTrade("BTCUSDT", start.Add(time.Second), 94, 1)
+	o, err := e.QueryOrder(ctx, "BTCUSDT", limit.ClientOrderID)
+	if err != nil {
+		t.Fatalf("cannot query order: %v", err)
+	}
+	if o.Status != OrderStatusPartiallyFilled || o.FilledQty != 1 || o.AvgPrice != 94 {
+		t.Errorf("got %v %v at %v; want PARTIALLY_FILLED 1 at 94", o.Status, o.FilledQty, o.AvgPrice)
+	}
+	open, err := e.OpenOrders(ctx, "BTCUSDT")
+	if err != nil || len(open) != 1 {
+		t.Errorf("got %v open orders, %v; want 1", len(open), err)
+	}
+
+	canceled, err := e.CancelOrder(ctx, "BTCUSDT", limit.ClientOrderID)
+	if err != nil || canceled.Status != OrderStatusCanceled {
+		t.Errorf("got %v, %v; want CANCELED", canceled.Status, err)
+	}
+	if _, err := e.CancelOrder(ctx, "BTCUSDT", "unknown"); err == nil {
+		t.Errorf("cancel of an unknown order: got no error")
+	}
+	balances, _ = e.Balances(ctx)
+	if b := balances["USDT"]; b.Free != 906 || b.Locked != 0 {
+		t.Errorf("got USDT %+v; want 906 free, 0 locked", b)
+	}
+	if b := balances["BTC"]; b.Free != 1 {
+		t.Errorf("got BTC %+v; want 1 free", b)
+	}
+}
+
+func TestTraderWithExecutor(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	m := NewMockExchange(map[string]float64{"USDT": 1000})
+	params := StrategyParams{Sizing: DefaultSizingConfig(), Exits: ExitRules{StopLoss: 0.1}, Orders: OrderConfig{EntryType: OrderTypeMarket}}
+	trader := NewTrader(params, Wallet{USDT: 1000})
+	trader.Executor = m
+	trader.Symbol = "BTCUSDT"
+
+	m.OnTrade("BTCUSDT", start, 100, 0)
+	trader.OnSignal(SideBuy, 100, start)
+	if len(trader.LiveOrders) != 1 || trader.EntryOrderID == 0 {
+		t.Fatalf("got %v live orders, entry %v; want the entry order placed", len(trader.LiveOrders), trader.EntryOrderID)
+	}
+	m.OnTrade("BTCUSDT", start.Add(time.Second), 100, 0)
+	if err := trader.SyncOrders(ctx, start.Add(time.Second)); err != nil {
+		t.Fatalf("cannot sync orders: %v", err)
+	}
+	if trader.Wallet.BTC != 10 || trader.EntryOrderID != 0 || len(trader.LiveOrders) != 0 {
+		t.Fatalf("got %+v, entry %v, %v live orders; want 10 BTC and no open orders", trader.Wallet, trader.EntryOrderID, len(trader.LiveOrders))
+	}
+
+	// the stop-loss places a market exit instead of closing instantly
+	trader.OnTrade(start.Add(2*time.Second), 89, 0)
+	if trader.Wallet.BTC != 10 || trader.ExitOrderID == 0 || trader.ExitReason != ExitReasonStopLoss {
+		t.Fatalf("got %+v, exit %v %v; want a stop_loss exit order", trader.Wallet, trader.ExitOrderID, trader.ExitReason)
+	}
+	trader.OnTrade(start.Add(3*time.Second), 88, 0) // no second exit order
+	if len(trader.LiveOrders) != 1 {
+		t.Errorf("got %v live orders; want 1", len(trader.LiveOrders))
+	}
+	m.OnTrade("BTCUSDT", start.Add(4*time.Second), 88, 0)
+	trader.SyncOrders(ctx, start.Add(4*time.Second))
+	if trader.Wallet.BTC != 0 || trader.Wallet.USDT != 880 {
+		t.Errorf("got %+v; want 880 USDT", trader.Wallet)
+	}
+	if len(trader.Trades) != 1 || trader.Trades[0].ExitReason != ExitReasonStopLoss {
+		t.Errorf("got trades %+v; want one stop_loss trade", trader.Trades)
+	}
+	balances, _ := m.Balances(ctx)
+	if balances["USDT"].Free != 880 || balances["BTC"].Free != 0 {
+		t.Errorf("got exchange balances %+v; want 880 USDT", balances)
+	}
+}
+
+func TestBinanceExecutorFilters(t *testing.T) {
+	ctx := context.Background()
+	m := NewMockExchange(map[string]float64{"USDT": 1000})
+	m.OnTrade("BTCUSDT", time.Now(), 100, 0)
+	server := httptest.NewServer(m)
+	defer server.Close()
+	e := NewBinanceExecutor("key", "secret", server.URL)
+
+	placed, err := e.PlaceOrder(ctx, "BTCUSDT", Order{Side: SideBuy, Type: OrderTypeLimit, TimeInForce: TimeInForceGTC, Quantity: 0.123456789, LimitPrice: 95.1234})
+	if err != nil {
+		t.Fatalf("cannot place limit order: %v", err)
+	}
+	o, _ := m.QueryOrder(ctx, "BTCUSDT", placed.ClientOrderID)
+	if o.Quantity != 0.12345 || o.LimitPrice != 95.12 {
+		t.Errorf("got %v at %v on the exchange; want 0.12345 at 95.12", o.Quantity, o.LimitPrice)
+	}
+
+	for _, order := range []Order{
+		{Side: SideBuy, Type: OrderTypeMarket, Quantity: 0.000001},                                         // below the step
+		{Side: SideBuy, Type: OrderTypeLimit, TimeInForce: TimeInForceGTC, Quantity: 0.01, LimitPrice: 95}, // below the notional
+	} {
+		if _, err := e.PlaceOrder(ctx, "BTCUSDT", order); !errors.Is(err, ErrOrderRejected) {
+			t.Errorf("got %v for %+v; want a rejection", err, order)
+		}
+	}
+}
+
+func TestMockExchangeFillAboveLockedPrice(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	m := NewMockExchange(map[string]float64{"USDT": 1050})
+	m.OnTrade("BTCUSDT", start, 100, 0)
+
+	// 1000 locked at 100, the other 50 cover a fill at 105
+	covered, _ := m.PlaceOrder(ctx, "BTCUSDT", Order{Side: SideBuy, Type: OrderTypeMarket, Quantity: 10})
+	m.OnTrade("BTCUSDT", start.Add(time.Second), 105, 0)
+	balances, _ := m.Balances(ctx)
+	if o, _ := m.QueryOrder(ctx, "BTCUSDT", covered.ClientOrderID); o.Status != OrderStatusFilled || balances["USDT"].Free != 0 || balances["BTC"].Free != 10 {
+		t.Errorf("got %v, %+v; want filled at 105 with the whole balance", o.Status, balances)
+	}
+
+	// nothing left to cover a fill above the locked price
+	m.OnTrade("BTCUSDT", start.Add(2*time.Second), 100, 0)
+	m.PlaceOrder(ctx, "BTCUSDT", Order{Side: SideSell, Type: OrderTypeMarket, Quantity: 10})
+	m.OnTrade("BTCUSDT", start.Add(3*time.Second), 100, 0)
+	uncovered, _ := m.PlaceOrder(ctx, "BTCUSDT", Order{Side: SideBuy, Type: OrderTypeMarket, Quantity: 10})
+	m.OnTrade("BTCUSDT", start.Add(4*time.Second), 110, 0)
+	balances, _ = m.Balances(ctx)
+	if o, _ := m.QueryOrder(ctx, "BTCUSDT", uncovered.ClientOrderID); o.Status != OrderStatusCanceled || balances["USDT"].Free != 1000 || balances["USDT"].Locked != 0 {
+		t.Errorf("got %v, %+v; want canceled and the funds released", o.Status, balances)
+	}
+}
@@ -0,0 +1,94 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// compares the stored open orders, the orders and the wallet of the trader with the view of its executor,
+// at startup before trading resumes. stored records are updated to the executor's view, fills missed
+// while the process was down are applied. returns the mismatches that need attention.
+func Reconcile(ctx context.Context, trader *Trader, at time.Time) ([]string, error) {
+	if trader.Executor == nil || trader.Store == nil {
+		return nil, nil
+	}
+	var mismatches []string
+	tracked := map[string]bool{}
+	for _, o := range trader.LiveOrders {
+		tracked[o.ClientOrderID] = true
+	}
+
+	records, err := trader.Store.OpenOrders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stored := map[string]bool{}
+	for _, rec := range records {
+		stored[rec.ClientOrderID] = true
+		o, err := trader.Executor.QueryOrder(ctx, rec.Symbol, rec.ClientOrderID)
+		if errors.Is(err, ErrOrderNotFound) {
+			// an order stored as new may not have reached the exchange before the restart
+			if rec.State != OrderStateNew {
+				mismatches = append(mismatches, fmt.Sprintf("order %v is %v in the store but unknown to the exchange", rec.ClientOrderID, rec.State))
+			}
+			rec.State, rec.Reason, rec.UpdatedAt = OrderStateRejected, "not found on the exchange at reconciliation", time.Now()
+			if err := trader.Store.Save(ctx, rec); err != nil {
+				return mismatches, err
+			}
+			trader.dropLiveOrder(rec.ClientOrderID)
+			continue
+		}
+		if err != nil {
+			return mismatches, err
+		}
+
+		if state := OrderStateOf(o.Status); state != rec.State || o.FilledQty != rec.FilledQty {
+			updated := NewOrderRecord(rec.Symbol, o, state, "")
+			updated.CreatedAt = rec.CreatedAt
+			if err := trader.Store.Save(ctx, updated); err != nil {
+				return mismatches, err
+			}
+		}
+		if !tracked[rec.ClientOrderID] && o.IsOpen() {
+			mismatches = append(mismatches, fmt.Sprintf("order %v is open on the exchange but not tracked by the trader", rec.ClientOrderID))
+		}
+	}
+
+	open, err := trader.Executor.OpenOrders(ctx, trader.Symbol)
+	if err != nil {
+		return mismatches, err
+	}
+	for _, o := range open {
+		if !stored[o.ClientOrderID] && !tracked[o.ClientOrderID] {
+			mismatches = append(mismatches, fmt.Sprintf("order %v (%v %v %v) is open on the exchange but not in the store", o.ClientOrderID, o.Side, o.Type, o.Quantity))
+		}
+	}
+
+	// fills missed while down, then the position
+	if err := trader.SyncOrders(ctx, at); err != nil {
+		return mismatches, err
+	}
+	balances, err := trader.Executor.Balances(ctx)
+	if err != nil {
+		return mismatches, err
+	}
+	base, quote, err := splitSymbol(trader.Symbol)
+	if err != nil {
+		return mismatches, err
+	}
+	if b := balances[base]; !closeEnough(b.Free+b.Locked, trader.Wallet.BTC) {
+		mismatches = append(mismatches, fmt.Sprintf("%v balance is %v on the exchange, %v in the wallet", base, b.Free+b.Locked, trader.Wallet.BTC))
+	}
+	if b := balances[quote]; !closeEnough(b.Free+b.Locked, trader.Wallet.USDT) {
+		mismatches = append(mismatches, fmt.Sprintf("%v balance is %v on the exchange, %v in the wallet", quote, b.Free+b.Locked, trader.Wallet.USDT))
+	}
+	return mismatches, nil
+}
+
+// equal within the rounding of the exchange
+func closeEnough(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-8*math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+}
@@ -0,0 +1,154 @@
+package shared
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// OrderStore in memory, keeps the last record of each order
+type memoryOrderStore map[string]OrderRecord
+
+func (s memoryOrderStore) Save(ctx context.Context, rec OrderRecord) error {
+	s[rec.ClientOrderID] = rec
+	return nil
+}
+
+func (s memoryOrderStore) OpenOrders(ctx context.Context) ([]OrderRecord, error) {
+	var open []OrderRecord
+	for _, rec := range s {
+		if IsOpenOrderState(rec.State) {
+			open = append(open, rec)
+		}
+	}
+	return open, nil
+}
+
+func TestOrderLifecycle(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewMockExchange(map[string]float64{"USDT": 1000})
+	m.MaxParticipation = 1
+	store := memoryOrderStore{}
+	trader := NewTrader(StrategyParams{Sizing: DefaultSizingConfig(), Orders: OrderConfig{EntryType: OrderTypeMarket}}, Wallet{USDT: 1000})
+	trader.Executor, trader.Symbol, trader.Store = m, "BTCUSDT", store
+
+	m.OnTrade("BTCUSDT", start, 100, 0)
+	trader.OnSignal(SideBuy, 100, start)
+	id := trader.LiveOrders[0].ClientOrderID
+	if store[id].State != OrderStateAcknowledged || store[id].ExchangeID == 0 {
+		t.Errorf("got %+v; want an acknowledged record", store[id])
+	}
+	m.OnTrade("BTCUSDT", start.Add(time.Second), 100, 4)
+	trader.SyncOrders(context.Background(), start.Add(time.Second))
+	if store[id].State != OrderStatePartiallyFilled || store[id].FilledQty != 4 {
+		t.Errorf("got %+v; want partially filled 4", store[id])
+	}
+	m.OnTrade("BTCUSDT", start.Add(2*time.Second), 100, 10)
+	trader.SyncOrders(context.Background(), start.Add(2*time.Second))
+	if store[id].State != OrderStateFilled || trader.Wallet.BTC != 10 {
+		t.Errorf("got %+v, %+v; want filled and 10 BTC", store[id], trader.Wallet)
+	}
+
+	// rejected by the exchange
+	trader.Risk.Resume()
+	if trader.submit(Order{Side: SideBuy, Type: OrderTypeMarket, Quantity: 100, CreatedAt: start}) != 0 {
+		t.Errorf("order over the balance was placed")
+	}
+	rejected := 0
+	for _, rec := range store {
+		if rec.State == OrderStateRejected && rec.Reason != "" {
+			rejected++
+		}
+	}
+	if rejected != 1 {
+		t.Errorf("got %v rejected records; want 1", rejected)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	m := NewMockExchange(map[string]float64{"USDT": 1000})
+	store := memoryOrderStore{}
+	params := StrategyParams{Sizing: DefaultSizingConfig(), Orders: OrderConfig{EntryType: OrderTypeLimit, EntryOffset: 0.1}}
+	trader := NewTrader(params, Wallet{USDT: 1000})
+	trader.Executor, trader.Symbol, trader.Store = m, "BTCUSDT", store
+
+	m.OnTrade("BTCUSDT", start, 100, 0)
+	trader.OnSignal(SideBuy, 100, start)
+	saved := *trader // the account as persisted
+
+	// in flight at the restart: never sent, sent but not saved, and a fill while down
+	store.Save(ctx, OrderRecord{ClientOrderID: "lost", Symbol: "BTCUSDT", State: OrderStateNew})
+	store.Save(ctx, OrderRecord{ClientOrderID: "gone", Symbol: "BTCUSDT", State: OrderStateAcknowledged})
+	m.PlaceOrder(ctx, "BTCUSDT", Order{ClientOrderID: "untracked", Side: SideBuy, Type: OrderTypeLimit, Quantity: 0.1, LimitPrice: 50})
+	m.OnTrade("BTCUSDT", start.Add(time.Minute), 89, 0)
+
+	restarted := saved
+	restarted.Wallet.USDT -= 100 // drifted from the exchange
+	restarted.Init()
+	mismatches, err := Reconcile(ctx, &restarted, start.Add(2*time.Minute))
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	want := []string{"gone", "untracked", "USDT balance"}
+	if len(mismatches) != len(want) {
+		t.Errorf("got mismatches %q; want %v", mismatches, len(want))
+	}
+	for i, w := range want {
+		if i < len(mismatches) && !strings.Contains(mismatches[i], w) {
+			t.Errorf("mismatch %v: got %q; want it about %v", i, mismatches[i], w)
+		}
+	}
+	if store["lost"].State != OrderStateRejected || store["gone"].State != OrderStateRejected {
+		t.Errorf("got lost %v, gone %v; want both rejected", store["lost"].State, store["gone"].State)
+	}
+	if restarted.Wallet.BTC != 10 || restarted.EntryOrderID != 0 {
+		t.Errorf("got %+v, entry %v; want the fill while down applied", restarted.Wallet, restarted.EntryOrderID)
+	}
+}
+
+// places the orders but loses the responses
+type timeoutExecutor struct {
+	*MockExchange
+}
+
+func (e timeoutExecutor) PlaceOrder(ctx context.Context, symbol string, order Order) (Order, error) {
+	e.MockExchange.PlaceOrder(ctx, symbol, order)
+	return order, context.DeadlineExceeded
+}
+
+func TestUnknownOrderStatus(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	m := NewMockExchange(map[string]float64{"USDT": 1000})
+	store := memoryOrderStore{}
+	trader := NewTrader(StrategyParams{Sizing: DefaultSizingConfig(), Orders: OrderConfig{EntryType: OrderTypeLimit, EntryOffset: 0.1}}, Wallet{USDT: 1000})
+	trader.Executor, trader.Symbol, trader.Store = timeoutExecutor{m}, "BTCUSDT", store
+
+	m.OnTrade("BTCUSDT", start, 100, 0)
+	trader.OnSignal(SideBuy, 100, start)
+	if len(store) != 1 {
+		t.Fatalf("got %v records; want 1", len(store))
+	}
+	var id string
+	for id = range store {
+	}
+	if rec := store[id]; rec.State != OrderStateNew || rec.Reason == "" {
+		t.Errorf("got %v %q; want a new record with the error", rec.State, rec.Reason)
+	}
+
+	// the order reached the exchange, reconciliation finds it by its client order ID
+	trader.Executor = m
+	mismatches, err := Reconcile(ctx, trader, start.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if store[id].State != OrderStateAcknowledged {
+		t.Errorf("got %v; want the exchange's state", store[id].State)
+	}
+	if len(mismatches) == 0 || !strings.Contains(mismatches[0], id) {
+		t.Errorf("got mismatches %q; want the untracked order %v", mismatches, id)
+	}
+}
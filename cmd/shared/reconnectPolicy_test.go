@@ -0,0 +1,154 @@
+package shared
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestPolicy() *ReconnectPolicy {
+	return &ReconnectPolicy{
+		BaseDelay:        time.Second,
+		MaxDelay:         8 * time.Second,
+		Jitter:           0.5,
+		Budget:           3,
+		BudgetWindow:     time.Minute,
+		FailureThreshold: 5,
+		OpenTime:         time.Minute,
+		StableAfter:      time.Minute,
+	}
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	p := newTestPolicy()
+	p.Budget = 100
+	now := time.Now()
+	if d := p.Reserve(now); d != 0 {
+		t.Errorf("got wait %v before any failure; want 0", d)
+	}
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second} {
+		p.Failure(now)
+		// the jitter takes up to half of the backoff
+		if d := p.Delay(now); d > want || d < want/2 {
+			t.Errorf("failure %v: got wait %v; want %v to %v", i+1, d, want/2, want)
+		}
+	}
+	// a connection lasting StableAfter resets the backoff
+	p.Closed(now, time.Minute)
+	if d := p.Delay(now); d != 0 {
+		t.Errorf("got wait %v after a stable connection; want 0", d)
+	}
+	// one dropping before is a failure
+	p.Closed(now, time.Second)
+	if d := p.Delay(now); d == 0 {
+		t.Error("no backoff after a connection dropped at once")
+	}
+}
+
+// the backoff stays within MaxDelay however long it fails, for any MaxDelay
+func TestReconnectBackoffOverflow(t *testing.T) {
+	for _, maxDelay := range []time.Duration{8 * time.Second, 24 * time.Hour, time.Duration(math.MaxInt64)} {
+		p := newTestPolicy()
+		p.MaxDelay, p.Jitter, p.FailureThreshold = maxDelay, 0, math.MaxInt
+		now := time.Now()
+		for i := 1; i <= 100; i++ {
+			p.Failure(now)
+			p.mu.Lock()
+			d := p.retryAt.Sub(now)
+			p.mu.Unlock()
+			want := maxDelay
+			if i <= 34 { // 1s<<33 is the last one below MaxInt64
+				want = min(time.Second<<(i-1), maxDelay)
+			}
+			if d != want {
+				t.Fatalf("max %v, failure %v: got backoff %v; want %v", maxDelay, i, d, want)
+			}
+		}
+	}
+}
+
+func TestReconnectBudget(t *testing.T) {
+	p := newTestPolicy()
+	now := time.Now()
+	for i := range 3 {
+		if d := p.Reserve(now.Add(time.Duration(i) * time.Second)); d != 0 {
+			t.Fatalf("connection %v: got wait %v; want 0 within the budget", i+1, d)
+		}
+	}
+	if d := p.Reserve(now.Add(10 * time.Second)); d != 50*time.Second {
+		t.Errorf("got wait %v; want 50s until the first connection leaves the window", d)
+	}
+	if err := p.Check()(context.Background()); err == nil || !strings.Contains(err.Error(), "budget of 3") {
+		t.Errorf("got %v; want the exhausted budget on the health check", err)
+	}
+	if d := p.Reserve(now.Add(time.Minute)); d != 0 {
+		t.Errorf("got wait %v once the first connection left the window; want 0", d)
+	}
+	if n := p.Status(now.Add(time.Minute)).Connections; n != 3 {
+		t.Errorf("got %v connections in the window; want never more than the budget of 3", n)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	p := newTestPolicy()
+	p.Budget = 100
+	now := time.Now()
+	for range 5 {
+		p.Failure(now)
+	}
+	if s := p.Status(now); s.State != "open" || s.RetryIn != 60 {
+		t.Errorf("got %+v; want open for a minute after 5 failures", s)
+	}
+	p.mu.Lock()
+	p.openUntil = time.Now() // the health check runs at the current time
+	p.mu.Unlock()
+	if err := p.Check()(context.Background()); err != nil {
+		t.Errorf("got %v once half open; want ok", err)
+	}
+	// reading the status does not start the trial
+	p.mu.Lock()
+	state := p.state
+	p.mu.Unlock()
+	if state != CircuitOpen {
+		t.Errorf("got %v after reading the status; want open until a connection is reserved", state)
+	}
+
+	// one trial when half open, a failed one opens the circuit again
+	now = now.Add(time.Minute)
+	if d := p.Reserve(now); d != 0 || p.Status(now).State != "half-open" {
+		t.Fatalf("got wait %v, %v; want the trial of the half open circuit", d, p.Status(now).State)
+	}
+	if d := p.Reserve(now); d == 0 {
+		t.Error("second connection allowed during the trial")
+	}
+	p.Failure(now)
+	if s := p.Status(now); s.State != "open" {
+		t.Errorf("got %v after the failed trial; want open", s.State)
+	}
+	p.mu.Lock()
+	p.openUntil = time.Now().Add(time.Minute)
+	p.mu.Unlock()
+	if err := p.Check()(context.Background()); err == nil || !strings.Contains(err.Error(), "circuit open") {
+		t.Errorf("got %v; want the open circuit on the health check", err)
+	}
+
+	// a succeeded trial closes it
+	now = now.Add(2 * time.Minute)
+	p.Reserve(now)
+	p.Success()
+	if s := p.Status(now); s.State != "closed" {
+		t.Errorf("got %v after the succeeded trial; want closed", s.State)
+	}
+}
+
+func TestReconnectWait(t *testing.T) {
+	p := newTestPolicy()
+	p.Failure(time.Now())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if p.Wait(ctx) {
+		t.Error("reserved a connection during the backoff after quit")
+	}
+}
@@ -0,0 +1,111 @@
+package shared
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func UnmarshalTradeDatePrice(inp chan string) chan TradeDatePrice {
+	out := make(chan TradeDatePrice)
+	go func() {
+		defer close(out)
+		for msg := range inp {
+			start := time.Now()
+			var msgStruct TradeDatePrice
+			err := json.Unmarshal([]byte(msg), &msgStruct)
+			if err != nil {
+				log.Println("[Warning] Failed to unmarshal to TradeDatePrice. Skipping the data. Error::", err)
+				DroppedTrades.WithLabelValues("unmarshal", Symbol, TradeResolution).Inc()
+				continue
+			}
+			ObserveStage("unmarshal", Symbol, TradeResolution, start)
+			// the next stage continues the trace from this span
+			ctx, span := tracer.Start(TraceContext(msgStruct.Trace), "unmarshal", trace.WithTimestamp(start))
+			msgStruct.Trace = TraceCarrier(ctx)
+			span.End()
+			out <- msgStruct
+		}
+	}()
+	return out
+}
+
+// publishes the signal as JSON to SignalChannel and appends it to SignalStream
+func PublishSignal(ctx context.Context, rdb *redis.Client, signal TradeSignal) error {
+	data, err := json.Marshal(signal)
+	if err != nil {
+		return err
+	}
+	if err := rdb.Publish(ctx, SignalChannel, data).Err(); err != nil {
+		return err
+	}
+	return rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: SignalStream,
+		MaxLen: SignalStreamLen,
+		Approx: true,
+		Values: map[string]any{"signal": data},
+	}).Err()
+}
+
+// publishes v as JSON to channel
+func PublishJSON(ctx context.Context, rdb *redis.Client, channel string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return rdb.Publish(ctx, channel, data).Err()
+}
+
+// accepts redis channel name to connect. returns redis message receive channel, closed when ctx is done.
+// the client reconnects by itself when the connection drops. the state is checked by SubscriptionCheck
+func SubscribeRedis(ctx context.Context, subCh string) chan string {
+	var rdb = redis.NewClient(&redis.Options{
+		Addr: RedisAddress,
+	})
+	subscribed := &atomic.Bool{}
+	redisSubscriptions.Store(subCh, subscribed)
+	out := make(chan string)
+	go func() {
+		defer close(out)
+		defer rdb.Close()
+		defer subscribed.Store(false)
+		pubsub := rdb.Subscribe(ctx, subCh)
+		defer pubsub.Close()
+		ch := pubsub.ChannelWithSubscriptions()
+		symbol, resolution := channelLabels(subCh)
+		depth := QueueDepth.WithLabelValues("redis "+subCh, symbol, resolution) // buffered by the client
+
+		for {
+			select {
+			case v := <-ch:
+				depth.Set(float64(len(ch)))
+				var payload string
+				switch v := v.(type) {
+				case *redis.Subscription:
+					subscribed.Store(v.Kind == "subscribe")
+					continue
+				case *redis.Message:
+					payload = v.Payload
+				default:
+					continue
+				}
+				select {
+				case out <- payload:
+				case <-ctx.Done():
+					log.Println("[Info] Stopping subscription:", subCh)
+					return
+				}
+
+			case <-ctx.Done():
+				log.Println("[Info] Stopping subscription:", subCh)
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,110 @@
+package shared
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRiskManagerCheck(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	r := RiskManager{Limits: RiskLimits{MaxPosition: 2, MaxOrderNotional: 500, MaxOrdersPerMinute: 2, MaxDailyLoss: 0.05, MaxDrawdown: 0.2}}
+	r.OnEquity(1000, start)
+
+	cases := []struct {
+		qty, position float64
+		want          string
+	}{
+		{1, 0, ""},
+		{-3, 0, RiskRejectMaxPosition},
+		{1, 1.5, RiskRejectMaxPosition},
+		{-6, 5, RiskRejectMaxNotional},
+	}
+	for _, c := range cases {
+		if got := r.Check(c.qty, 100, c.position, 1000, start); got != c.want {
+			t.Errorf("Check(%v, position %v) = %q; want %q", c.qty, c.position, got, c.want)
+		}
+	}
+
+	r.RecordOrder(start)
+	r.RecordOrder(start.Add(10 * time.Second))
+	if got := r.Check(1, 100, 0, 1000, start.Add(30*time.Second)); got != RiskRejectOrderRate {
+		t.Errorf("got %q; want %q", got, RiskRejectOrderRate)
+	}
+	if got := r.Check(1, 100, 0, 1000, start.Add(61*time.Second)); got != "" {
+		t.Errorf("got %q after a minute; want none", got)
+	}
+
+	// daily loss resets on the next UTC day
+	r.OnEquity(940, start.Add(time.Hour))
+	if got := r.Check(1, 100, 0, 940, start.Add(time.Hour)); got != RiskRejectDailyLoss {
+		t.Errorf("got %q; want %q", got, RiskRejectDailyLoss)
+	}
+	next := start.Add(24 * time.Hour)
+	r.OnEquity(940, next)
+	if got := r.Check(1, 100, 0, 940, next); got != "" {
+		t.Errorf("got %q on the next day; want none", got)
+	}
+
+	// drawdown cutoff holds until Resume
+	r.OnEquity(790, next.Add(time.Hour))
+	r.OnEquity(900, next.Add(2*time.Hour))
+	if got := r.Check(1, 100, 0, 900, next.Add(2*time.Hour)); got != RiskRejectMaxDrawdown {
+		t.Errorf("got %q; want %q", got, RiskRejectMaxDrawdown)
+	}
+	r.Resume()
+	r.OnEquity(900, next.Add(3*time.Hour))
+	if r.Killed || r.PeakEquity != 900 {
+		t.Errorf("after Resume got killed %v, peak %v; want false, 900", r.Killed, r.PeakEquity)
+	}
+
+	r.Kill(RiskRejectKillSwitch)
+	if got := r.Check(0.1, 100, 0, 900, next.Add(3*time.Hour)); got != RiskRejectKillSwitch {
+		t.Errorf("got %q; want %q", got, RiskRejectKillSwitch)
+	}
+}
+
+func TestTraderRiskRejection(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	params := StrategyParams{Sizing: DefaultSizingConfig(), Risk: RiskLimits{MaxOrderNotional: 500}}
+	trader := NewTrader(params, Wallet{USDT: 1000})
+
+	if got := trader.OnSignal(SideBuy, 100, start); got != RiskRejectMaxNotional || trader.Wallet.BTC != 0 {
+		t.Errorf("got %q, %+v; want %q and no position", got, trader.Wallet, RiskRejectMaxNotional)
+	}
+
+	// exits are not blocked
+	trader.Params.Risk.MaxOrderNotional = 0
+	trader.Init()
+	if got := trader.OnSignal(SideBuy, 100, start); got != "" || trader.Wallet.BTC != 10 {
+		t.Fatalf("got %q, %+v; want 10 BTC", got, trader.Wallet)
+	}
+	trader.Kill(RiskRejectKillSwitch, start)
+	trader.OnSignal(SideSell, 110, start.Add(time.Minute))
+	if trader.Wallet.BTC != 0 || trader.Wallet.USDT != 1100 {
+		t.Errorf("got %+v; want the long closed at 110", trader.Wallet)
+	}
+	if got := trader.OnSignal(SideBuy, 100, start.Add(2*time.Minute)); got != RiskRejectKillSwitch {
+		t.Errorf("got %q; want %q", got, RiskRejectKillSwitch)
+	}
+}
+
+func TestTraderPositionBefore(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	params := StrategyParams{Sizing: DefaultSizingConfig(), Orders: OrderConfig{EntryType: OrderTypeLimit}, Risk: RiskLimits{MaxPosition: 1.5}}
+	trader := NewTrader(params, Wallet{USDT: 1000})
+	trader.EntryOrderID = trader.Engine.Submit(Order{Side: SideBuy, Type: OrderTypeLimit, Quantity: 1, LimitPrice: 100, CreatedAt: start}).ID
+	trader.Engine.Orders[0].FilledQty = 0.4
+	trader.openFill(false, 0.4, 100, start)
+
+	// the filled part and the rest of the entry in flight count
+	if got := trader.positionBefore(SideBuy); got != 1 {
+		t.Errorf("got %v; want the 0.4 filled and 0.6 in flight", got)
+	}
+	if got := trader.Risk.Check(1, 100, trader.positionBefore(SideBuy), 1000, start); got != RiskRejectMaxPosition {
+		t.Errorf("got %q; want %q for a second entry of 1 BTC", got, RiskRejectMaxPosition)
+	}
+	// a long position is closed before a short entry
+	if got := trader.positionBefore(SideSell); got != 0 {
+		t.Errorf("got %v; want 0 for a short entry", got)
+	}
+}
@@ -0,0 +1,101 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShutdownPhases(t *testing.T) {
+	s := NewShutdownOrchestrator()
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) {
+		mu.Lock()
+		order = append(order, name)
+		mu.Unlock()
+	}
+
+	// registered out of order, stopped by phase
+	s.Register(PhaseCloseConnections, "db", func(context.Context) error {
+		record("db")
+		return nil
+	})
+	ingest := s.Context(PhaseStopIngest, "subscription")
+	ctx, done := s.Add(PhaseDrainPipeline, "pipeline")
+	go func() {
+		<-ingest.Done()
+		record("subscription")
+		<-ctx.Done()
+		record("pipeline")
+		done()
+	}()
+	_, exited := s.Add(PhaseDrainPipeline, "exited early")
+	exited() // must not block the shutdown
+	exited()
+	s.Register(PhaseFlushStorage, "storage", func(context.Context) error {
+		record("storage")
+		return nil
+	})
+
+	report := s.Shutdown()
+	if len(report.Failed) != 0 {
+		t.Errorf("got failures %+v; want none", report.Failed)
+	}
+	want := []string{"subscription", "pipeline", "storage", "db"}
+	if len(order) != len(want) {
+		t.Fatalf("got stop order %v; want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("got stop order %v; want %v", order, want)
+		}
+	}
+	select {
+	case <-s.Done:
+	default:
+		t.Error("Done not closed after the shutdown")
+	}
+}
+
+func TestShutdownFailures(t *testing.T) {
+	s := NewShutdownOrchestrator()
+	s.Deadlines[PhaseDrainPipeline] = 20 * time.Millisecond
+	_, _ = s.Add(PhaseDrainPipeline, "stuck") // never calls done
+	s.Register(PhaseFlushStorage, "broken", func(context.Context) error {
+		return errors.New("disk full")
+	})
+	closed := false
+	s.Register(PhaseCloseConnections, "db", func(context.Context) error {
+		closed = true
+		return nil
+	})
+
+	start := time.Now()
+	report := s.Shutdown()
+	if time.Since(start) > time.Second {
+		t.Errorf("shutdown took %v; want the deadline of the stuck phase", time.Since(start))
+	}
+	if !closed {
+		t.Error("later phases not run after a failure")
+	}
+	if len(report.Failed) != 2 {
+		t.Fatalf("got failures %+v; want stuck and broken", report.Failed)
+	}
+	if f := report.Failed[0]; f.Component != "stuck" || f.Phase != PhaseDrainPipeline || !errors.Is(f.Err, context.DeadlineExceeded) {
+		t.Errorf("got %+v; want stuck timing out in drain pipeline", f)
+	}
+	if f := report.Failed[1]; f.Component != "broken" || f.Phase != PhaseFlushStorage || f.Err.Error() != "disk full" {
+		t.Errorf("got %+v; want the error of broken", f)
+	}
+
+	// later calls return the same report, late components are stopped right away
+	if again := s.Shutdown(); len(again.Failed) != 2 {
+		t.Errorf("got %v failures on the second call; want 2", len(again.Failed))
+	}
+	if ctx := s.Context(PhaseStopIngest, "late"); ctx.Err() == nil {
+		t.Error("context of a component registered after the shutdown is not canceled")
+	}
+}
@@ -0,0 +1,69 @@
+package shared
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSizers(t *testing.T) {
+	w := Wallet{BTC: 1, USDT: 100} // equity 200 at price 100
+
+	tests := []struct {
+		name  string
+		sizer Sizer
+		atr   float64
+		want  float64
+	}{
+		{"fraction", FixedFractionSizer{Fraction: 0.25}, math.NaN(), 0.5},
+		{"fraction limited by USDT", FixedFractionSizer{Fraction: 1}, math.NaN(), 1},
+		{"notional", FixedNotionalSizer{Notional: 50}, math.NaN(), 0.5},
+		{"volatility", VolatilityTargetSizer{RiskFraction: 0.01, AtrMultiple: 2}, 5, 0.2},
+		{"volatility without atr", VolatilityTargetSizer{RiskFraction: 0.01, AtrMultiple: 2}, math.NaN(), 0},
+		{"kelly fallback", &KellySizer{Cap: 0.25, MinTrades: 10, Fallback: 0.1}, math.NaN(), 0.2},
+	}
+	for _, tt := range tests {
+		if got := tt.sizer.Size(w, 100, tt.atr); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%v: got %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSizingPolicyFromEnv(t *testing.T) {
+	t.Setenv("SIZING_POLICY", "volatility")
+	if got := SizingConfigFromEnv().Policy; got != "volatility" {
+		t.Errorf("got %q; want volatility", got)
+	}
+	t.Setenv("SIZING_POLICY", "volatilty")
+	if got := SizingConfigFromEnv().Policy; got != "fraction" {
+		t.Errorf("got %q for a misspelled policy; want the default fraction", got)
+	}
+}
+
+func TestKellyFraction(t *testing.T) {
+	k := KellySizer{Cap: 0.5, MinTrades: 4, Fallback: 0.1}
+	for _, r := range []float64{0.1, 0.1, 0.1, -0.1} {
+		k.Observe(r)
+	}
+	// W = 0.75, R = 1 -> 0.75 - 0.25 = 0.5
+	if got := k.Fraction(); math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("got %v; want 0.5", got)
+	}
+
+	k.Cap = 0.2
+	if got := k.Fraction(); got != 0.2 {
+		t.Errorf("got %v; want capped 0.2", got)
+	}
+}
+
+func TestAtr(t *testing.T) {
+	a := Atr{}
+	a.Init(2)
+	a.Add(11, 9, 10)
+	if !math.IsNaN(a.Value()) {
+		t.Errorf("got %v before ready; want NaN", a.Value())
+	}
+	a.Add(14, 12, 13) // true range uses the previous close: 14-10
+	if got := a.Value(); got != 3 {
+		t.Errorf("got %v; want 3", got)
+	}
+}
@@ -0,0 +1,180 @@
+package shared
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// admin HTTP server of a service: health, metrics, pprof, build info, effective config, log level and the control actions of the service.
+// with a Token, the requests changing state and pprof need it as a bearer token, the others stay open for the health checks and Prometheus
+type AdminServer struct {
+	Name  string
+	Addr  string // address listened on, set by Start
+	Token string // ADMIN_TOKEN
+
+	mux     *http.ServeMux
+	server  *http.Server
+	started time.Time
+
+	mu     sync.Mutex
+	config map[string]any
+}
+
+func NewAdminServer(name string) *AdminServer {
+	a := &AdminServer{Name: name, Token: os.Getenv("ADMIN_TOKEN"), mux: http.NewServeMux(), started: time.Now(), config: make(map[string]any)}
+	a.mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name + " is OK"))
+	})
+	a.mux.HandleFunc("GET /livez", Health.LivenessHandler())
+	a.mux.HandleFunc("GET /readyz", Health.ReadinessHandler())
+	a.mux.Handle("GET /metrics", promhttp.Handler())
+	a.mux.HandleFunc("/debug/pprof/", pprof.Index)
+	a.mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	a.mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	a.mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	a.mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	a.mux.HandleFunc("GET /buildinfo", a.buildInfo)
+	a.mux.HandleFunc("GET /config", a.effectiveConfig)
+	a.mux.HandleFunc("/loglevel", LogLevelHandler)
+	a.mux.HandleFunc("GET /alerts/rules", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		WritePrometheusRules(w)
+	})
+	return a
+}
+
+// registers a control action or another admin endpoint
+func (a *AdminServer) Handle(pattern string, handler http.Handler) {
+	a.mux.Handle(pattern, handler)
+}
+
+func (a *AdminServer) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	a.mux.HandleFunc(pattern, handler)
+}
+
+// sets a value of the effective config served on /config. secrets must be left out or redacted
+func (a *AdminServer) SetConfig(key string, value any) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.config[key] = value
+}
+
+// listens on ADMIN_ADDR, or localhost:HEALTH_PORT, or the first free port of localhost in [HealthEndpointFirstPort, HealthEndpointLastPort)
+func (a *AdminServer) Start() {
+	var lis net.Listener
+	var err error
+	addr := os.Getenv("ADMIN_ADDR")
+	if addr == "" && os.Getenv("HEALTH_PORT") != "" {
+		addr = "127.0.0.1:" + os.Getenv("HEALTH_PORT")
+	}
+	if addr != "" { // configured. will only try it.
+		if lis, err = net.Listen("tcp", addr); err != nil {
+			log.Fatalf("[Fatal][Error] Error starting admin server: %v", err)
+		}
+	} else { // will try ports in range [HealthEndpointFirstPort, HealthEndpointLastPort] one by one
+		for port := HealthEndpointFirstPort; port < HealthEndpointLastPort; port++ {
+			if lis, err = net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(port)); err == nil {
+				break
+			}
+			log.Printf("[Warning] Error starting admin server: %v", err)
+			log.Printf("[Info] Trying next port.")
+		}
+		if lis == nil {
+			log.Fatalf("[Fatal][Error] Could not find an empty port for the admin server of %v in range [%v,%v]\n", a.Name, HealthEndpointFirstPort, HealthEndpointLastPort)
+		}
+	}
+	a.Addr = lis.Addr().String()
+	a.SetConfig("admin_addr", a.Addr)
+	a.server = &http.Server{Handler: a.authorize(a.mux), ReadHeaderTimeout: 10 * time.Second}
+	log.Printf("[Info] Admin server (http://localhost:%v/healthz) listening on %v\n", lis.Addr().(*net.TCPAddr).Port, a.Addr)
+	if a.Token == "" && !lis.Addr().(*net.TCPAddr).IP.IsLoopback() {
+		log.Printf("[Warning] Admin server listens beyond localhost without ADMIN_TOKEN, its control actions are open to the network\n")
+	}
+	go func() {
+		if err := a.server.Serve(lis); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("[Fatal][Error] Admin server failed: %v", err)
+		}
+	}()
+}
+
+// asks for the Token on the requests that change state, or profile the service
+func (a *AdminServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		open := r.Method == http.MethodGet || r.Method == http.MethodHead
+		if a.Token != "" && (!open || strings.HasPrefix(r.URL.Path, "/debug/pprof/")) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				http.Error(w, "admin token required", http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *AdminServer) Shutdown(ctx context.Context) error {
+	if a.server == nil {
+		return nil
+	}
+	return a.server.Shutdown(ctx)
+}
+
+func (a *AdminServer) buildInfo(w http.ResponseWriter, r *http.Request) {
+	info := map[string]any{
+		"service":    a.Name,
+		"go_version": runtime.Version(),
+		"started":    a.started.UTC().Format(time.RFC3339),
+		"uptime":     time.Since(a.started).Round(time.Second).String(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info["path"] = bi.Path
+		info["version"] = bi.Main.Version
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision", "vcs.time", "vcs.modified":
+				info[s.Key] = s.Value
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+func (a *AdminServer) effectiveConfig(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	data, err := json.MarshalIndent(a.config, "", "  ")
+	a.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// the URI without its password, for the effective config
+func RedactURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return fmt.Sprintf("<unparsable, %v characters>", len(uri))
+	}
+	return u.Redacted()
+}
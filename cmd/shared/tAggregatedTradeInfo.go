@@ -1,4 +1,4 @@
-package main
+package shared
 
 import (
 	"math"
@@ -12,6 +12,9 @@ type AggregatedTradeInfo struct {
 	MaxPrice   float64   `bson:"max_price"`
 	FirstPrice float64   `bson:"first_price"`
 	LastPrice  float64   `bson:"last_price"`
+	Volume     float64   `bson:"volume"` // BTC traded. 0 for bars stored before volume was recorded
+
+	Trace map[string]string `bson:"-" json:"-"` // trace context of the trade that closed the bar, not stored
 }
 
 func (s *AggregatedTradeInfo) getDefault() AggregatedTradeInfo {
@@ -21,7 +24,8 @@ func (s *AggregatedTradeInfo) getDefault() AggregatedTradeInfo {
 		MinPrice:   math.Inf(1),
 		MaxPrice:   math.Inf(-1),
 		FirstPrice: math.NaN(),
-		LastPrice:  math.NaN()}
+		LastPrice:  math.NaN(),
+		Volume:     0}
 }
 
 func (s *AggregatedTradeInfo) SetDefault() {
@@ -34,11 +38,12 @@ func (s *AggregatedTradeInfo) IsDefault() bool {
 		s.LastTime == def.LastTime &&
 		s.MinPrice == def.MinPrice &&
 		s.MaxPrice == def.MaxPrice &&
+		s.Volume == def.Volume &&
 		math.IsNaN(s.FirstPrice) && math.IsNaN(def.FirstPrice) &&
 		math.IsNaN(s.LastPrice) && math.IsNaN(def.LastPrice)
 }
 
-func (s *AggregatedTradeInfo) Update(d time.Time, v float64) {
+func (s *AggregatedTradeInfo) Update(d time.Time, v float64, q float64) {
 	if s.IsDefault() {
 		s.FirstTime = d
 		s.FirstPrice = v
@@ -51,4 +56,5 @@ func (s *AggregatedTradeInfo) Update(d time.Time, v float64) {
 		s.MaxPrice = v
 	}
 	s.LastPrice = v
+	s.Volume += q
 }
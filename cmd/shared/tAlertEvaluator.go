@@ -0,0 +1,223 @@
+package shared
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// alert in the Alertmanager webhook format, so its receivers accept the notifications
+type Alert struct {
+	Status      string            `json:"status"` // "firing" or "resolved"
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      time.Time         `json:"endsAt,omitzero"`
+}
+
+type alertNotification struct {
+	Version string  `json:"version"`
+	Status  string  `json:"status"`
+	Alerts  []Alert `json:"alerts"`
+}
+
+type alertCheck struct {
+	rule         AlertRule
+	firing       func(now time.Time) bool
+	pendingSince time.Time
+	active       *Alert
+}
+
+// evaluates the AlertRules in the service, for deployments without Prometheus.
+// alerts that hold for their For are posted to ALERT_WEBHOOKS, and again when resolved
+type AlertEvaluator struct {
+	Service  string
+	Interval time.Duration
+	Webhooks *WebhookDispatcher // nil when no webhook is configured, the alerts are only logged and served on /alerts
+
+	mu     sync.Mutex
+	checks []*alertCheck
+}
+
+// posts to ALERT_WEBHOOKS (comma separated URLs) signed with ALERT_WEBHOOK_SECRET
+func NewAlertEvaluator(service string) *AlertEvaluator {
+	e := &AlertEvaluator{Service: service, Interval: AlertEvalInterval}
+	var urls []string
+	for _, u := range strings.Split(os.Getenv("ALERT_WEBHOOKS"), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) > 0 {
+		e.Webhooks = &WebhookDispatcher{
+			URLs:        urls,
+			Secret:      os.Getenv("ALERT_WEBHOOK_SECRET"),
+			MaxAttempts: 5,
+			Backoff:     time.Second,
+			Client:      &http.Client{Timeout: 10 * time.Second},
+		}
+	}
+	return e
+}
+
+// evaluates the condition of rule. firing is called on each evaluation, so it can sample the metrics
+func (e *AlertEvaluator) Add(rule AlertRule, firing func(now time.Time) bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.checks = append(e.checks, &alertCheck{rule: rule, firing: firing})
+}
+
+// evaluates every Interval until the shutdown, the webhooks are flushed after it
+func (e *AlertEvaluator) Start(shutdownOrchestrator *ShutdownOrchestrator) {
+	stop, done := shutdownOrchestrator.Add(PhaseStopIngest, "alert evaluator")
+	if e.Webhooks != nil {
+		log.Printf("[Info] Delivering alerts to %v webhooks\n", len(e.Webhooks.URLs))
+		e.Webhooks.Start(100)
+		shutdownOrchestrator.Register(PhaseFlushStorage, "alert webhooks", StopFunc(e.Webhooks.Close))
+	}
+	go func() {
+		defer done()
+		ticker := time.NewTicker(e.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				e.Evaluate(now)
+			case <-stop.Done():
+				return
+			}
+		}
+	}()
+}
+
+// evaluates the rules once, returns the alerts that started firing or got resolved
+func (e *AlertEvaluator) Evaluate(now time.Time) []Alert {
+	e.mu.Lock()
+	var changed []Alert
+	for _, c := range e.checks {
+		if !c.firing(now) {
+			c.pendingSince = time.Time{}
+			if c.active != nil {
+				c.active.Status, c.active.EndsAt = "resolved", now
+				changed = append(changed, *c.active)
+				c.active = nil
+			}
+			continue
+		}
+		if c.pendingSince.IsZero() {
+			c.pendingSince = now
+		}
+		if c.active == nil && now.Sub(c.pendingSince) >= c.rule.For {
+			c.active = &Alert{
+				Status:      "firing",
+				Labels:      map[string]string{"alertname": c.rule.Name, "service": e.Service, "severity": c.rule.Severity},
+				Annotations: map[string]string{"summary": c.rule.Summary},
+				StartsAt:    now,
+			}
+			changed = append(changed, *c.active)
+		}
+	}
+	e.mu.Unlock()
+
+	for _, a := range changed {
+		if a.Status == "firing" {
+			log.Printf("[Warning] Alert %v firing: %v\n", a.Labels["alertname"], a.Annotations["summary"])
+		} else {
+			log.Printf("[Info] Alert %v resolved\n", a.Labels["alertname"])
+		}
+		if e.Webhooks != nil {
+			data, err := json.Marshal(alertNotification{Version: "4", Status: a.Status, Alerts: []Alert{a}})
+			if err != nil {
+				log.Printf("[Warning] Failed marshaling alert: %v\n", err)
+				continue
+			}
+			e.Webhooks.Dispatch(data)
+		}
+	}
+	return changed
+}
+
+// GET replies the firing alerts and the evaluated rules
+func (e *AlertEvaluator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	firing := []Alert{}
+	rules := []string{}
+	for _, c := range e.checks {
+		rules = append(rules, c.rule.Name)
+		if c.active != nil {
+			firing = append(firing, *c.active)
+		}
+	}
+	e.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"firing": firing, "rules": rules})
+}
+
+// increase of a counter over a window, like increase() of PromQL
+type Increase struct {
+	Window  time.Duration
+	samples []sample
+}
+
+type sample struct {
+	t time.Time
+	v float64
+}
+
+// adds the sample at now. ok once the samples span the window
+func (i *Increase) Add(now time.Time, v float64) (float64, bool) {
+	i.samples = append(i.samples, sample{now, v})
+	// keeps the newest sample at or before the start of the window
+	for len(i.samples) > 1 && !i.samples[1].t.After(now.Add(-i.Window)) {
+		i.samples = i.samples[1:]
+	}
+	first := i.samples[0]
+	return v - first.v, now.Sub(first.t) >= i.Window
+}
+
+// sum of the counters of c, over every child of a vector
+func CounterSum(c prometheus.Collector) float64 {
+	sum := 0.0
+	for _, m := range collect(c) {
+		sum += m.GetCounter().GetValue()
+	}
+	return sum
+}
+
+// observations of the histograms of c at or below le, and all of them
+func HistogramCounts(c prometheus.Collector, le float64) (float64, float64) {
+	var within, total float64
+	for _, m := range collect(c) {
+		h := m.GetHistogram()
+		total += float64(h.GetSampleCount())
+		for _, b := range h.GetBucket() {
+			if b.GetUpperBound() == le {
+				within += float64(b.GetCumulativeCount())
+			}
+		}
+	}
+	return within, total
+}
+
+func collect(c prometheus.Collector) []*dto.Metric {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	var out []*dto.Metric
+	for m := range ch {
+		var d dto.Metric
+		if err := m.Write(&d); err == nil {
+			out = append(out, &d)
+		}
+	}
+	return out
+}
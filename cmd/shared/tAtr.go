@@ -0,0 +1,50 @@
+package shared
+
+import "math"
+
+// average true range over the last n bars
+type Atr struct {
+	trueRanges []float64
+	size       int
+	pos        int
+	dataCount  int
+	prevClose  float64
+}
+
+func (a *Atr) Init(size int) {
+	a.trueRanges = make([]float64, size)
+	a.size = size
+	a.pos = 0
+	a.dataCount = 0
+	a.prevClose = math.NaN()
+}
+
+func (a *Atr) Add(high, low, close float64) {
+	tr := high - low
+	if !math.IsNaN(a.prevClose) {
+		tr = math.Max(tr, math.Max(math.Abs(high-a.prevClose), math.Abs(low-a.prevClose)))
+	}
+	a.prevClose = close
+
+	a.pos = (a.pos + 1) % a.size
+	a.trueRanges[a.pos] = tr
+	if a.dataCount < a.size {
+		a.dataCount++
+	}
+}
+
+func (a *Atr) IsReady() bool {
+	return a.size > 0 && a.dataCount == a.size
+}
+
+// returns NaN until the buffer is full
+func (a *Atr) Value() float64 {
+	if !a.IsReady() {
+		return math.NaN()
+	}
+	sum := 0.0
+	for _, tr := range a.trueRanges {
+		sum += tr
+	}
+	return sum / float64(a.size)
+}
@@ -0,0 +1,28 @@
+package shared
+
+import "time"
+
+// bar of AggregatePeriod published by aggregator, on every close and while in progress
+type BarEvent struct {
+	Symbol string    `json:"symbol"`
+	Start  time.Time `json:"start"`
+	Open   float64   `json:"open"`
+	High   float64   `json:"high"`
+	Low    float64   `json:"low"`
+	Close  float64   `json:"close"`
+	Volume float64   `json:"volume"`
+	Closed bool      `json:"closed"` // false for the updates of the bar in progress
+}
+
+func NewBarEvent(symbol string, v AggregatedTradeInfo, period time.Duration, closed bool) BarEvent {
+	return BarEvent{
+		Symbol: symbol,
+		Start:  v.FirstTime.Truncate(period),
+		Open:   v.FirstPrice,
+		High:   v.MaxPrice,
+		Low:    v.MinPrice,
+		Close:  v.LastPrice,
+		Volume: v.Volume,
+		Closed: closed,
+	}
+}
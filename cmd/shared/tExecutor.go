@@ -0,0 +1,38 @@
+package shared
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+)
+
+// returned by QueryOrder for client order IDs the exchange does not know
+var ErrOrderNotFound = errors.New("order not found")
+
+// returned by PlaceOrder when the exchange refused the order, or it was not sent. with other errors, e.g. a timeout,
+// the order may have reached the exchange and is looked up by its ClientOrderID
+var ErrOrderRejected = errors.New("order rejected")
+
+type Balance struct {
+	Asset  string
+	Free   float64
+	Locked float64
+}
+
+// places and tracks orders on an exchange. orders are identified by their ClientOrderID,
+// which PlaceOrder generates when it is empty.
+type Executor interface {
+	PlaceOrder(ctx context.Context, symbol string, order Order) (Order, error)
+	CancelOrder(ctx context.Context, symbol string, clientOrderID string) (Order, error)
+	QueryOrder(ctx context.Context, symbol string, clientOrderID string) (Order, error)
+	OpenOrders(ctx context.Context, symbol string) ([]Order, error)
+	Balances(ctx context.Context) (map[string]Balance, error)
+}
+
+// random client order ID, accepted by Binance (at most 36 characters of [.A-Z:/a-z0-9_-])
+func NewClientOrderID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "tb-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,122 @@
+package shared
+
+import (
+	"math"
+	"time"
+)
+
+// reasons of closing a position
+const (
+	ExitReasonCrossover    = "crossover"
+	ExitReasonStopLoss     = "stop_loss"
+	ExitReasonTakeProfit   = "take_profit"
+	ExitReasonTrailingStop = "trailing_stop"
+	ExitReasonTimeExit     = "time_exit"
+	ExitReasonLiquidation  = "liquidation"
+)
+
+// protective exits of a position. zero values disable the rule.
+// distances are below the price for stops of long positions and above for stops of short positions, vice versa for take-profit.
+type ExitRules struct {
+	StopLoss     float64       // relative distance from the entry price, 0.02 is 2%
+	TakeProfit   float64       // relative distance from the entry price
+	TrailingStop float64       // relative distance from the best price since entry
+	MaxHold      time.Duration // position is closed after being held this long
+}
+
+func (r ExitRules) IsEnabled() bool {
+	return r.StopLoss > 0 || r.TakeProfit > 0 || r.TrailingStop > 0 || r.MaxHold > 0
+}
+
+// tracks the exit levels of an open position
+type PositionExits struct {
+	Rules      ExitRules
+	EntryPrice float64
+	EntryTime  time.Time
+	Best       float64 // highest price since entry for long, lowest for short positions
+	IsOpen     bool
+	IsShort    bool
+}
+
+func (p *PositionExits) Open(price float64, t time.Time) {
+	p.EntryPrice = price
+	p.EntryTime = t
+	p.Best = price
+	p.IsOpen = true
+	p.IsShort = false
+}
+
+func (p *PositionExits) OpenShort(price float64, t time.Time) {
+	p.Open(price, t)
+	p.IsShort = true
+}
+
+// +1 for long, -1 for short positions
+func (p *PositionExits) direction() float64 {
+	if p.IsShort {
+		return -1
+	}
+	return 1
+}
+
+func (p *PositionExits) Close() {
+	p.IsOpen = false
+}
+
+// stop level from the stop-loss and trailing stop, whichever is tighter. NaN if both are disabled.
+func (p *PositionExits) stopLevel() (float64, string) {
+	dir := p.direction()
+	level, reason := math.NaN(), ""
+	if p.Rules.StopLoss > 0 {
+		level, reason = p.EntryPrice*(1-dir*p.Rules.StopLoss), ExitReasonStopLoss
+	}
+	if p.Rules.TrailingStop > 0 {
+		trailing := p.Best * (1 - dir*p.Rules.TrailingStop)
+		if math.IsNaN(level) || dir*trailing > dir*level {
+			level, reason = trailing, ExitReasonTrailingStop
+		}
+	}
+	return level, reason
+}
+
+// checks the exit rules against a bar. for a single trade pass its price as open, high, low and close.
+// stops are checked before the take-profit since the order of high and low within a bar is not known.
+// a bar opening beyond a level fills at the open price. returns the exit price and reason, or an empty reason.
+func (p *PositionExits) Check(open, high, low, close float64, t time.Time) (float64, string) {
+	if !p.IsOpen {
+		return 0, ""
+	}
+
+	// levels are the ones known before this bar, this bar moves the trailing stop for the next one
+	defer func() {
+		if p.IsShort {
+			p.Best = math.Min(p.Best, low)
+		} else {
+			p.Best = math.Max(p.Best, high)
+		}
+	}()
+
+	if p.IsShort {
+		if level, reason := p.stopLevel(); !math.IsNaN(level) && high >= level {
+			return math.Max(open, level), reason
+		}
+		if p.Rules.TakeProfit > 0 {
+			if level := p.EntryPrice * (1 - p.Rules.TakeProfit); low <= level {
+				return math.Min(open, level), ExitReasonTakeProfit
+			}
+		}
+	} else {
+		if level, reason := p.stopLevel(); !math.IsNaN(level) && low <= level {
+			return math.Min(open, level), reason
+		}
+		if p.Rules.TakeProfit > 0 {
+			if level := p.EntryPrice * (1 + p.Rules.TakeProfit); high >= level {
+				return math.Max(open, level), ExitReasonTakeProfit
+			}
+		}
+	}
+	if p.Rules.MaxHold > 0 && t.Sub(p.EntryTime) >= p.Rules.MaxHold {
+		return close, ExitReasonTimeExit
+	}
+	return 0, ""
+}
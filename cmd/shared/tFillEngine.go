@@ -0,0 +1,157 @@
+package shared
+
+import (
+	"math"
+	"time"
+)
+
+// simulates fills of market, limit and stop orders against bars or single trades
+type FillEngine struct {
+	Latency          time.Duration // orders become active this long after CreatedAt
+	MaxParticipation float64       // upper limit of the fills of all orders per bar/trade as a fraction of its volume. 0 or unknown volume for no limit
+
+	Orders []*Order // open orders
+	NextID int64
+}
+
+// adds an order, sets its ID and status. the returned pointer is updated on fills.
+func (e *FillEngine) Submit(o Order) *Order {
+	e.NextID++
+	o.ID = e.NextID
+	o.Status = OrderStatusNew
+	o.FilledQty = 0
+	o.AvgPrice = 0
+	if o.TimeInForce == "" {
+		o.TimeInForce = TimeInForceGTC
+	}
+	e.Orders = append(e.Orders, &o)
+	return &o
+}
+
+func (e *FillEngine) Cancel(id int64) bool {
+	for _, o := range e.Orders {
+		if o.ID == id && o.IsOpen() {
+			o.Status = OrderStatusCanceled
+			e.prune()
+			return true
+		}
+	}
+	return false
+}
+
+func (e *FillEngine) OpenOrders() []*Order {
+	return e.Orders
+}
+
+// matches the open orders against a bar. an order that becomes active after the bar has started
+// only sees its close, since the path of the price before the close is not known.
+func (e *FillEngine) OnBar(bar AggregatedTradeInfo) []Fill {
+	return e.match(bar.FirstTime, bar.LastTime, bar.FirstPrice, bar.MaxPrice, bar.MinPrice, bar.LastPrice, bar.Volume)
+}
+
+// matches the open orders against a single trade
+func (e *FillEngine) OnTrade(t time.Time, price float64, quantity float64) []Fill {
+	return e.match(t, t, price, price, price, price, quantity)
+}
+
+func (e *FillEngine) match(start, end time.Time, open, high, low, close, volume float64) []Fill {
+	var fills []Fill
+	available := math.Inf(1) // share of the volume left to the orders, in their order
+	if e.MaxParticipation > 0 && volume > 0 {
+		available = volume * e.MaxParticipation
+	}
+	for _, o := range e.Orders {
+		if !o.IsOpen() {
+			continue
+		}
+		if !o.ExpiresAt.IsZero() && start.After(o.ExpiresAt) {
+			o.Status = OrderStatusExpired
+			continue
+		}
+		active := o.CreatedAt.Add(e.Latency)
+		if active.After(end) {
+			continue
+		}
+		op, h, l := open, high, low
+		if active.After(start) { // only the close is known after the order became active
+			op, h, l = close, close, close
+		}
+
+		if f, ok := e.matchOrder(o, op, h, l, available, end); ok {
+			fills = append(fills, f)
+			available -= f.Quantity
+		}
+	}
+	e.prune()
+	return fills
+}
+
+// fills up to available of the order
+func (e *FillEngine) matchOrder(order *Order, open, high, low, available float64, t time.Time) (Fill, bool) {
+	price, ok := fillPrice(order, open, high, low)
+	qty := math.Min(order.Remaining(), available)
+
+	switch {
+	case !ok || qty <= 0:
+		if order.TimeInForce != TimeInForceGTC {
+			order.Status = OrderStatusExpired
+		}
+		return Fill{}, false
+	case order.TimeInForce == TimeInForceFOK && qty < order.Remaining():
+		order.Status = OrderStatusExpired
+		return Fill{}, false
+	}
+
+	order.AvgPrice = (order.AvgPrice*order.FilledQty + price*qty) / (order.FilledQty + qty)
+	order.FilledQty += qty
+	if order.Remaining() <= 0 {
+		order.Status = OrderStatusFilled
+	} else if order.TimeInForce == TimeInForceIOC {
+		order.Status = OrderStatusExpired
+	} else {
+		order.Status = OrderStatusPartiallyFilled
+	}
+	return Fill{OrderID: order.ID, Side: order.Side, Time: t, Price: price, Quantity: qty}, true
+}
+
+// price the order fills at within a bar, or false if it does not fill.
+// a bar opening beyond the limit or stop price fills at the open.
+func fillPrice(order *Order, open, high, low float64) (float64, bool) {
+	buy := order.Side == SideBuy
+	switch order.Type {
+	case OrderTypeLimit:
+		if buy && low <= order.LimitPrice {
+			return math.Min(open, order.LimitPrice), true
+		}
+		if !buy && high >= order.LimitPrice {
+			return math.Max(open, order.LimitPrice), true
+		}
+		return 0, false
+	case OrderTypeStop:
+		if !order.Triggered {
+			if buy && high >= order.StopPrice {
+				order.Triggered = true
+				return math.Max(open, order.StopPrice), true
+			}
+			if !buy && low <= order.StopPrice {
+				order.Triggered = true
+				return math.Min(open, order.StopPrice), true
+			}
+			return 0, false
+		}
+		return open, true // triggered earlier, fills as a market order
+	default:
+		return open, true
+	}
+}
+
+// drops orders that are no longer open
+func (e *FillEngine) prune() {
+	open := e.Orders[:0]
+	for _, o := range e.Orders {
+		if o.IsOpen() {
+			open = append(open, o)
+		}
+	}
+	e.Orders = open
+}
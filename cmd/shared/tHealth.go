@@ -0,0 +1,177 @@
+package shared
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// returns nil when healthy
+type HealthCheck func(ctx context.Context) error
+
+// liveness and readiness checks of the service, served on /livez and /readyz
+type HealthChecks struct {
+	Timeout time.Duration // of each probe, HealthCheckTimeout when 0
+
+	mu    sync.Mutex
+	live  map[string]HealthCheck
+	ready map[string]HealthCheck
+}
+
+// checks of this process, registered by the services
+var Health = &HealthChecks{}
+
+// failing liveness checks mean the process should be restarted
+func (h *HealthChecks) AddLiveness(name string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.live == nil {
+		h.live = make(map[string]HealthCheck)
+	}
+	h.live[name] = check
+}
+
+// failing readiness checks mean the service should not get traffic yet
+func (h *HealthChecks) AddReadiness(name string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.ready == nil {
+		h.ready = make(map[string]HealthCheck)
+	}
+	h.ready[name] = check
+}
+
+type CheckResult struct {
+	Status     string  `json:"status"` // "ok" or "fail"
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+type HealthReport struct {
+	Status string                 `json:"status"` // "ok" when every check passed
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// runs the checks concurrently
+func (h *HealthChecks) run(ctx context.Context, checks map[string]HealthCheck) HealthReport {
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = HealthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	report := HealthReport{Status: "ok", Checks: make(map[string]CheckResult)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := check(ctx)
+			res := CheckResult{Status: "ok", DurationMs: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				res.Status, res.Error = "fail", err.Error()
+			}
+			mu.Lock()
+			report.Checks[name] = res
+			if err != nil {
+				report.Status = "fail"
+			}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return report
+}
+
+func (h *HealthChecks) LivenessHandler() http.HandlerFunc {
+	return h.handler(func() map[string]HealthCheck { return h.live })
+}
+
+func (h *HealthChecks) ReadinessHandler() http.HandlerFunc {
+	return h.handler(func() map[string]HealthCheck { return h.ready })
+}
+
+// 200 when every check passed, 503 otherwise. the JSON report has the result of each check
+func (h *HealthChecks) handler(checks func() map[string]HealthCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.mu.Lock()
+		snapshot := make(map[string]HealthCheck)
+		for name, check := range checks() {
+			snapshot[name] = check
+		}
+		h.mu.Unlock()
+
+		report := h.run(r.Context(), snapshot)
+		w.Header().Set("Content-Type", "application/json")
+		if report.Status != "ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+func RedisCheck(rdb *redis.Client) HealthCheck {
+	return func(ctx context.Context) error {
+		return rdb.Ping(ctx).Err()
+	}
+}
+
+func MongoCheck(client *mongo.Client) HealthCheck {
+	return func(ctx context.Context) error {
+		return client.Ping(ctx, nil)
+	}
+}
+
+// time of the last event of a stage, e.g. the last trade or bar
+type Heartbeat struct {
+	last atomic.Int64 // unix ns, 0 before the first beat
+}
+
+func (h *Heartbeat) Beat(t time.Time) {
+	h.last.Store(t.UnixNano())
+}
+
+// zero before the first beat
+func (h *Heartbeat) Last() time.Time {
+	if ns := h.last.Load(); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
+// fails when the last beat is older than maxAge or there was none
+func (h *Heartbeat) Check(what string, maxAge time.Duration) HealthCheck {
+	return func(context.Context) error {
+		last := h.Last()
+		if last.IsZero() {
+			return fmt.Errorf("no %v yet", what)
+		}
+		if age := time.Since(last); age > maxAge {
+			return fmt.Errorf("last %v %v ago, limit %v", what, age.Round(time.Second), maxAge)
+		}
+		return nil
+	}
+}
+
+// states of the Redis subscriptions of SubscribeRedis by channel
+var redisSubscriptions sync.Map // string -> *atomic.Bool, true while subscribed
+
+// fails unless SubscribeRedis is subscribed to subCh
+func SubscriptionCheck(subCh string) HealthCheck {
+	return func(context.Context) error {
+		if v, ok := redisSubscriptions.Load(subCh); ok && v.(*atomic.Bool).Load() {
+			return nil
+		}
+		return fmt.Errorf("not subscribed to %v", subCh)
+	}
+}
@@ -0,0 +1,32 @@
+package shared
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// kinds of incidents
+const (
+	IncidentReconnectStorm = "reconnect_storm"
+	IncidentRiskBreach     = "risk_breach"
+)
+
+// operational event worth telling the team about, published to IncidentChannel
+type Incident struct {
+	Time    time.Time         `json:"time"`
+	Kind    string            `json:"kind"`
+	Service string            `json:"service"`
+	Message string            `json:"message"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+func PublishIncident(ctx context.Context, rdb *redis.Client, incident Incident) error {
+	data, err := json.Marshal(incident)
+	if err != nil {
+		return err
+	}
+	return rdb.Publish(ctx, IncidentChannel, data).Err()
+}
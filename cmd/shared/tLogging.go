@@ -0,0 +1,239 @@
+package shared
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// level of every logger of the process. LOG_LEVEL at start, changed at runtime on /loglevel of the admin server
+var LogLevel = new(slog.LevelVar)
+
+// level of log.Fatal, above slog.LevelError
+const LevelFatal = slog.Level(12)
+
+// levels of the prefixes the log.Printf calls use
+var logPrefixLevels = map[string]slog.Level{
+	"[Debug]":   slog.LevelDebug,
+	"[Info]":    slog.LevelInfo,
+	"[Warning]": slog.LevelWarn,
+	"[Error]":   slog.LevelError,
+	"[Fatal]":   LevelFatal,
+}
+
+// accepts debug, info, warn(ing), error and fatal in any case
+func ParseLogLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "warning":
+		return slog.LevelWarn, nil
+	case "fatal":
+		return LevelFatal, nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+	return level, nil
+}
+
+func logLevelName(level slog.Level) string {
+	if level == LevelFatal {
+		return "FATAL"
+	}
+	return level.String()
+}
+
+// sets the default slog logger of the process: JSON lines on w with the service name, or text when LOG_FORMAT=text.
+// the log package is routed into it, the "[Info]", "[Warning]", ... prefixes of its messages become the levels
+func SetupLogging(service string, w io.Writer) *slog.Logger {
+	if s := os.Getenv("LOG_LEVEL"); s != "" {
+		level, err := ParseLogLevel(s)
+		if err != nil {
+			fmt.Fprintf(w, "invalid LOG_LEVEL: %v\n", err)
+		}
+		LogLevel.Set(level)
+	}
+
+	opts := &slog.HandlerOptions{
+		AddSource: true,
+		Level:     LogLevel,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) > 0 {
+				return a
+			}
+			switch a.Key {
+			case slog.LevelKey:
+				return slog.String(slog.LevelKey, logLevelName(a.Value.Any().(slog.Level)))
+			case slog.SourceKey: // file:line like log.Lshortfile. the log package bridge sets its own
+				src, ok := a.Value.Any().(*slog.Source)
+				if !ok {
+					return a
+				}
+				if src.File == "" {
+					return slog.Attr{}
+				}
+				return slog.String(slog.SourceKey, filepath.Base(src.File)+":"+strconv.Itoa(src.Line))
+			}
+			return a
+		},
+	}
+	var handler slog.Handler = slog.NewJSONHandler(w, opts)
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "text") {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	logger := slog.New(handler).With("service", service)
+	slog.SetDefault(logger)
+
+	// after SetDefault, which redirects the log package to the handler without the levels
+	log.SetOutput(logWriter{logger.Handler()})
+	log.SetFlags(log.Lshortfile)
+	log.SetPrefix("")
+	return logger
+}
+
+// writer of the log package, turns its lines into records
+type logWriter struct {
+	handler slog.Handler
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+
+	// "file.go:12: " of log.Lshortfile
+	var source string
+	if i := strings.Index(msg, ": "); i > 0 && strings.Contains(msg[:i], ".go:") {
+		source, msg = msg[:i], msg[i+2:]
+	}
+	// "[Fatal][Error] ..." is fatal
+	level, tagged := slog.LevelInfo, false
+	for {
+		msg = strings.TrimLeft(msg, " ")
+		end := strings.IndexByte(msg, ']')
+		if !strings.HasPrefix(msg, "[") || end < 0 {
+			break
+		}
+		l, ok := logPrefixLevels[msg[:end+1]]
+		if !ok {
+			break
+		}
+		if !tagged || l > level {
+			level, tagged = l, true
+		}
+		msg = msg[end+1:]
+	}
+
+	ctx := context.Background()
+	if !w.handler.Enabled(ctx, level) {
+		return len(p), nil
+	}
+	r := slog.NewRecord(time.Now(), level, msg, 0)
+	if source != "" {
+		r.AddAttrs(slog.String(slog.SourceKey, source))
+	}
+	return len(p), w.handler.Handle(ctx, r)
+}
+
+// logger of a component of the service, with its symbol and bar resolution when given
+func NewLogger(component, symbol string, resolution time.Duration) *slog.Logger {
+	logger := slog.Default().With("component", component)
+	if symbol != "" {
+		logger = logger.With("symbol", symbol)
+	}
+	if resolution != 0 {
+		logger = logger.With("resolution", resolution.String())
+	}
+	return logger
+}
+
+// logs each message at most once per every. the next one logged has the number of the suppressed ones.
+// the messages are the keys, they should be constant with the details in the attributes
+func RateLimited(logger *slog.Logger, every time.Duration) *slog.Logger {
+	return slog.New(&rateLimitHandler{Handler: logger.Handler(), limiter: &logLimiter{every: every, seen: make(map[string]*limitState)}})
+}
+
+type limitState struct {
+	last       time.Time
+	suppressed int
+}
+
+// shared by the handlers derived with WithAttrs and WithGroup
+type logLimiter struct {
+	every time.Duration
+	mu    sync.Mutex
+	seen  map[string]*limitState
+}
+
+// whether msg can be logged at t, and the number suppressed since the last one
+func (l *logLimiter) allow(msg string, t time.Time) (bool, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.seen[msg]
+	if !ok {
+		l.seen[msg] = &limitState{last: t}
+		return true, 0
+	}
+	if t.Sub(s.last) < l.every {
+		s.suppressed++
+		return false, 0
+	}
+	n := s.suppressed
+	s.last, s.suppressed = t, 0
+	return true, n
+}
+
+type rateLimitHandler struct {
+	slog.Handler
+	limiter *logLimiter
+}
+
+func (h *rateLimitHandler) Handle(ctx context.Context, r slog.Record) error {
+	ok, suppressed := h.limiter.allow(r.Message, r.Time)
+	if !ok {
+		return nil
+	}
+	if suppressed > 0 {
+		r = r.Clone()
+		r.AddAttrs(slog.Int("suppressed", suppressed))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *rateLimitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &rateLimitHandler{Handler: h.Handler.WithAttrs(attrs), limiter: h.limiter}
+}
+
+func (h *rateLimitHandler) WithGroup(name string) slog.Handler {
+	return &rateLimitHandler{Handler: h.Handler.WithGroup(name), limiter: h.limiter}
+}
+
+// GET replies the log level, POST ?level= changes it
+func LogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		level, err := ParseLogLevel(r.URL.Query().Get("level"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if old := LogLevel.Level(); old != level {
+			LogLevel.Set(level) // the change is logged at the new level too
+			slog.Log(r.Context(), max(level, slog.LevelWarn), "Log level changed", "from", logLevelName(old), "to", logLevelName(level))
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"level": logLevelName(LogLevel.Level())})
+}
@@ -0,0 +1,56 @@
+package shared
+
+import (
+	"math"
+	"time"
+)
+
+const yearDuration = 365 * 24 * time.Hour
+
+// margin rules of short positions. shorts are opened only when AllowShort is set.
+type MarginConfig struct {
+	AllowShort        bool
+	MaxLeverage       float64 // upper limit of short notional / equity
+	InitialMargin     float64 // equity / short notional needed to open a short
+	MaintenanceMargin float64 // short is liquidated when equity / short notional falls below this
+	BorrowRate        float64 // yearly interest on the value of the borrowed BTC, 0.1 is 10%
+}
+
+func DefaultMarginConfig() MarginConfig {
+	return MarginConfig{
+		AllowShort:        false,
+		MaxLeverage:       1,
+		InitialMargin:     0.5,
+		MaintenanceMargin: 0.1,
+		BorrowRate:        0.1,
+	}
+}
+
+// largest BTC quantity that can be shorted with the given equity
+func (c MarginConfig) MaxShortQty(equity float64, price float64) float64 {
+	if equity <= 0 || price <= 0 {
+		return 0
+	}
+	leverage := c.MaxLeverage
+	if c.InitialMargin > 0 {
+		leverage = math.Min(leverage, 1/c.InitialMargin)
+	}
+	return math.Max(0, equity*leverage/price)
+}
+
+// interest of the borrowed BTC over d
+func (c MarginConfig) Interest(w Wallet, price float64, d time.Duration) float64 {
+	if w.BTC >= 0 || d <= 0 {
+		return 0
+	}
+	return -w.BTC * price * c.BorrowRate * float64(d) / float64(yearDuration)
+}
+
+// price at which equity / short notional reaches the maintenance margin. +Inf when not short.
+func (c MarginConfig) LiquidationPrice(w Wallet) float64 {
+	if w.BTC >= 0 {
+		return math.Inf(1)
+	}
+	// USDT + BTC*p = MaintenanceMargin * -BTC * p
+	return w.USDT / (-w.BTC * (1 + c.MaintenanceMargin))
+}
@@ -0,0 +1,403 @@
+package shared
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// quote assets the symbols of the MockExchange can end with
+var mockQuoteAssets = []string{"USDT", "USDC", "FDUSD", "BTC", "ETH", "BNB"}
+
+// error of the Binance API, returned by the MockExchange with http.StatusBadRequest
+type MockExchangeError struct {
+	Code    int64  `json:"code"`
+	Message string `json:"msg"`
+}
+
+func (e *MockExchangeError) Error() string {
+	return fmt.Sprintf("<APIError> code=%d, msg=%s", e.Code, e.Message)
+}
+
+func (e *MockExchangeError) Is(target error) bool {
+	return (target == ErrOrderNotFound && e.Code == binanceCodeNoSuchOrder) ||
+		(target == ErrOrderRejected && isBinanceRejection(e.Code))
+}
+
+var (
+	errMockUnknownOrder = &MockExchangeError{Code: binanceCodeNoSuchOrder, Message: "Order does not exist."}
+	errMockBalance      = &MockExchangeError{Code: -2010, Message: "Account has insufficient balance for requested action."}
+	errMockDuplicate    = &MockExchangeError{Code: -2010, Message: "Duplicate order sent."}
+	errMockNoPrice      = &MockExchangeError{Code: -2010, Message: "No trade price yet for a market order."}
+)
+
+// an order of the MockExchange with the funds it holds
+type mockOrder struct {
+	*Order
+	Symbol   string
+	RefPrice float64 // quote locked per unit of a buy order
+	Released bool    // remaining locked funds are returned
+}
+
+// local exchange that matches orders with a FillEngine per symbol against the trades fed to OnTrade,
+// e.g. replayed from Redis or a file. it implements Executor in-process, and the subset of the
+// Binance spot REST API used by BinanceExecutor as an http.Handler. signatures are not checked.
+// market orders fill on the next trade.
+type MockExchange struct {
+	Latency          time.Duration
+	MaxParticipation float64
+	Filters          SymbolFilters // served on exchangeInfo for every symbol, not enforced
+
+	mu        sync.Mutex
+	engines   map[string]*FillEngine
+	orders    map[string]*mockOrder // by client order ID
+	balances  map[string]*Balance
+	lastPrice map[string]float64
+	lastTime  map[string]time.Time // clock of the symbol, orders are placed at the time of the last trade
+	nextID    int64
+}
+
+func NewMockExchange(balances map[string]float64) *MockExchange {
+	m := &MockExchange{
+		Filters:   SymbolFilters{StepSize: 0.00001, MinQty: 0.00001, TickSize: 0.01, MinNotional: 5}, // of BTCUSDT
+		engines:   map[string]*FillEngine{},
+		orders:    map[string]*mockOrder{},
+		balances:  map[string]*Balance{},
+		lastPrice: map[string]float64{},
+		lastTime:  map[string]time.Time{},
+	}
+	for asset, free := range balances {
+		m.balances[asset] = &Balance{Asset: asset, Free: free}
+	}
+	return m
+}
+
+// splits a symbol like BTCUSDT into its base and quote assets
+func splitSymbol(symbol string) (string, string, error) {
+	for _, q := range mockQuoteAssets {
+		if base := strings.TrimSuffix(symbol, q); base != symbol && base != "" {
+			return base, q, nil
+		}
+	}
+	return "", "", &MockExchangeError{Code: -1121, Message: "Invalid symbol."}
+}
+
+func (m *MockExchange) balance(asset string) *Balance {
+	b, ok := m.balances[asset]
+	if !ok {
+		b = &Balance{Asset: asset}
+		m.balances[asset] = b
+	}
+	return b
+}
+
+func (m *MockExchange) engine(symbol string) *FillEngine {
+	e, ok := m.engines[symbol]
+	if !ok {
+		e = &FillEngine{}
+		m.engines[symbol] = e
+	}
+	e.Latency = m.Latency
+	e.MaxParticipation = m.MaxParticipation
+	return e
+}
+
+// matches the open orders of the symbol against a trade and settles the fills
+func (m *MockExchange) OnTrade(symbol string, at time.Time, price float64, quantity float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastPrice[symbol] = price
+	m.lastTime[symbol] = at
+	base, quote, err := splitSymbol(symbol)
+	if err != nil {
+		return
+	}
+	e := m.engine(symbol)
+	open := map[int64]*mockOrder{} // the engine drops the orders that complete
+	for _, o := range e.Orders {
+		open[o.ID] = m.orders[o.ClientOrderID]
+	}
+	// market and stop buys fill at the trade price, above the price their funds were locked at:
+	// the difference is locked too, orders the free balance cannot cover are canceled
+	for _, o := range open {
+		if o.Side != SideBuy || o.Type == OrderTypeLimit || price <= o.RefPrice || o.CreatedAt.Add(m.Latency).After(at) {
+			continue
+		}
+		b := m.balance(quote)
+		if extra := o.Remaining() * (price - o.RefPrice); b.Free >= extra {
+			b.Free -= extra
+			b.Locked += extra
+			o.RefPrice = price
+		} else {
+			e.Cancel(o.ID)
+			m.release(o)
+		}
+	}
+	for _, f := range e.OnTrade(at, price, quantity) {
+		o := open[f.OrderID]
+		if f.Side == SideBuy {
+			m.balance(quote).Locked -= f.Quantity * o.RefPrice
+			m.balance(quote).Free += f.Quantity * (o.RefPrice - f.Price)
+			m.balance(base).Free += f.Quantity
+		} else {
+			m.balance(base).Locked -= f.Quantity
+			m.balance(quote).Free += f.Quantity * f.Price
+		}
+	}
+	for _, o := range open {
+		m.release(o)
+	}
+}
+
+// returns the remaining locked funds of a completed order
+func (m *MockExchange) release(o *mockOrder) {
+	if o.IsOpen() || o.Released {
+		return
+	}
+	o.Released = true
+	base, quote, _ := splitSymbol(o.Symbol)
+	if o.Side == SideBuy {
+		m.balance(quote).Locked -= o.Remaining() * o.RefPrice
+		m.balance(quote).Free += o.Remaining() * o.RefPrice
+	} else {
+		m.balance(base).Locked -= o.Remaining()
+		m.balance(base).Free += o.Remaining()
+	}
+}
+
+func (m *MockExchange) PlaceOrder(ctx context.Context, symbol string, order Order) (Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	base, quote, err := splitSymbol(symbol)
+	if err != nil {
+		return order, err
+	}
+	if order.ClientOrderID == "" {
+		order.ClientOrderID = NewClientOrderID()
+	}
+	if _, ok := m.orders[order.ClientOrderID]; ok {
+		return order, errMockDuplicate
+	}
+	if order.Quantity <= 0 {
+		return order, &MockExchangeError{Code: -1013, Message: "Invalid quantity."}
+	}
+
+	// funds of the order are locked until it completes
+	refPrice := 0.0
+	switch order.Type {
+	case OrderTypeLimit:
+		refPrice = order.LimitPrice
+	case OrderTypeStop:
+		refPrice = order.StopPrice
+	default:
+		refPrice = m.lastPrice[symbol]
+		if refPrice == 0 {
+			return order, errMockNoPrice
+		}
+	}
+	if order.Side == SideBuy {
+		b := m.balance(quote)
+		if b.Free < order.Quantity*refPrice {
+			return order, errMockBalance
+		}
+		b.Free -= order.Quantity * refPrice
+		b.Locked += order.Quantity * refPrice
+	} else {
+		b := m.balance(base)
+		if b.Free < order.Quantity {
+			return order, errMockBalance
+		}
+		b.Free -= order.Quantity
+		b.Locked += order.Quantity
+	}
+
+	order.CreatedAt = m.lastTime[symbol]
+	if order.CreatedAt.IsZero() {
+		order.CreatedAt = time.Now()
+	}
+	e := m.engine(symbol)
+	e.NextID = m.nextID // order IDs are unique across the symbols
+	placed := e.Submit(order)
+	m.nextID = e.NextID
+	m.orders[placed.ClientOrderID] = &mockOrder{Order: placed, Symbol: symbol, RefPrice: refPrice}
+	return *placed, nil
+}
+
+func (m *MockExchange) CancelOrder(ctx context.Context, symbol string, clientOrderID string) (Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, ok := m.orders[clientOrderID]
+	if !ok || o.Symbol != symbol {
+		return Order{}, errMockUnknownOrder
+	}
+	if !m.engine(symbol).Cancel(o.ID) {
+		return Order{}, &MockExchangeError{Code: -2011, Message: "Unknown order sent."}
+	}
+	m.release(o)
+	return *o.Order, nil
+}
+
+func (m *MockExchange) QueryOrder(ctx context.Context, symbol string, clientOrderID string) (Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o, ok := m.orders[clientOrderID]
+	if !ok || o.Symbol != symbol {
+		return Order{}, errMockUnknownOrder
+	}
+	return *o.Order, nil
+}
+
+func (m *MockExchange) OpenOrders(ctx context.Context, symbol string) ([]Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	orders := []Order{}
+	for _, o := range m.engine(symbol).OpenOrders() {
+		orders = append(orders, *o)
+	}
+	return orders, nil
+}
+
+func (m *MockExchange) Balances(ctx context.Context) (map[string]Balance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	balances := make(map[string]Balance, len(m.balances))
+	for asset, b := range m.balances {
+		balances[asset] = *b
+	}
+	return balances, nil
+}
+
+// serves the Binance spot REST endpoints of BinanceExecutor, and POST /mock/trade to feed trades by hand
+func (m *MockExchange) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeMockError(w, &MockExchangeError{Code: -1100, Message: err.Error()})
+		return
+	}
+	symbol := r.Form.Get("symbol")
+	clientOrderID := r.Form.Get("origClientOrderId")
+
+	switch {
+	case r.URL.Path == "/api/v3/ping":
+		writeMockJSON(w, struct{}{})
+	case r.URL.Path == "/api/v3/time":
+		writeMockJSON(w, map[string]int64{"serverTime": time.Now().UnixMilli()})
+	case r.URL.Path == "/api/v3/exchangeInfo":
+		f := m.Filters
+		format := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+		writeMockJSON(w, map[string]any{
+			"serverTime": time.Now().UnixMilli(),
+			"symbols": []map[string]any{{
+				"symbol": symbol,
+				"status": "TRADING",
+				"filters": []map[string]string{
+					{"filterType": "PRICE_FILTER", "tickSize": format(f.TickSize)},
+					{"filterType": "LOT_SIZE", "stepSize": format(f.StepSize), "minQty": format(f.MinQty)},
+					{"filterType": "NOTIONAL", "minNotional": format(f.MinNotional)},
+				},
+			}},
+		})
+	case r.URL.Path == "/api/v3/order" && r.Method == http.MethodPost:
+		order := Order{
+			ClientOrderID: r.Form.Get("newClientOrderId"),
+			Side:          r.Form.Get("side"),
+			Type:          orderTypeFromBinance(r.Form.Get("type")),
+			TimeInForce:   r.Form.Get("timeInForce"),
+			Quantity:      parseFloat(r.Form.Get("quantity")),
+			LimitPrice:    parseFloat(r.Form.Get("price")),
+			StopPrice:     parseFloat(r.Form.Get("stopPrice")),
+		}
+		placed, err := m.PlaceOrder(r.Context(), symbol, order)
+		if err != nil {
+			writeMockError(w, err)
+			return
+		}
+		res := binanceOrder(symbol, placed)
+		res["transactTime"] = placed.CreatedAt.UnixMilli()
+		writeMockJSON(w, res)
+	case r.URL.Path == "/api/v3/order" && r.Method == http.MethodDelete:
+		canceled, err := m.CancelOrder(r.Context(), symbol, clientOrderID)
+		if err != nil {
+			writeMockError(w, err)
+			return
+		}
+		res := binanceOrder(symbol, canceled)
+		res["origClientOrderId"] = canceled.ClientOrderID
+		writeMockJSON(w, res)
+	case r.URL.Path == "/api/v3/order" && r.Method == http.MethodGet:
+		o, err := m.QueryOrder(r.Context(), symbol, clientOrderID)
+		if err != nil {
+			writeMockError(w, err)
+			return
+		}
+		writeMockJSON(w, binanceOrder(symbol, o))
+	case r.URL.Path == "/api/v3/openOrders":
+		orders, _ := m.OpenOrders(r.Context(), symbol)
+		res := make([]map[string]any, 0, len(orders))
+		for _, o := range orders {
+			res = append(res, binanceOrder(symbol, o))
+		}
+		writeMockJSON(w, res)
+	case r.URL.Path == "/api/v3/account":
+		balances, _ := m.Balances(r.Context())
+		res := make([]map[string]string, 0, len(balances))
+		for _, b := range balances {
+			res = append(res, map[string]string{
+				"asset":  b.Asset,
+				"free":   strconv.FormatFloat(b.Free, 'f', -1, 64),
+				"locked": strconv.FormatFloat(b.Locked, 'f', -1, 64),
+			})
+		}
+		writeMockJSON(w, map[string]any{"canTrade": true, "accountType": "SPOT", "balances": res})
+	case r.URL.Path == "/mock/trade" && r.Method == http.MethodPost:
+		at := time.Now()
+		if ms, err := strconv.ParseInt(r.Form.Get("time"), 10, 64); err == nil {
+			at = time.UnixMilli(ms)
+		}
+		m.OnTrade(symbol, at, parseFloat(r.Form.Get("price")), parseFloat(r.Form.Get("quantity")))
+		writeMockJSON(w, struct{}{})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// order in the JSON format of the Binance API
+func binanceOrder(symbol string, o Order) map[string]any {
+	return map[string]any{
+		"symbol":              symbol,
+		"orderId":             o.ID,
+		"orderListId":         -1,
+		"clientOrderId":       o.ClientOrderID,
+		"price":               strconv.FormatFloat(o.LimitPrice, 'f', -1, 64),
+		"origQty":             strconv.FormatFloat(o.Quantity, 'f', -1, 64),
+		"executedQty":         strconv.FormatFloat(o.FilledQty, 'f', -1, 64),
+		"cummulativeQuoteQty": strconv.FormatFloat(o.FilledQty*o.AvgPrice, 'f', -1, 64),
+		"status":              o.Status,
+		"timeInForce":         o.TimeInForce,
+		"type":                binanceOrderType(o.Type),
+		"side":                o.Side,
+		"stopPrice":           strconv.FormatFloat(o.StopPrice, 'f', -1, 64),
+		"time":                o.CreatedAt.UnixMilli(),
+		"updateTime":          o.CreatedAt.UnixMilli(),
+		"isWorking":           o.IsOpen(),
+	}
+}
+
+func writeMockJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeMockError(w http.ResponseWriter, err error) {
+	e, ok := err.(*MockExchangeError)
+	if !ok {
+		e = &MockExchangeError{Code: -1000, Message: err.Error()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(e)
+}
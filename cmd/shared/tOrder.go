@@ -0,0 +1,65 @@
+package shared
+
+import "time"
+
+const (
+	SideBuy  = "BUY"
+	SideSell = "SELL"
+
+	OrderTypeMarket = "MARKET"
+	OrderTypeLimit  = "LIMIT"
+	OrderTypeStop   = "STOP" // becomes a market order when the stop price is reached
+
+	TimeInForceGTC = "GTC" // good till canceled, or till ExpiresAt if set
+	TimeInForceIOC = "IOC" // immediate or cancel: fills what it can on the first bar/trade it is active, expires the rest
+	TimeInForceFOK = "FOK" // fill or kill: fills completely on the first bar/trade it is active, or expires
+
+	OrderStatusNew             = "NEW"
+	OrderStatusPartiallyFilled = "PARTIALLY_FILLED"
+	OrderStatusFilled          = "FILLED"
+	OrderStatusCanceled        = "CANCELED"
+	OrderStatusExpired         = "EXPIRED"
+)
+
+type Order struct {
+	ID            int64
+	ClientOrderID string
+	Side          string
+	Type          string
+	TimeInForce   string
+	Quantity      float64
+	LimitPrice    float64
+	StopPrice     float64
+	CreatedAt     time.Time
+	ExpiresAt     time.Time // zero for no expiry
+	Triggered     bool      // stop price was reached
+	FilledQty     float64
+	AvgPrice      float64
+	Status        string
+}
+
+func (o *Order) Remaining() float64 {
+	return o.Quantity - o.FilledQty
+}
+
+func (o *Order) IsOpen() bool {
+	return o.Status == OrderStatusNew || o.Status == OrderStatusPartiallyFilled
+}
+
+type Fill struct {
+	OrderID  int64
+	Side     string
+	Time     time.Time
+	Price    float64
+	Quantity float64
+}
+
+// configuration of the orders placed by the simulator
+type OrderConfig struct {
+	EntryType        string        // OrderType* of entries. empty fills every signal instantly at the bar close
+	EntryOffset      float64       // relative distance of limit/stop entries from the signal price, 0.001 is 0.1%
+	TimeInForce      string        // TimeInForce* of entries
+	CancelAfter      time.Duration // unfilled entries expire after this. 0 for never
+	Latency          time.Duration // orders become active this long after they are placed
+	MaxParticipation float64       // upper limit of the fills of all orders per bar/trade as a fraction of its volume. 0 for no limit
+}
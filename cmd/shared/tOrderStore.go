@@ -0,0 +1,125 @@
+package shared
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// lifecycle states of an order placed through an Executor
+const (
+	OrderStateNew             = "new" // stored before it is sent, so orders in flight survive a restart
+	OrderStateAcknowledged    = "acknowledged"
+	OrderStatePartiallyFilled = "partially_filled"
+	OrderStateFilled          = "filled"
+	OrderStateCanceled        = "canceled"
+	OrderStateRejected        = "rejected"
+)
+
+// lifecycle state of an order with the given OrderStatus*, once the exchange knows it
+func OrderStateOf(status string) string {
+	switch status {
+	case OrderStatusPartiallyFilled:
+		return OrderStatePartiallyFilled
+	case OrderStatusFilled:
+		return OrderStateFilled
+	case OrderStatusCanceled, OrderStatusExpired:
+		return OrderStateCanceled
+	case "REJECTED":
+		return OrderStateRejected
+	default:
+		return OrderStateAcknowledged
+	}
+}
+
+func IsOpenOrderState(state string) bool {
+	return state == OrderStateNew || state == OrderStateAcknowledged || state == OrderStatePartiallyFilled
+}
+
+type OrderStateChange struct {
+	State string    `bson:"state"`
+	Time  time.Time `bson:"time"`
+}
+
+type OrderRecord struct {
+	ClientOrderID string             `bson:"_id"`
+	Account       string             `bson:"account"`
+	Symbol        string             `bson:"symbol"`
+	ExchangeID    int64              `bson:"exchange_id"`
+	Side          string             `bson:"side"`
+	Type          string             `bson:"type"`
+	Quantity      float64            `bson:"quantity"`
+	LimitPrice    float64            `bson:"limit_price"`
+	StopPrice     float64            `bson:"stop_price"`
+	FilledQty     float64            `bson:"filled_qty"`
+	AvgPrice      float64            `bson:"avg_price"`
+	State         string             `bson:"state"`
+	Reason        string             `bson:"reason,omitempty"` // of a rejection, or why the status of a new order is unknown
+	CreatedAt     time.Time          `bson:"created_at"`
+	UpdatedAt     time.Time          `bson:"updated_at"`
+	History       []OrderStateChange `bson:"history,omitempty"` // filled by the store
+}
+
+func NewOrderRecord(symbol string, o Order, state string, reason string) OrderRecord {
+	return OrderRecord{
+		ClientOrderID: o.ClientOrderID,
+		Symbol:        symbol,
+		ExchangeID:    o.ID,
+		Side:          o.Side,
+		Type:          o.Type,
+		Quantity:      o.Quantity,
+		LimitPrice:    o.LimitPrice,
+		StopPrice:     o.StopPrice,
+		FilledQty:     o.FilledQty,
+		AvgPrice:      o.AvgPrice,
+		State:         state,
+		Reason:        reason,
+		CreatedAt:     o.CreatedAt,
+		UpdatedAt:     time.Now(),
+	}
+}
+
+// persists the lifecycle of the orders of an account
+type OrderStore interface {
+	Save(ctx context.Context, rec OrderRecord) error
+	OpenOrders(ctx context.Context) ([]OrderRecord, error) // records in the new, acknowledged or partially filled state
+}
+
+// OrderStore of one account in a MongoDB collection, one document per client order ID
+type MongoOrderStore struct {
+	Collection *mongo.Collection
+	Account    string
+}
+
+// upserts the record and appends its state to the history
+func (s *MongoOrderStore) Save(ctx context.Context, rec OrderRecord) error {
+	rec.Account = s.Account
+	rec.History = nil
+	_, err := s.Collection.UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: rec.ClientOrderID}},
+		bson.D{
+			{Key: "$set", Value: rec},
+			{Key: "$push", Value: bson.D{{Key: "history", Value: OrderStateChange{State: rec.State, Time: rec.UpdatedAt}}}},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (s *MongoOrderStore) OpenOrders(ctx context.Context) ([]OrderRecord, error) {
+	filter := bson.D{
+		{Key: "account", Value: s.Account},
+		{Key: "state", Value: bson.D{{Key: "$in", Value: bson.A{OrderStateNew, OrderStateAcknowledged, OrderStatePartiallyFilled}}}},
+	}
+	cursor, err := s.Collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var records []OrderRecord
+	err = cursor.All(ctx, &records)
+	return records, err
+}
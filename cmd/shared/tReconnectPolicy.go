@@ -0,0 +1,213 @@
+package shared
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+type CircuitState int
+
+const (
+	CircuitClosed   CircuitState = iota // connecting after the backoff
+	CircuitHalfOpen                     // one trial connection after CircuitOpenTime
+	CircuitOpen                         // no connection until OpenTime passed
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitHalfOpen:
+		return "half-open"
+	case CircuitOpen:
+		return "open"
+	}
+	return "closed"
+}
+
+// when to connect to an exchange: exponential backoff with jitter after failures,
+// a sliding window budget of connections that is never exceeded,
+// and a circuit breaker that stops connecting after FailureThreshold consecutive failures.
+// shared by the connections to the same exchange, the budget is per IP
+type ReconnectPolicy struct {
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	Jitter           float64 // share of the backoff randomized, 0 to 1
+	Budget           int     // connections per BudgetWindow
+	BudgetWindow     time.Duration
+	FailureThreshold int
+	OpenTime         time.Duration
+	StableAfter      time.Duration
+
+	mu        sync.Mutex
+	attempts  SlidingWindow
+	failures  int       // consecutive
+	retryAt   time.Time // end of the backoff of the last failure
+	state     CircuitState
+	openUntil time.Time
+	trial     bool // the connection of the half open circuit is in progress
+}
+
+// the policy for Binance, overridable by RECONNECT_BASE_DELAY, RECONNECT_MAX_DELAY and CONNECTION_BUDGET
+func NewReconnectPolicy() *ReconnectPolicy {
+	p := &ReconnectPolicy{
+		BaseDelay:        ReconnectBaseDelay,
+		MaxDelay:         ReconnectMaxDelay,
+		Jitter:           ReconnectJitter,
+		Budget:           ConnectionBudget,
+		BudgetWindow:     ConnectionBudgetWindow,
+		FailureThreshold: CircuitFailures,
+		OpenTime:         CircuitOpenTime,
+		StableAfter:      StableConnection,
+	}
+	EnvDuration("RECONNECT_BASE_DELAY", &p.BaseDelay)
+	EnvDuration("RECONNECT_MAX_DELAY", &p.MaxDelay)
+	envInt("CONNECTION_BUDGET", &p.Budget)
+	return p
+}
+
+// independent connections per symbol, FEED_CONNECTIONS overrides FeedConnections. at least 1
+func FeedConnectionsFromEnv() int {
+	n := FeedConnections
+	envInt("FEED_CONNECTIONS", &n)
+	return max(n, 1)
+}
+
+// wait before the next connection, 0 when it may connect now
+func (p *ReconnectPolicy) Delay(now time.Time) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.delay(now)
+}
+
+// the state at now, an open circuit is half open once OpenTime passed. does not change the state
+func (p *ReconnectPolicy) stateAt(now time.Time) CircuitState {
+	if p.state == CircuitOpen && !now.Before(p.openUntil) {
+		return CircuitHalfOpen
+	}
+	return p.state
+}
+
+func (p *ReconnectPolicy) delay(now time.Time) time.Duration {
+	d := p.retryAt.Sub(now)
+	switch state := p.stateAt(now); {
+	case state == CircuitOpen:
+		d = max(d, p.openUntil.Sub(now))
+	case state == CircuitHalfOpen && p.trial: // until the trial succeeds or fails
+		d = max(d, p.BaseDelay)
+	}
+	p.attempts.Window = p.BudgetWindow
+	if p.attempts.Count(now) >= p.Budget {
+		d = max(d, p.attempts.Expiry(now))
+	}
+	return max(d, 0)
+}
+
+// counts a connection when it may connect now and returns 0, otherwise the wait
+func (p *ReconnectPolicy) Reserve(now time.Time) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if d := p.delay(now); d > 0 {
+		return d
+	}
+	if p.state == CircuitOpen {
+		p.state = CircuitHalfOpen
+		log.Printf("[Info] Circuit half-open, trying one connection\n")
+	}
+	p.attempts.Add(now)
+	p.trial = p.state == CircuitHalfOpen
+	return 0
+}
+
+// reserves a connection, waiting as long as needed. false when ctx is done first
+func (p *ReconnectPolicy) Wait(ctx context.Context) bool {
+	for {
+		d := p.Reserve(time.Now())
+		if d == 0 {
+			return true
+		}
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// the connection opened. closes a half open circuit, the backoff is reset once the connection is stable
+func (p *ReconnectPolicy) Success() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.trial = false
+	if p.state == CircuitHalfOpen {
+		p.state = CircuitClosed
+		log.Printf("[Info] Circuit closed, the trial connection succeeded\n")
+	}
+}
+
+// the connection failed to open. backs off, opens the circuit at FailureThreshold or after a failed trial
+func (p *ReconnectPolicy) Failure(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures++
+	p.trial = false
+	backoff := min(p.BaseDelay, p.MaxDelay)
+	for i := 1; i < p.failures && 0 < backoff && backoff < p.MaxDelay; i++ {
+		backoff += min(backoff, p.MaxDelay-backoff) // doubled up to MaxDelay, never overflows
+	}
+	backoff -= time.Duration(float64(backoff) * p.Jitter * rand.Float64())
+	p.retryAt = now.Add(backoff)
+	if p.state == CircuitHalfOpen || p.state == CircuitClosed && p.failures >= p.FailureThreshold {
+		p.state, p.openUntil = CircuitOpen, now.Add(p.OpenTime)
+		log.Printf("[Warning] Circuit open for %v after %v consecutive failures\n", p.OpenTime, p.failures)
+	}
+}
+
+// the connection closed after lived. a failure unless it was stable
+func (p *ReconnectPolicy) Closed(now time.Time, lived time.Duration) {
+	if lived < p.StableAfter {
+		p.Failure(now)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures, p.retryAt = 0, time.Time{}
+}
+
+type ReconnectStatus struct {
+	State       string  `json:"state"`
+	Failures    int     `json:"failures"`
+	Connections int     `json:"connections"` // in the budget window
+	Budget      int     `json:"budget"`
+	RetryIn     float64 `json:"retry_in_seconds"`
+}
+
+// the state at now, for the admin server and the health checks. reading it changes nothing
+func (p *ReconnectPolicy) Status(now time.Time) ReconnectStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	d := p.delay(now)
+	return ReconnectStatus{
+		State:       p.stateAt(now).String(),
+		Failures:    p.failures,
+		Connections: p.attempts.Count(now),
+		Budget:      p.Budget,
+		RetryIn:     d.Seconds(),
+	}
+}
+
+// fails while the circuit is open or the budget is exhausted
+func (p *ReconnectPolicy) Check() HealthCheck {
+	return func(context.Context) error {
+		s := p.Status(time.Now())
+		if s.State == CircuitOpen.String() {
+			return fmt.Errorf("circuit open after %v failures, retry in %.0fs, %v/%v connections in %v", s.Failures, s.RetryIn, s.Connections, s.Budget, p.BudgetWindow)
+		}
+		if s.Connections >= s.Budget {
+			return fmt.Errorf("connection budget of %v in %v exhausted, retry in %.0fs", s.Budget, p.BudgetWindow, s.RetryIn)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,98 @@
+package shared
+
+import (
+	"math"
+	"time"
+)
+
+// reasons a signal is blocked by the RiskManager
+const (
+	RiskRejectKillSwitch  = "kill_switch"
+	RiskRejectMaxPosition = "max_position"
+	RiskRejectMaxNotional = "max_order_notional"
+	RiskRejectOrderRate   = "max_orders_per_minute"
+	RiskRejectDailyLoss   = "daily_loss_limit"
+	RiskRejectMaxDrawdown = "max_drawdown"
+)
+
+// pre-trade limits. 0 disables a limit.
+type RiskLimits struct {
+	MaxPosition        float64 // upper limit of the BTC position, long or short
+	MaxOrderNotional   float64 // upper limit of the USDT value of an entry order
+	MaxOrdersPerMinute int
+	MaxDailyLoss       float64 // entries stop for the rest of the UTC day when equity falls this much below the day's start, 0.05 is 5%
+	MaxDrawdown        float64 // entries stop until Resume when equity falls this much below its peak, 0.2 is 20%
+}
+
+// checks the entries of a Trader against the RiskLimits. orders that reduce a position are never blocked.
+// the kill switch and the drawdown cutoff block entries until Resume.
+type RiskManager struct {
+	Limits RiskLimits `bson:"-"`
+
+	Killed         bool        `bson:"killed"`
+	KillReason     string      `bson:"kill_reason"` // RiskRejectKillSwitch for a manual kill, RiskRejectMaxDrawdown for the cutoff
+	PeakEquity     float64     `bson:"peak_equity"`
+	Day            time.Time   `bson:"day"` // UTC day of DayStartEquity
+	DayStartEquity float64     `bson:"day_start_equity"`
+	OrderTimes     []time.Time `bson:"order_times"` // orders placed in the last minute
+}
+
+// stops all entries until Resume
+func (r *RiskManager) Kill(reason string) {
+	r.Killed = true
+	r.KillReason = reason
+}
+
+// releases the kill switch and the drawdown cutoff. the drawdown is measured from the current equity afterwards.
+func (r *RiskManager) Resume() {
+	r.Killed = false
+	r.KillReason = ""
+	r.PeakEquity = 0
+}
+
+// tracks the equity for the daily loss and drawdown limits. trips the drawdown cutoff.
+func (r *RiskManager) OnEquity(equity float64, at time.Time) {
+	if day := at.UTC().Truncate(24 * time.Hour); !day.Equal(r.Day) {
+		r.Day = day
+		r.DayStartEquity = equity
+	}
+	r.PeakEquity = math.Max(r.PeakEquity, equity)
+	if r.Limits.MaxDrawdown > 0 && !r.Killed && equity <= r.PeakEquity*(1-r.Limits.MaxDrawdown) {
+		r.Kill(RiskRejectMaxDrawdown)
+	}
+}
+
+// counts an order for the order rate limit
+func (r *RiskManager) RecordOrder(at time.Time) {
+	r.pruneOrders(at)
+	r.OrderTimes = append(r.OrderTimes, at)
+}
+
+func (r *RiskManager) pruneOrders(at time.Time) {
+	recent := r.OrderTimes[:0]
+	for _, t := range r.OrderTimes {
+		if at.Sub(t) < time.Minute {
+			recent = append(recent, t)
+		}
+	}
+	r.OrderTimes = recent
+}
+
+// reason an entry of qty (negative for a short) at price is blocked, "" if it is allowed.
+// position is the BTC position before the entry.
+func (r *RiskManager) Check(qty float64, price float64, position float64, equity float64, at time.Time) string {
+	r.pruneOrders(at)
+	switch {
+	case r.Killed:
+		return r.KillReason
+	case r.Limits.MaxPosition > 0 && math.Abs(position+qty) > r.Limits.MaxPosition:
+		return RiskRejectMaxPosition
+	case r.Limits.MaxOrderNotional > 0 && math.Abs(qty)*price > r.Limits.MaxOrderNotional:
+		return RiskRejectMaxNotional
+	case r.Limits.MaxOrdersPerMinute > 0 && len(r.OrderTimes) >= r.Limits.MaxOrdersPerMinute:
+		return RiskRejectOrderRate
+	case r.Limits.MaxDailyLoss > 0 && at.UTC().Truncate(24*time.Hour).Equal(r.Day) && equity <= r.DayStartEquity*(1-r.Limits.MaxDailyLoss):
+		return RiskRejectDailyLoss
+	}
+	return ""
+}
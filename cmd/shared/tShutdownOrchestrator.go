@@ -1,62 +1,225 @@
 package shared
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 )
 
+// phases of a shutdown, run in this order
+type ShutdownPhase int
+
+const (
+	PhaseStopIngest       ShutdownPhase = iota // stop reading from the exchange, Redis and clients
+	PhaseDrainPipeline                         // process what was already read
+	PhaseFlushStorage                          // write out the buffered data
+	PhaseCloseConnections                      // close the servers and the DB and Redis clients
+	numShutdownPhases
+)
+
+func (p ShutdownPhase) String() string {
+	switch p {
+	case PhaseStopIngest:
+		return "stop ingest"
+	case PhaseDrainPipeline:
+		return "drain pipeline"
+	case PhaseFlushStorage:
+		return "flush storage"
+	case PhaseCloseConnections:
+		return "close connections"
+	}
+	return fmt.Sprintf("phase %d", int(p))
+}
+
+// component that did not stop cleanly
+type ShutdownFailure struct {
+	Phase     ShutdownPhase
+	Component string
+	Err       error // context.DeadlineExceeded when it did not stop before the deadline of its phase
+}
+
+type ShutdownReport struct {
+	Failed   []ShutdownFailure
+	Duration time.Duration
+}
+
+type shutdownComponent struct {
+	name string
+	stop func(ctx context.Context) error
+}
+
+// stops the registered components phase by phase on an int/term signal or Shutdown
 type ShutdownOrchestrator struct {
-	send []chan struct{}
-	recv []chan struct{}
-	Done chan struct{}
+	Deadlines [numShutdownPhases]time.Duration // per phase, ShutdownPhaseTimeout when 0
+	Done      chan struct{}                    // closed once the shutdown finished
+
+	mu         sync.Mutex
+	components [numShutdownPhases][]shutdownComponent
+	started    bool
+	report     ShutdownReport
 }
 
+func NewShutdownOrchestrator() *ShutdownOrchestrator {
+	return &ShutdownOrchestrator{Done: make(chan struct{})}
+}
+
+// shuts down on the first int/term signal
 func (s *ShutdownOrchestrator) Start() {
 	osCloseSignal := make(chan os.Signal, 1)
 	signal.Notify(osCloseSignal, syscall.SIGINT, syscall.SIGTERM)
 
-	s.Done = make(chan struct{})
-
 	go func() {
-		defer close(osCloseSignal)
 		sig := <-osCloseSignal
+		signal.Stop(osCloseSignal)
 		log.Println("[Info] Received int/term signal, will quit:", sig)
 		s.Shutdown()
 	}()
 }
 
-func (s *ShutdownOrchestrator) Get() (chan struct{}, chan struct{}) {
-	send := make(chan struct{})
-	recv := make(chan struct{})
-	s.send = append(s.send, send)
-	s.recv = append(s.recv, recv)
-	return send, recv
+// registers stop to be called in phase. stop returns once the component stopped, or with ctx.Err() when ctx is done
+func (s *ShutdownOrchestrator) Register(phase ShutdownPhase, name string, stop func(ctx context.Context) error) {
+	if !s.register(phase, name, stop) {
+		log.Printf("[Warning] %v registered after the shutdown started, it is not stopped\n", name)
+	}
 }
 
-func (s *ShutdownOrchestrator) Shutdown() {
-	go func() {
-		// receive done signals
-		for i := range s.recv {
-			<-(s.recv)[i]
-		}
+// false when the shutdown already started
+func (s *ShutdownOrchestrator) register(phase ShutdownPhase, name string, stop func(ctx context.Context) error) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return false
+	}
+	s.components[phase] = append(s.components[phase], shutdownComponent{name, stop})
+	return true
+}
+
+// context canceled when phase starts, for components that stop as soon as it is canceled
+func (s *ShutdownOrchestrator) Context(phase ShutdownPhase, name string) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	if !s.register(phase, name, func(context.Context) error { cancel(); return nil }) {
+		cancel()
+	}
+	return ctx
+}
+
+// registers a goroutine component. ctx is canceled when phase starts, the component calls done once it stopped.
+// done may be called earlier, e.g. when the component exits on its own
+func (s *ShutdownOrchestrator) Add(phase ShutdownPhase, name string) (ctx context.Context, done func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+	var once sync.Once
+	done = func() { once.Do(func() { close(finished) }) }
 
-		// close send channels
-		for i := range s.send {
-			close((s.send)[i])
+	registered := s.register(phase, name, func(stopCtx context.Context) error {
+		cancel()
+		select {
+		case <-finished:
+			return nil
+		case <-stopCtx.Done():
+			return stopCtx.Err()
 		}
+	})
+	if !registered {
+		cancel()
+	}
+	return ctx, done
+}
 
-		// set done for every optional receiver
+// stop function of a component stopped by the blocking f. f is left running when ctx is done first
+func StopFunc(f func()) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		stopped := make(chan struct{})
 		go func() {
-			for {
-				s.Done <- struct{}{}
-			}
+			f()
+			close(stopped)
 		}()
-	}()
+		select {
+		case <-stopped:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// runs the phases in order, each with its deadline, and returns the report. later calls wait for the first one
+func (s *ShutdownOrchestrator) Shutdown() ShutdownReport {
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		<-s.Done
+		return s.report
+	}
+	s.started = true
+	components := s.components
+	s.mu.Unlock()
+
+	start := time.Now()
+	var failed []ShutdownFailure
+	for phase := ShutdownPhase(0); phase < numShutdownPhases; phase++ {
+		if len(components[phase]) == 0 {
+			continue
+		}
+		deadline := s.Deadlines[phase]
+		if deadline == 0 {
+			deadline = ShutdownPhaseTimeout
+		}
+		log.Printf("[Info] Shutdown: %v\n", phase)
+		failed = append(failed, runPhase(phase, components[phase], deadline)...)
+	}
 
-	// send stop signals
-	for i := range s.send {
-		(s.send)[i] <- struct{}{}
+	s.report = ShutdownReport{Failed: failed, Duration: time.Since(start)}
+	if len(failed) > 0 {
+		log.Printf("[Warning] Shutdown finished in %v, %v components failed to stop\n", s.report.Duration, len(failed))
+	} else {
+		log.Printf("[Info] Shutdown finished in %v\n", s.report.Duration)
+	}
+	close(s.Done)
+	return s.report
+}
+
+// the report of the finished shutdown
+func (s *ShutdownOrchestrator) Report() ShutdownReport {
+	<-s.Done
+	return s.report
+}
+
+// stops the components concurrently. the ones still running at the deadline are reported and left behind
+func runPhase(phase ShutdownPhase, components []shutdownComponent, deadline time.Duration) []ShutdownFailure {
+	ctx, cancel := context.WithTimeout(context.Background(), deadline)
+	defer cancel()
+
+	errs := make([]chan error, len(components))
+	for i, c := range components {
+		errs[i] = make(chan error, 1)
+		go func() {
+			errs[i] <- c.stop(ctx)
+		}()
+	}
+	var failed []ShutdownFailure
+	for i, c := range components {
+		var err error
+		select {
+		case err = <-errs[i]:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			log.Printf("[Warning] Shutdown: %v did not stop within %v\n", c.name, deadline)
+		} else {
+			log.Printf("[Warning] Shutdown: %v failed to stop: %v\n", c.name, err)
+		}
+		failed = append(failed, ShutdownFailure{Phase: phase, Component: c.name, Err: err})
 	}
+	return failed
 }
@@ -0,0 +1,152 @@
+package shared
+
+import (
+	"log"
+	"math"
+	"slices"
+)
+
+// decides the BTC quantity to buy when entering a position
+type Sizer interface {
+	Size(w Wallet, price float64, atr float64) float64
+}
+
+// implemented by sizers that adapt to the results of closed trades
+type TradeObserver interface {
+	Observe(tradeReturn float64) // relative, 0.1 is 10%
+}
+
+// configuration of the sizing policy of a strategy
+type SizingConfig struct {
+	Policy       string  // "fraction" (default), "notional", "volatility" or "kelly"
+	Fraction     float64 // fraction of equity to allocate. also the fallback of "kelly" before enough trades
+	Notional     float64 // USDT to allocate per position
+	RiskFraction float64 // fraction of equity to lose on an AtrMultiple*ATR adverse move
+	AtrMultiple  float64
+	AtrPeriod    int     // bars
+	KellyCap     float64 // upper limit of the kelly fraction
+	KellyTrades  int     // closed trades needed before the kelly fraction is used
+}
+
+// default config allocates all the equity, the same as Wallet.BuyAll
+func DefaultSizingConfig() SizingConfig {
+	return SizingConfig{
+		Policy:       "fraction",
+		Fraction:     1,
+		Notional:     100,
+		RiskFraction: 0.01,
+		AtrMultiple:  2,
+		AtrPeriod:    14,
+		KellyCap:     0.25,
+		KellyTrades:  20,
+	}
+}
+
+// policies known by NewSizer
+var SizingPolicies = []string{"fraction", "notional", "volatility", "kelly"}
+
+func IsSizingPolicy(policy string) bool {
+	return slices.Contains(SizingPolicies, policy)
+}
+
+// an empty policy allocates all the equity. an unknown one is warned about and sized as "fraction"
+func NewSizer(cfg SizingConfig) Sizer {
+	switch cfg.Policy {
+	case "":
+		return FixedFractionSizer{Fraction: 1}
+	case "fraction":
+		return FixedFractionSizer{Fraction: cfg.Fraction}
+	case "notional":
+		return FixedNotionalSizer{Notional: cfg.Notional}
+	case "volatility":
+		return VolatilityTargetSizer{RiskFraction: cfg.RiskFraction, AtrMultiple: cfg.AtrMultiple}
+	case "kelly":
+		return &KellySizer{Cap: cfg.KellyCap, MinTrades: cfg.KellyTrades, Fallback: cfg.Fraction}
+	default:
+		log.Printf("[Warning] Unknown sizing policy %q, using fraction %v\n", cfg.Policy, cfg.Fraction)
+		return FixedFractionSizer{Fraction: cfg.Fraction}
+	}
+}
+
+// keeps the quantity within what the USDT balance can pay for
+func affordable(w Wallet, price float64, qty float64) float64 {
+	if qty <= 0 || math.IsNaN(qty) || price <= 0 {
+		return 0
+	}
+	return math.Min(qty, w.USDT/price)
+}
+
+type FixedFractionSizer struct {
+	Fraction float64
+}
+
+func (s FixedFractionSizer) Size(w Wallet, price float64, atr float64) float64 {
+	return affordable(w, price, w.Equity(price)*s.Fraction/price)
+}
+
+type FixedNotionalSizer struct {
+	Notional float64
+}
+
+func (s FixedNotionalSizer) Size(w Wallet, price float64, atr float64) float64 {
+	return affordable(w, price, s.Notional/price)
+}
+
+// sizes the position so that an adverse move of AtrMultiple*ATR loses RiskFraction of the equity.
+// buys nothing while ATR is not known.
+type VolatilityTargetSizer struct {
+	RiskFraction float64
+	AtrMultiple  float64
+}
+
+func (s VolatilityTargetSizer) Size(w Wallet, price float64, atr float64) float64 {
+	if math.IsNaN(atr) || atr <= 0 || s.AtrMultiple <= 0 {
+		return 0
+	}
+	return affordable(w, price, w.Equity(price)*s.RiskFraction/(s.AtrMultiple*atr))
+}
+
+// allocates the kelly fraction of the equity estimated from the closed trades, limited by Cap.
+// uses Fallback fraction until MinTrades trades are observed.
+type KellySizer struct {
+	Cap       float64
+	MinTrades int
+	Fallback  float64
+
+	wins    int
+	losses  int
+	sumWin  float64
+	sumLoss float64
+}
+
+func (s *KellySizer) Observe(tradeReturn float64) {
+	if tradeReturn > 0 {
+		s.wins++
+		s.sumWin += tradeReturn
+	} else {
+		s.losses++
+		s.sumLoss -= tradeReturn
+	}
+}
+
+// kelly fraction W - (1-W)/R where W is the win rate and R is the average win/average loss
+func (s *KellySizer) Fraction() float64 {
+	n := s.wins + s.losses
+	if n < s.MinTrades || n == 0 {
+		return math.Min(s.Fallback, s.Cap)
+	}
+	winRate := float64(s.wins) / float64(n)
+	if s.losses == 0 || s.sumLoss == 0 {
+		return s.Cap
+	}
+	if s.wins == 0 {
+		return 0
+	}
+	payoff := (s.sumWin / float64(s.wins)) / (s.sumLoss / float64(s.losses))
+	f := winRate - (1-winRate)/payoff
+	return math.Max(0, math.Min(f, s.Cap))
+}
+
+func (s *KellySizer) Size(w Wallet, price float64, atr float64) float64 {
+	return affordable(w, price, w.Equity(price)*s.Fraction()/price)
+}
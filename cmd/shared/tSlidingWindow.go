@@ -0,0 +1,49 @@
+package shared
+
+import (
+	"sync"
+	"time"
+)
+
+// counts events in the last Window, safe for concurrent use
+type SlidingWindow struct {
+	Window time.Duration
+	mu     sync.Mutex
+	times  []time.Time
+}
+
+// records an event and returns the number of events in the window ending at t
+func (w *SlidingWindow) Add(t time.Time) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.times = append(w.times, t)
+	return w.count(t)
+}
+
+// time until the oldest event leaves the window ending at t, 0 without events
+func (w *SlidingWindow) Expiry(t time.Time) time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.count(t) == 0 {
+		return 0
+	}
+	return w.times[0].Add(w.Window).Sub(t)
+}
+
+// number of events in the window ending at t
+func (w *SlidingWindow) Count(t time.Time) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.count(t)
+}
+
+func (w *SlidingWindow) count(t time.Time) int {
+	recent := w.times[:0]
+	for _, v := range w.times {
+		if t.Sub(v) < w.Window {
+			recent = append(recent, v)
+		}
+	}
+	w.times = recent
+	return len(w.times)
+}
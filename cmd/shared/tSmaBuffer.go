@@ -1,4 +1,4 @@
-package main
+package shared
 
 import (
 	"errors"
@@ -42,8 +42,8 @@ func (s *SmaBuffer) Add(price float64, date time.Time) {
 	}
 }
 
-// checks the need for linear interpolation. if it is needed, does it prior adding new data.
-func (s *SmaBuffer) AddWithLinInterpFill(price float64, date time.Time, period time.Duration) {
+// checks the need for linear interpolation. if it is needed, does it prior adding new data. returns the number of interpolated points
+func (s *SmaBuffer) AddWithLinInterpFill(price float64, date time.Time, period time.Duration) int {
 	var numPeriodsSinceLast int // how many periods elapsed since the last data
 	if s.dataCount > 0 {
 		oldDate := s.dates[s.pos]
@@ -63,6 +63,7 @@ func (s *SmaBuffer) AddWithLinInterpFill(price float64, date time.Time, period t
 		}
 	}
 	s.Add(price, date)
+	return max(numPeriodsSinceLast-1, 0)
 }
 
 func (s *SmaBuffer) IsSmaReady(n int) bool {
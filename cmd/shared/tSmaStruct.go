@@ -0,0 +1,10 @@
+package shared
+
+import "time"
+
+// short and long term SMA of a bar, stored by aggregator
+type SmaStruct struct {
+	TimeStamp time.Time `bson:"timestamp" json:"timestamp"`
+	Sma50     float64   `bson:"sma50" json:"sma50"`
+	Sma200    float64   `bson:"sma200" json:"sma200"`
+}
@@ -0,0 +1,166 @@
+package shared
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// parameters of the SMA crossover strategy
+type StrategyParams struct {
+	SmaShortTerm int
+	SmaLongTerm  int
+	Sizing       SizingConfig
+	Exits        ExitRules
+	Margin       MarginConfig
+	Orders       OrderConfig
+	Risk         RiskLimits
+}
+
+// default strategy parameters, overridable by SMA_SHORT_TERM, SMA_LONG_TERM, SIZING_*, EXIT_*, MARGIN_*, ORDER_* and RISK_* environment variables
+func StrategyParamsFromEnv() StrategyParams {
+	params := StrategyParams{
+		SmaShortTerm: SmaShortTerm,
+		SmaLongTerm:  SmaLongTerm,
+		Sizing:       SizingConfigFromEnv(),
+		Exits:        ExitRulesFromEnv(),
+		Margin:       MarginConfigFromEnv(),
+		Orders:       OrderConfigFromEnv(),
+		Risk:         RiskLimitsFromEnv(),
+	}
+	envInt("SMA_SHORT_TERM", &params.SmaShortTerm)
+	envInt("SMA_LONG_TERM", &params.SmaLongTerm)
+	if params.SmaShortTerm <= 0 || params.SmaShortTerm >= params.SmaLongTerm {
+		log.Printf("[Warning] SMA short term (%v) must be positive and less than long term (%v). Using defaults.\n", params.SmaShortTerm, params.SmaLongTerm)
+		params.SmaShortTerm, params.SmaLongTerm = SmaShortTerm, SmaLongTerm
+	}
+	return params
+}
+
+func SizingConfigFromEnv() SizingConfig {
+	cfg := DefaultSizingConfig()
+	if v := os.Getenv("SIZING_POLICY"); v != "" && !IsSizingPolicy(v) {
+		log.Printf("[Warning] Ignoring unknown SIZING_POLICY=%q, expected one of %v\n", v, SizingPolicies)
+	} else if v != "" {
+		cfg.Policy = v
+	}
+	envFloat("SIZING_FRACTION", &cfg.Fraction)
+	envFloat("SIZING_NOTIONAL", &cfg.Notional)
+	envFloat("SIZING_RISK_FRACTION", &cfg.RiskFraction)
+	envFloat("SIZING_ATR_MULTIPLE", &cfg.AtrMultiple)
+	envInt("SIZING_ATR_PERIOD", &cfg.AtrPeriod)
+	envFloat("SIZING_KELLY_CAP", &cfg.KellyCap)
+	envInt("SIZING_KELLY_TRADES", &cfg.KellyTrades)
+	return cfg
+}
+
+func ExitRulesFromEnv() ExitRules {
+	var rules ExitRules
+	envFloat("EXIT_STOP_LOSS", &rules.StopLoss)
+	envFloat("EXIT_TAKE_PROFIT", &rules.TakeProfit)
+	envFloat("EXIT_TRAILING_STOP", &rules.TrailingStop)
+	EnvDuration("EXIT_MAX_HOLD", &rules.MaxHold)
+	return rules
+}
+
+func MarginConfigFromEnv() MarginConfig {
+	cfg := DefaultMarginConfig()
+	envBool("MARGIN_ALLOW_SHORT", &cfg.AllowShort)
+	envFloat("MARGIN_MAX_LEVERAGE", &cfg.MaxLeverage)
+	envFloat("MARGIN_INITIAL", &cfg.InitialMargin)
+	envFloat("MARGIN_MAINTENANCE", &cfg.MaintenanceMargin)
+	envFloat("MARGIN_BORROW_RATE", &cfg.BorrowRate)
+	return cfg
+}
+
+func OrderConfigFromEnv() OrderConfig {
+	cfg := OrderConfig{TimeInForce: TimeInForceGTC, EntryOffset: EntryOffset}
+	cfg.EntryType = os.Getenv("ORDER_ENTRY_TYPE")
+	envFloat("ORDER_ENTRY_OFFSET", &cfg.EntryOffset)
+	if v := os.Getenv("ORDER_TIME_IN_FORCE"); v != "" {
+		cfg.TimeInForce = v
+	}
+	EnvDuration("ORDER_CANCEL_AFTER", &cfg.CancelAfter)
+	EnvDuration("ORDER_LATENCY", &cfg.Latency)
+	envFloat("ORDER_MAX_PARTICIPATION", &cfg.MaxParticipation)
+	return cfg
+}
+
+func RiskLimitsFromEnv() RiskLimits {
+	var limits RiskLimits
+	envFloat("RISK_MAX_POSITION", &limits.MaxPosition)
+	envFloat("RISK_MAX_ORDER_NOTIONAL", &limits.MaxOrderNotional)
+	envInt("RISK_MAX_ORDERS_PER_MINUTE", &limits.MaxOrdersPerMinute)
+	envFloat("RISK_MAX_DAILY_LOSS", &limits.MaxDailyLoss)
+	envFloat("RISK_MAX_DRAWDOWN", &limits.MaxDrawdown)
+	return limits
+}
+
+// overwrites v if the environment variable is set to a valid boolean
+func envBool(name string, v *bool) {
+	s := os.Getenv(name)
+	if s == "" {
+		return
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		log.Printf("[Warning] Ignoring invalid %v=%q: %v\n", name, s, err)
+		return
+	}
+	*v = b
+}
+
+// overwrites v if the environment variable is set to a valid number
+func envFloat(name string, v *float64) {
+	s := os.Getenv(name)
+	if s == "" {
+		return
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		log.Printf("[Warning] Ignoring invalid %v=%q: %v\n", name, s, err)
+		return
+	}
+	*v = f
+}
+
+// overwrites v if the environment variable is set to a valid integer
+func envInt(name string, v *int) {
+	s := os.Getenv(name)
+	if s == "" {
+		return
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		log.Printf("[Warning] Ignoring invalid %v=%q: %v\n", name, s, err)
+		return
+	}
+	*v = i
+}
+
+// returns "BUY" when short SMA crosses above the long SMA, "SELL" when it crosses below and "" otherwise.
+// diff and lastDiff are short SMA minus long SMA at the current and previous bar.
+func CrossoverSignal(diff, lastDiff float64) string {
+	if diff > 0 && lastDiff <= 0 {
+		return "BUY"
+	}
+	if diff < 0 && lastDiff >= 0 {
+		return "SELL"
+	}
+	return ""
+}
+
+// overwrites v if the environment variable is set to a valid duration
+func EnvDuration(name string, v *time.Duration) {
+	s := os.Getenv(name)
+	if s == "" {
+		return
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		log.Printf("[Warning] Ignoring invalid %v=%q: %v\n", name, s, err)
+		return
+	}
+	*v = d
+}
@@ -0,0 +1,45 @@
+package shared
+
+import "time"
+
+// a closed position
+type Trade struct {
+	IsShort    bool      `bson:"is_short"`
+	EntryTime  time.Time `bson:"entry_time"`
+	ExitTime   time.Time `bson:"exit_time"`
+	EntryPrice float64   `bson:"entry_price"`
+	ExitPrice  float64   `bson:"exit_price"`
+	Quantity   float64   `bson:"quantity"`
+	Return     float64   `bson:"return"`   // relative, 0.1 is 10%. positive when profitable for short positions too
+	PnL        float64   `bson:"pnl"`      // USDT, after the borrow interest
+	Interest   float64   `bson:"interest"` // USDT of borrow interest paid for short positions
+	ExitReason string    `bson:"exit_reason"`
+}
+
+// metrics of the trades of one side
+type SideMetrics struct {
+	Trades       int
+	Wins         int
+	PnL          float64
+	Interest     float64
+	Liquidations int
+}
+
+func SummarizeTrades(trades []Trade) (long SideMetrics, short SideMetrics) {
+	for _, t := range trades {
+		m := &long
+		if t.IsShort {
+			m = &short
+		}
+		m.Trades++
+		if t.PnL > 0 {
+			m.Wins++
+		}
+		m.PnL += t.PnL
+		m.Interest += t.Interest
+		if t.ExitReason == ExitReasonLiquidation {
+			m.Liquidations++
+		}
+	}
+	return long, short
+}
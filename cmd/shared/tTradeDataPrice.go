@@ -3,4 +3,6 @@ package shared
 type TradeDatePrice struct {
 	TradeDate int64
 	Price     string
+	Quantity  string            `json:",omitempty"`
+	Trace     map[string]string `json:",omitempty"` // trace context of the publish, see TraceCarrier
 }
@@ -1,11 +1,25 @@
 package shared
 
-import "time"
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type TradeSignal struct {
-	TimeStamp time.Time `bson:"timestamp"`
-	Signal    string    `bson:"signal"`
-	Price     float64   `bson:"price"`
-	Sma50     float64   `bson:"sma50"`
-	Sma200    float64   `bson:"sma200"`
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"` // set by the aggregator, tells apart the signals of the same millisecond
+	TimeStamp time.Time          `bson:"timestamp" json:"timestamp"`
+	Signal    string             `bson:"signal" json:"signal"`
+	Price     float64            `bson:"price" json:"price"`
+	Sma50     float64            `bson:"sma50" json:"sma50"`
+	Sma200    float64            `bson:"sma200" json:"sma200"`
+	Reason    string             `bson:"reason,omitempty" json:"reason,omitempty"`         // ExitReason* of a SELL, "crossover" for crossover signals
+	CloseOnly bool               `bson:"close_only,omitempty" json:"close_only,omitempty"` // closes the open position without opening the one of the signal
+}
+
+// signal not acted on, with the RiskReject* reason
+type BlockedSignal struct {
+	TradeSignal `bson:",inline"`
+	Rejection   string `bson:"rejection"`
+	Account     string `bson:"account"`
 }
@@ -0,0 +1,536 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"time"
+)
+
+// manages the position of a strategy: turns signals into fills, applies sizing, risk limits, protective exits,
+// borrow interest and liquidation, and records the closed trades. used by backtests and paper trading.
+// without Params.Orders.EntryType signals fill instantly at their price, otherwise orders are placed
+// and filled by the Engine on the following bars or trades. protective exits and liquidations fill instantly.
+// with an Executor the orders are placed on the exchange instead, including the protective exits,
+// and their fills are picked up by SyncOrders.
+type Trader struct {
+	Params StrategyParams `bson:"-"`
+	Wallet Wallet         `bson:"wallet"`
+	Exits  PositionExits  `bson:"exits"`
+	Risk   RiskManager    `bson:"risk"`
+
+	// fills of the open position
+	EntryQty   float64 `bson:"entry_qty"`
+	EntryValue float64 `bson:"entry_value"`
+	ExitQty    float64 `bson:"exit_qty"`
+	ExitValue  float64 `bson:"exit_value"`
+	Interest   float64 `bson:"interest"`
+
+	// order based execution, used when Params.Orders.EntryType is set
+	Engine       *FillEngine `bson:"engine,omitempty"`
+	EntryOrderID int64       `bson:"entry_order_id"`
+	ExitOrderID  int64       `bson:"exit_order_id"`
+	PendingSide  string      `bson:"pending_side"` // SideBuy or SideSell entry waiting for the exit order to complete
+	ExitReason   string      `bson:"exit_reason"`  // of the exit order, ExitReasonCrossover when empty
+
+	// live execution, used instead of the Engine when set
+	Executor   Executor   `bson:"-"`
+	Symbol     string     `bson:"-"`
+	Store      OrderStore `bson:"-"`           // optional lifecycle records of the orders placed through the Executor
+	LiveOrders []Order    `bson:"live_orders"` // orders placed through the Executor, as last seen
+
+	Atr      float64   `bson:"atr"`       // latest ATR for the sizer, NaN when not known
+	LastTime time.Time `bson:"last_time"` // time of the last bar or trade, for the borrow interest
+	NumFills int       `bson:"num_fills"`
+	Trades   []Trade   `bson:"-"` // closed trades. callers may consume and reset it
+
+	sizer Sizer
+}
+
+func NewTrader(params StrategyParams, wallet Wallet) *Trader {
+	t := &Trader{Params: params, Wallet: wallet, Atr: math.NaN()}
+	t.Init()
+	return t
+}
+
+// sets up the parts that are not persisted. call it after loading a Trader from the DB.
+func (t *Trader) Init() {
+	t.sizer = NewSizer(t.Params.Sizing)
+	t.Exits.Rules = t.Params.Exits
+	t.Risk.Limits = t.Params.Risk
+	if t.Params.Orders.EntryType == "" {
+		t.Engine = nil
+		return
+	}
+	if t.Engine == nil {
+		t.Engine = &FillEngine{}
+	}
+	t.Engine.Latency = t.Params.Orders.Latency
+	t.Engine.MaxParticipation = t.Params.Orders.MaxParticipation
+}
+
+// treats a position already in the wallet as opened at the given price and time
+func (t *Trader) AdoptPosition(price float64, at time.Time) {
+	if t.Wallet.BTC == 0 || t.Exits.IsOpen {
+		return
+	}
+	qty := math.Abs(t.Wallet.BTC)
+	if t.Wallet.BTC > 0 {
+		t.Exits.Open(price, at)
+	} else {
+		t.Exits.OpenShort(price, at)
+	}
+	t.EntryQty, t.EntryValue = qty, qty*price
+}
+
+func (t *Trader) OnBar(bar AggregatedTradeInfo) {
+	t.onPrice(bar.FirstTime, bar.LastTime, bar.FirstPrice, bar.MaxPrice, bar.MinPrice, bar.LastPrice, bar.Volume)
+}
+
+func (t *Trader) OnTrade(at time.Time, price float64, quantity float64) {
+	t.onPrice(at, at, price, price, price, price, quantity)
+}
+
+func (t *Trader) onPrice(start, end time.Time, open, high, low, close, volume float64) {
+	// orders placed before
+	if t.Engine != nil {
+		for _, f := range t.Engine.match(start, end, open, high, low, close, volume) {
+			t.onFill(f)
+		}
+	}
+
+	if t.Wallet.BTC < 0 {
+		// borrow interest since the last update
+		if !t.LastTime.IsZero() {
+			charge := t.Params.Margin.Interest(t.Wallet, close, end.Sub(t.LastTime))
+			t.Wallet.USDT -= charge
+			t.Interest += charge
+		}
+		// liquidation is checked against the high before the protective exits
+		if level := t.Params.Margin.LiquidationPrice(t.Wallet); high >= level {
+			t.closeNow(max(open, level), end, ExitReasonLiquidation)
+		}
+	}
+	t.LastTime = end
+
+	if price, reason := t.Exits.Check(open, high, low, close, end); reason != "" {
+		t.closeNow(price, end, reason)
+	}
+	t.Risk.OnEquity(t.Wallet.Equity(close), end)
+}
+
+// closes an opposite position and opens the one of the signal.
+// with orders, the entry is placed after the exit order completes.
+// returns the RiskReject* reason when the entry is blocked by the risk limits, the exit still happens.
+func (t *Trader) OnSignal(signal string, price float64, at time.Time) string {
+	entrySide := signal
+	if signal == SideSell && !t.Params.Margin.AllowShort {
+		entrySide = ""
+	}
+	return t.onSignal(signal, entrySide, price, at)
+}
+
+// closes an opposite position without opening the one of the signal, of the close-only signals while paused
+func (t *Trader) OnCloseSignal(signal string, price float64, at time.Time) {
+	t.onSignal(signal, "", price, at)
+}
+
+// signal with the side of its entry, "" for none
+func (t *Trader) onSignal(signal, entrySide string, price float64, at time.Time) string {
+	// an exit in flight that the signal turns against is replaced by the signal:
+	// the position a crossover exit was closing is kept, a protective exit is followed by the entry of the signal
+	if exit := t.order(t.ExitOrderID); exit != nil && exit.Side != signal {
+		if t.ExitReason == "" || t.ExitReason == ExitReasonCrossover {
+			t.cancel(exit.ID, at)
+			if t.order(exit.ID) == nil {
+				t.ExitOrderID, t.ExitReason = 0, ""
+			}
+			t.PendingSide = ""
+			return ""
+		}
+		rejection := ""
+		if entrySide != "" {
+			if rejection = t.checkEntry(entrySide, price, 0, at); rejection != "" {
+				entrySide = ""
+			}
+		}
+		t.PendingSide = entrySide
+		return rejection
+	}
+
+	// the entry is sized as if it was opened from flat at the signal price, and added to the position it keeps
+	rejection := ""
+	inPosition := (signal == SideBuy && t.Wallet.BTC > 0) || (signal == SideSell && t.Wallet.BTC < 0)
+	if entry := t.order(t.EntryOrderID); entrySide != "" && !inPosition && (entry == nil || entry.Side != signal) {
+		if rejection = t.checkEntry(entrySide, price, t.positionBefore(entrySide), at); rejection != "" {
+			entrySide = ""
+		}
+	}
+
+	// an entry of the other direction still waiting to fill is no longer wanted
+	if entry := t.order(t.EntryOrderID); entry != nil && entry.Side != signal {
+		t.cancel(entry.ID, at)
+		t.EntryOrderID = 0
+	}
+
+	isLong, isShort := t.Wallet.BTC > 0, t.Wallet.BTC < 0
+	if (signal == SideBuy && isShort) || (signal == SideSell && isLong) {
+		if t.Engine == nil {
+			t.Risk.RecordOrder(at)
+			t.closeFill(math.Abs(t.Wallet.BTC), price, at, ExitReasonCrossover)
+		} else {
+			if t.order(t.ExitOrderID) == nil {
+				t.ExitOrderID = t.submit(Order{Side: signal, Type: OrderTypeMarket, Quantity: math.Abs(t.Wallet.BTC), CreatedAt: at})
+				t.ExitReason = ExitReasonCrossover
+			}
+			t.PendingSide = entrySide
+			return rejection
+		}
+	}
+
+	if t.Wallet.BTC == 0 && t.order(t.EntryOrderID) == nil && entrySide != "" {
+		t.enter(entrySide, price, at)
+	}
+	return rejection
+}
+
+// risk check of an entry of side sized from flat at price, added to the signed position
+func (t *Trader) checkEntry(side string, price, position float64, at time.Time) string {
+	equity := t.Wallet.Equity(price)
+	qty := t.entryQty(side, Wallet{USDT: equity}, price)
+	if side == SideSell {
+		qty = -qty
+	}
+	return t.Risk.Check(qty, price, position, equity, at)
+}
+
+// signed BTC position an entry of side adds to: the current position and the unfilled rest of an entry of the side in flight.
+// an opposite position is closed before the entry
+func (t *Trader) positionBefore(side string) float64 {
+	pos := t.Wallet.BTC
+	if (side == SideBuy && pos < 0) || (side == SideSell && pos > 0) {
+		pos = 0
+	}
+	if entry := t.order(t.EntryOrderID); entry != nil && entry.Side == side {
+		rest := entry.Remaining()
+		if side == SideSell {
+			rest = -rest
+		}
+		pos += rest
+	}
+	return pos
+}
+
+// stops the entries by the kill switch of the RiskManager and cancels the entry in flight
+func (t *Trader) Kill(reason string, at time.Time) {
+	t.Risk.Kill(reason)
+	t.cancel(t.EntryOrderID, at)
+	t.EntryOrderID, t.PendingSide = 0, ""
+}
+
+// open order of the engine or the executor with the given id, or nil
+func (t *Trader) order(id int64) *Order {
+	if t.Engine == nil || id == 0 {
+		return nil
+	}
+	orders := t.Engine.Orders
+	if t.Executor != nil {
+		orders = nil
+		for i := range t.LiveOrders {
+			orders = append(orders, &t.LiveOrders[i])
+		}
+	}
+	for _, o := range orders {
+		if o.ID == id && o.IsOpen() {
+			return o
+		}
+	}
+	return nil
+}
+
+// places an order on the engine or the executor. returns its id, 0 if it could not be placed
+func (t *Trader) submit(o Order) int64 {
+	t.Risk.RecordOrder(o.CreatedAt)
+	if t.Executor == nil {
+		return t.Engine.Submit(o).ID
+	}
+	if o.ClientOrderID == "" {
+		o.ClientOrderID = NewClientOrderID()
+	}
+	t.record(o, OrderStateNew, "")
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutBeforeReturn)
+	defer cancel()
+	placed, err := t.Executor.PlaceOrder(ctx, t.Symbol, o)
+	if errors.Is(err, ErrOrderRejected) {
+		log.Printf("[Error] Cannot place %v %v order: %v\n", o.Side, o.Type, err)
+		t.record(o, OrderStateRejected, err.Error())
+		return 0
+	}
+	if err != nil {
+		// it may have reached the exchange, the record stays new and Reconcile looks it up
+		log.Printf("[Error] Status of %v %v order %v unknown: %v\n", o.Side, o.Type, o.ClientOrderID, err)
+		t.record(o, OrderStateNew, "status unknown: "+err.Error())
+		return 0
+	}
+	t.record(placed, OrderStateAcknowledged, "")
+	// fills at placement are applied by the next SyncOrders, when the caller has stored the id
+	placed.Status, placed.FilledQty, placed.AvgPrice = OrderStatusNew, 0, 0
+	t.LiveOrders = append(t.LiveOrders, placed)
+	return placed.ID
+}
+
+func (t *Trader) cancel(id int64, at time.Time) {
+	o := t.order(id)
+	if o == nil {
+		return
+	}
+	if t.Executor == nil {
+		t.Engine.Cancel(id)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutBeforeReturn)
+	defer cancel()
+	canceled, err := t.Executor.CancelOrder(ctx, t.Symbol, o.ClientOrderID)
+	if err != nil {
+		log.Printf("[Error] Cannot cancel order %v: %v\n", o.ClientOrderID, err)
+		return
+	}
+	t.liveUpdate(canceled, at)
+}
+
+// queries the open orders of the executor and applies their new fills
+func (t *Trader) SyncOrders(ctx context.Context, at time.Time) error {
+	if t.Executor == nil {
+		return nil
+	}
+	for i := 0; i < len(t.LiveOrders); i++ { // fills may place new orders
+		if !t.LiveOrders[i].IsOpen() {
+			continue
+		}
+		o, err := t.Executor.QueryOrder(ctx, t.Symbol, t.LiveOrders[i].ClientOrderID)
+		if err != nil {
+			return err
+		}
+		t.liveUpdate(o, at)
+	}
+
+	open := t.LiveOrders[:0]
+	for _, o := range t.LiveOrders {
+		if o.IsOpen() {
+			open = append(open, o)
+		}
+	}
+	t.LiveOrders = open
+	return nil
+}
+
+// forgets an order the executor does not know, and the entry or exit it was for
+func (t *Trader) dropLiveOrder(clientOrderID string) {
+	for i, o := range t.LiveOrders {
+		if o.ClientOrderID != clientOrderID {
+			continue
+		}
+		switch o.ID {
+		case t.EntryOrderID:
+			t.EntryOrderID = 0
+		case t.ExitOrderID:
+			t.ExitOrderID, t.ExitReason = 0, ""
+		}
+		t.LiveOrders = append(t.LiveOrders[:i], t.LiveOrders[i+1:]...)
+		return
+	}
+}
+
+// stores the lifecycle state of an order in the Store
+func (t *Trader) record(o Order, state string, reason string) {
+	if t.Store == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutBeforeReturn)
+	defer cancel()
+	if err := t.Store.Save(ctx, NewOrderRecord(t.Symbol, o, state, reason)); err != nil {
+		log.Printf("[Error] Cannot store order %v: %v\n", o.ClientOrderID, err)
+	}
+}
+
+// stores the executor's view of an order and turns the quantity filled since the last view into a fill
+func (t *Trader) liveUpdate(o Order, at time.Time) {
+	for i := range t.LiveOrders {
+		last := t.LiveOrders[i]
+		if last.ClientOrderID != o.ClientOrderID {
+			continue
+		}
+		t.LiveOrders[i] = o
+		if o.Status != last.Status || o.FilledQty != last.FilledQty {
+			t.record(o, OrderStateOf(o.Status), "")
+		}
+		if qty := o.FilledQty - last.FilledQty; qty > 0 {
+			price := (o.AvgPrice*o.FilledQty - last.AvgPrice*last.FilledQty) / qty
+			t.onFill(Fill{OrderID: o.ID, Side: o.Side, Time: at, Price: price, Quantity: qty})
+		}
+		return
+	}
+}
+
+// quantity of an entry from the given flat wallet, sized by the sizer
+func (t *Trader) entryQty(side string, w Wallet, price float64) float64 {
+	equity := w.Equity(price)
+	qty := t.sizer.Size(Wallet{USDT: equity}, price, t.Atr)
+	if side == SideSell {
+		// sized as a long position of the equity would be, within the margin limits
+		return min(qty, t.Params.Margin.MaxShortQty(equity, price))
+	}
+	return min(qty, w.USDT/price)
+}
+
+// opens a position sized by the sizer, instantly or by placing an entry order
+func (t *Trader) enter(side string, price float64, at time.Time) {
+	qty := t.entryQty(side, t.Wallet, price)
+	if qty <= 0 {
+		return
+	}
+
+	if t.Engine == nil {
+		t.Risk.RecordOrder(at)
+		t.openFill(side == SideSell, qty, price, at)
+		return
+	}
+
+	cfg := t.Params.Orders
+	order := Order{Side: side, Type: cfg.EntryType, TimeInForce: cfg.TimeInForce, Quantity: qty, CreatedAt: at}
+	if cfg.CancelAfter > 0 {
+		order.ExpiresAt = at.Add(cfg.Latency + cfg.CancelAfter)
+	}
+	// limit entries wait for a better price, stop entries for a confirmation of the move
+	dir := 1.0
+	if side == SideSell {
+		dir = -1
+	}
+	order.LimitPrice = price * (1 - dir*cfg.EntryOffset)
+	order.StopPrice = price * (1 + dir*cfg.EntryOffset)
+	t.EntryOrderID = t.submit(order)
+}
+
+func (t *Trader) onFill(f Fill) {
+	switch f.OrderID {
+	case t.EntryOrderID:
+		t.openFill(f.Side == SideSell, f.Quantity, f.Price, f.Time)
+		if t.order(t.EntryOrderID) == nil {
+			t.EntryOrderID = 0
+		}
+	case t.ExitOrderID:
+		reason := t.ExitReason
+		if reason == "" {
+			reason = ExitReasonCrossover
+		}
+		t.closeFill(f.Quantity, f.Price, f.Time, reason)
+		if t.order(t.ExitOrderID) == nil {
+			t.ExitOrderID, t.ExitReason = 0, ""
+		}
+		if t.Wallet.BTC == 0 && t.PendingSide != "" {
+			side := t.PendingSide
+			t.PendingSide = ""
+			t.enter(side, f.Price, f.Time)
+		}
+	}
+}
+
+func (t *Trader) openFill(isShort bool, qty, price float64, at time.Time) {
+	if isShort {
+		qty = t.Wallet.Short(qty, price)
+	} else {
+		qty = t.Wallet.Buy(qty, price)
+	}
+	if qty <= 0 {
+		return
+	}
+	if t.EntryQty == 0 {
+		if isShort {
+			t.Exits.OpenShort(price, at)
+		} else {
+			t.Exits.Open(price, at)
+		}
+	}
+	t.EntryQty += qty
+	t.EntryValue += qty * price
+	t.Exits.EntryPrice = t.EntryValue / t.EntryQty
+	t.NumFills++
+}
+
+// reduces the open position. records the trade when it is fully closed.
+func (t *Trader) closeFill(qty, price float64, at time.Time, reason string) {
+	if t.Exits.IsShort {
+		qty = t.Wallet.Cover(qty, price)
+	} else {
+		qty = t.Wallet.Sell(qty, price)
+	}
+	if qty <= 0 {
+		return
+	}
+	t.ExitQty += qty
+	t.ExitValue += qty * price
+	t.NumFills++
+	if t.Wallet.BTC != 0 {
+		return
+	}
+
+	avgEntry, avgExit := t.EntryValue/t.EntryQty, t.ExitValue/t.ExitQty
+	trade := Trade{
+		IsShort:    t.Exits.IsShort,
+		EntryTime:  t.Exits.EntryTime,
+		ExitTime:   at,
+		EntryPrice: avgEntry,
+		ExitPrice:  avgExit,
+		Quantity:   t.EntryQty,
+		Interest:   t.Interest,
+		ExitReason: reason,
+	}
+	if trade.IsShort {
+		trade.Return = 1 - avgExit/avgEntry
+		trade.PnL = t.EntryValue - t.ExitValue - t.Interest
+	} else {
+		trade.Return = avgExit/avgEntry - 1
+		trade.PnL = t.ExitValue - t.EntryValue
+	}
+	t.Trades = append(t.Trades, trade)
+	if o, ok := t.sizer.(TradeObserver); ok {
+		o.Observe(trade.Return)
+	}
+	t.Exits.Close()
+	t.EntryQty, t.EntryValue, t.ExitQty, t.ExitValue, t.Interest = 0, 0, 0, 0, 0
+}
+
+// closes the whole position instantly and cancels the orders in flight.
+// with an executor a market exit order is placed instead, unless one is already open.
+func (t *Trader) closeNow(price float64, at time.Time, reason string) {
+	if t.Executor != nil {
+		t.cancel(t.EntryOrderID, at)
+		t.EntryOrderID, t.PendingSide = 0, ""
+		if t.Wallet.BTC == 0 || t.order(t.ExitOrderID) != nil {
+			return
+		}
+		side := SideSell
+		if t.Wallet.BTC < 0 {
+			side = SideBuy
+		}
+		t.ExitOrderID = t.submit(Order{Side: side, Type: OrderTypeMarket, Quantity: math.Abs(t.Wallet.BTC), CreatedAt: at})
+		t.ExitReason = reason
+		return
+	}
+	if t.Engine != nil {
+		t.Engine.Cancel(t.EntryOrderID)
+		t.Engine.Cancel(t.ExitOrderID)
+		t.EntryOrderID, t.ExitOrderID, t.PendingSide = 0, 0, ""
+	}
+	t.closeFill(math.Abs(t.Wallet.BTC), price, at, reason)
+}
+
+// profit of the open position at the given price, before borrow interest
+func (t *Trader) UnrealizedPnL(price float64) float64 {
+	if t.Wallet.BTC == 0 || t.EntryQty == 0 {
+		return 0
+	}
+	avgEntry := t.EntryValue / t.EntryQty
+	return t.Wallet.BTC * (price - avgEntry)
+}
@@ -0,0 +1,67 @@
+package shared
+
+// BTC is negative while short. USDT then also holds the proceeds of the short sale.
+type Wallet struct {
+	BTC  float64
+	USDT float64
+}
+
+func (w *Wallet) BuyAll(price float64) {
+	btcToBuy := w.USDT / price
+	w.BTC += btcToBuy
+	w.USDT = 0
+}
+
+func (w *Wallet) SellAll(price float64) {
+	usdtToBuy := w.BTC * price
+	w.USDT += usdtToBuy
+	w.BTC = 0
+}
+
+// value of the wallet in USDT at the given price
+func (w *Wallet) Equity(price float64) float64 {
+	return w.USDT + w.BTC*price
+}
+
+// buys up to qty BTC, limited by the USDT balance. returns the bought quantity.
+func (w *Wallet) Buy(qty float64, price float64) float64 {
+	qty = min(qty, w.USDT/price)
+	if qty <= 0 {
+		return 0
+	}
+	w.BTC += qty
+	w.USDT -= qty * price
+	return qty
+}
+
+// sells up to qty BTC, limited by the BTC balance. returns the sold quantity.
+func (w *Wallet) Sell(qty float64, price float64) float64 {
+	qty = min(qty, w.BTC)
+	if qty <= 0 {
+		return 0
+	}
+	w.BTC -= qty
+	w.USDT += qty * price
+	return qty
+}
+
+// sells qty borrowed BTC
+func (w *Wallet) Short(qty float64, price float64) float64 {
+	if qty <= 0 {
+		return 0
+	}
+	w.BTC -= qty
+	w.USDT += qty * price
+	return qty
+}
+
+// buys back up to qty of the short position. USDT may become negative if losses exceed it.
+func (w *Wallet) Cover(qty float64, price float64) float64 {
+	qty = min(qty, -w.BTC)
+	if qty <= 0 {
+		return 0
+	}
+	w.BTC += qty
+	w.USDT -= qty * price
+	return qty
+}
@@ -0,0 +1,210 @@
+package shared
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// headers of the webhook requests. the signature is the hex HMAC-SHA256 of "<timestamp>.<body>" with the secret
+const (
+	WebhookSignatureHeader = "X-Tradebot-Signature"
+	WebhookTimestampHeader = "X-Tradebot-Timestamp"
+)
+
+// webhook deliveries by result: delivered, retried or dead_letter
+var WebhookDeliveries = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "signal_webhook_deliveries_total",
+		Help: "Signal webhook delivery attempts by result",
+	},
+	[]string{"result"},
+)
+
+// payload that could not be delivered
+type DeadLetter struct {
+	URL      string    `bson:"url"`
+	Payload  string    `bson:"payload"`
+	Error    string    `bson:"error"`
+	Attempts int       `bson:"attempts"`
+	Time     time.Time `bson:"time"`
+}
+
+type DeadLetterStore interface {
+	Store(ctx context.Context, letter DeadLetter) error
+}
+
+type MongoDeadLetterStore struct {
+	Collection *mongo.Collection
+}
+
+func (s *MongoDeadLetterStore) Store(ctx context.Context, letter DeadLetter) error {
+	_, err := s.Collection.InsertOne(ctx, letter)
+	return err
+}
+
+// delivers payloads to HTTP webhooks in the background, each webhook from its own queue
+// so a slow or failing one does not hold the others up. each delivery is a signed POST,
+// retried with exponential backoff on network errors, 429 and 5xx responses.
+// payloads that are not delivered after MaxAttempts go to the DeadLetters.
+type WebhookDispatcher struct {
+	URLs        []string
+	Secret      string // HMAC key, requests are not signed when empty
+	MaxAttempts int
+	Backoff     time.Duration // before the first retry, doubled after each
+	Client      *http.Client
+	DeadLetters DeadLetterStore
+
+	queues map[string]chan []byte // by URL
+	done   sync.WaitGroup
+}
+
+// webhooks of SIGNAL_WEBHOOKS (comma separated URLs) signed with SIGNAL_WEBHOOK_SECRET,
+// SIGNAL_WEBHOOK_ATTEMPTS tries per payload. returns nil when no webhook is configured.
+func WebhookDispatcherFromEnv(deadLetters DeadLetterStore) *WebhookDispatcher {
+	var urls []string
+	for _, u := range strings.Split(os.Getenv("SIGNAL_WEBHOOKS"), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+	d := &WebhookDispatcher{
+		URLs:        urls,
+		Secret:      os.Getenv("SIGNAL_WEBHOOK_SECRET"),
+		MaxAttempts: 5,
+		Backoff:     time.Second,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		DeadLetters: deadLetters,
+	}
+	envInt("SIGNAL_WEBHOOK_ATTEMPTS", &d.MaxAttempts)
+	return d
+}
+
+// starts a delivery goroutine per webhook. queueSize payloads can wait for each, more are dead-lettered.
+func (d *WebhookDispatcher) Start(queueSize int) {
+	d.queues = make(map[string]chan []byte, len(d.URLs))
+	for _, u := range d.URLs {
+		queue := make(chan []byte, queueSize)
+		d.queues[u] = queue
+		d.done.Add(1)
+		go func() {
+			defer d.done.Done()
+			for payload := range queue {
+				d.Deliver(context.Background(), u, payload)
+			}
+		}()
+	}
+}
+
+// queues the payload for all webhooks without blocking
+func (d *WebhookDispatcher) Dispatch(payload []byte) {
+	for u, queue := range d.queues {
+		select {
+		case queue <- payload:
+		default:
+			log.Printf("[Warning] Webhook queue of %v is full, dead-lettering the payload\n", u)
+			d.deadLetter(u, payload, fmt.Errorf("queue full"), 0)
+		}
+	}
+}
+
+// delivers the queued payloads and stops
+func (d *WebhookDispatcher) Close() {
+	for _, queue := range d.queues {
+		close(queue)
+	}
+	d.done.Wait()
+}
+
+// posts the payload to url until it is accepted or MaxAttempts is reached
+func (d *WebhookDispatcher) Deliver(ctx context.Context, url string, payload []byte) error {
+	backoff := d.Backoff
+	var err error
+	attempt := 0
+	for attempt < max(d.MaxAttempts, 1) {
+		if attempt++; attempt > 1 {
+			WebhookDeliveries.WithLabelValues("retried").Inc()
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			backoff *= 2
+		}
+		var retry bool
+		if retry, err = d.post(ctx, url, payload); err == nil {
+			WebhookDeliveries.WithLabelValues("delivered").Inc()
+			return nil
+		}
+		log.Printf("[Warning] Webhook %v attempt %v failed: %v\n", url, attempt, err)
+		if !retry {
+			break
+		}
+	}
+	d.deadLetter(url, payload, err, attempt)
+	return err
+}
+
+// sends one request. returns whether a failure is worth retrying
+func (d *WebhookDispatcher) post(ctx context.Context, url string, payload []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if d.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(WebhookTimestampHeader, timestamp)
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(d.Secret, timestamp, payload))
+	}
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	retry := res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+	return retry, fmt.Errorf("status %v", res.Status)
+}
+
+func (d *WebhookDispatcher) deadLetter(url string, payload []byte, err error, attempts int) {
+	WebhookDeliveries.WithLabelValues("dead_letter").Inc()
+	if d.DeadLetters == nil {
+		log.Printf("[Error] Dropping undeliverable webhook payload for %v: %v\n", url, err)
+		return
+	}
+	letter := DeadLetter{URL: url, Payload: string(payload), Error: err.Error(), Attempts: attempts, Time: time.Now()}
+	if err := d.DeadLetters.Store(context.Background(), letter); err != nil {
+		log.Printf("[Error] Failed to store dead letter: %v\n", err)
+	}
+}
+
+// hex HMAC-SHA256 of "<timestamp>.<payload>", for receivers to verify the WebhookSignatureHeader
+func SignWebhook(secret string, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
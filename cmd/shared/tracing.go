@@ -0,0 +1,75 @@
+package shared
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer of the pipeline stages. spans are not recorded until InitTracing sets up the exporter
+var tracer = otel.Tracer("github.com/kaanureyen/tradebot")
+
+// exports the spans over OTLP/gRPC to OTEL_EXPORTER_OTLP_ENDPOINT, e.g. http://localhost:4317 of a local collector.
+// tracing is off without it. sampling follows OTEL_TRACES_SAMPLER and OTEL_TRACES_SAMPLER_ARG.
+// returns the endpoint, empty when off, and the flush of the spans left
+func InitTracing(service string) (string, func(context.Context) error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	if endpoint == "" {
+		return "", func(context.Context) error { return nil }
+	}
+	exporter, err := otlptracegrpc.New(context.Background()) // configured by the OTEL_EXPORTER_OTLP_* variables
+	if err != nil {
+		log.Printf("[Error] Tracing is off, cannot create the OTLP exporter: %v\n", err)
+		return "", func(context.Context) error { return nil }
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", service)))
+	if err != nil {
+		res = resource.Default()
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	log.Printf("[Info] Exporting traces to %v\n", endpoint)
+	return endpoint, provider.Shutdown
+}
+
+// starts the span of a pipeline stage
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// ends the span, marking it failed when err is not nil
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// trace context of ctx as the headers carried in a Redis message, nil when ctx is not traced
+func TraceCarrier(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// context with the trace context carried in a Redis message, the parent of the spans of the next stage
+func TraceContext(carrier map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(carrier))
+}
@@ -0,0 +1,55 @@
+package shared
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracePropagation(t *testing.T) {
+	if c := TraceCarrier(context.Background()); c != nil {
+		t.Errorf("got carrier %v without a trace; want nil", c)
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	}()
+
+	// publisher side
+	ctx, publish := StartSpan(context.Background(), "publish")
+	data, _ := json.Marshal(TradeDatePrice{TradeDate: 1, Price: "1.5", Trace: TraceCarrier(ctx)})
+	publish.End()
+
+	// consumer side
+	in := make(chan string, 1)
+	in <- string(data)
+	close(in)
+	v := <-UnmarshalTradeDatePrice(in)
+	_, next := StartSpan(TraceContext(v.Trace), "aggregate")
+	next.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("got %v spans; want publish, unmarshal and aggregate", len(spans))
+	}
+	for i, name := range []string{"publish", "unmarshal", "aggregate"} {
+		s := spans[i]
+		if s.Name() != name || s.SpanContext().TraceID() != spans[0].SpanContext().TraceID() {
+			t.Errorf("got span %v of trace %v; want %v of trace %v", s.Name(), s.SpanContext().TraceID(), name, spans[0].SpanContext().TraceID())
+		}
+		if i > 0 && s.Parent().SpanID() != spans[i-1].SpanContext().SpanID() {
+			t.Errorf("%v is not the child of %v", s.Name(), spans[i-1].Name())
+		}
+	}
+}
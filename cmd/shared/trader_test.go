@@ -0,0 +1,91 @@
+package shared
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTraderOnTrade(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	params := StrategyParams{
+		Orders: OrderConfig{EntryType: OrderTypeMarket, Latency: time.Second},
+		Exits:  ExitRules{StopLoss: 0.1},
+	}
+	trader := NewTrader(params, Wallet{USDT: 100})
+
+	trader.OnSignal(SideBuy, 10, start)
+	trader.OnTrade(start.Add(500*time.Millisecond), 10, 1)
+	if trader.Wallet.BTC != 0 {
+		t.Fatalf("got filled before the latency elapsed")
+	}
+	trader.OnTrade(start.Add(2*time.Second), 11, 1)
+	if trader.Wallet.BTC != 100.0/11 {
+		t.Fatalf("got %v BTC; want %v", trader.Wallet.BTC, 100.0/11)
+	}
+
+	// stop at 9.9
+	trader.OnTrade(start.Add(3*time.Second), 9.5, 1)
+	if trader.Wallet.BTC != 0 || len(trader.Trades) != 1 {
+		t.Fatalf("got %v BTC, %v trades; want the stop to close the position", trader.Wallet.BTC, len(trader.Trades))
+	}
+	if got := trader.Trades[0]; got.ExitReason != ExitReasonStopLoss || got.ExitPrice != 9.5 {
+		t.Errorf("got %v at %v; want %v at 9.5", got.ExitReason, got.ExitPrice, ExitReasonStopLoss)
+	}
+}
+
+// a signal against the exit in flight replaces the entry waiting for it
+func TestTraderSignalReplacesPending(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	params := StrategyParams{
+		Sizing: DefaultSizingConfig(),
+		Margin: MarginConfig{AllowShort: true, MaxLeverage: 1, InitialMargin: 1, MaintenanceMargin: 0.5},
+		Orders: OrderConfig{EntryType: OrderTypeMarket, Latency: time.Minute},
+	}
+	trader := NewTrader(params, Wallet{USDT: 1000})
+	trader.OnSignal(SideBuy, 100, start)
+	trader.OnTrade(start.Add(2*time.Minute), 100, 100)
+	long := trader.Wallet.BTC
+	if long <= 0 {
+		t.Fatalf("got %v BTC; want long", long)
+	}
+
+	// the SELL exits and waits to go short, the BUY before the exit fills keeps the long
+	trader.OnSignal(SideSell, 90, start.Add(3*time.Minute))
+	if trader.PendingSide != SideSell || trader.order(trader.ExitOrderID) == nil {
+		t.Fatalf("got pending %q, exit %v; want a short after the exit", trader.PendingSide, trader.ExitOrderID)
+	}
+	trader.OnSignal(SideBuy, 95, start.Add(3*time.Minute+time.Second))
+	if trader.PendingSide != "" || trader.ExitOrderID != 0 || len(trader.Engine.OpenOrders()) != 0 {
+		t.Errorf("got pending %q, exit %v, %v open orders; want the exit canceled", trader.PendingSide, trader.ExitOrderID, len(trader.Engine.OpenOrders()))
+	}
+	trader.OnTrade(start.Add(5*time.Minute), 95, 100)
+	if trader.Wallet.BTC != long {
+		t.Errorf("got %v BTC; want the long of %v kept", trader.Wallet.BTC, long)
+	}
+}
+
+// a close-only signal closes the long without going short
+func TestTraderCloseSignal(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	params := StrategyParams{
+		Sizing: DefaultSizingConfig(),
+		Margin: MarginConfig{AllowShort: true, MaxLeverage: 1, InitialMargin: 1, MaintenanceMargin: 0.5},
+		Orders: OrderConfig{EntryType: OrderTypeMarket, Latency: time.Minute},
+	}
+	trader := NewTrader(params, Wallet{USDT: 1000})
+	trader.OnSignal(SideBuy, 100, start)
+	trader.OnTrade(start.Add(2*time.Minute), 100, 100)
+	if trader.Wallet.BTC <= 0 {
+		t.Fatalf("got %v BTC; want long", trader.Wallet.BTC)
+	}
+
+	trader.OnCloseSignal(SideSell, 90, start.Add(3*time.Minute))
+	if trader.PendingSide != "" || trader.order(trader.ExitOrderID) == nil {
+		t.Fatalf("got pending %q, exit %v; want the exit without an entry after it", trader.PendingSide, trader.ExitOrderID)
+	}
+	trader.OnTrade(start.Add(5*time.Minute), 90, 100)
+	trader.OnTrade(start.Add(7*time.Minute), 90, 100)
+	if trader.Wallet.BTC != 0 || len(trader.Trades) != 1 {
+		t.Errorf("got %v BTC, %v trades; want flat after the long closed", trader.Wallet.BTC, len(trader.Trades))
+	}
+}
@@ -0,0 +1,95 @@
+package shared
+
+import (
+	"errors"
+	"time"
+)
+
+// window lengths in number of bars. Step defaults to OutOfSample, giving back-to-back out-of-sample windows.
+type WalkForwardConfig struct {
+	InSample    int
+	OutOfSample int
+	Step        int
+}
+
+type WalkForwardWindow struct {
+	InSampleStart    time.Time
+	InSampleEnd      time.Time
+	OutOfSampleStart time.Time
+	OutOfSampleEnd   time.Time
+	InSample         BacktestResult // best result of the grid search on the in-sample window
+	OutOfSample      BacktestResult // result of the chosen parameters on the following out-of-sample window
+}
+
+type WalkForwardResult struct {
+	Windows []WalkForwardWindow
+	// out-of-sample windows chained together. each window starts with the wallet the previous one ended with.
+	StartEquity float64
+	EndEquity   float64
+	Return      float64
+	MaxDrawdown float64
+	NumTrades   int
+	Long        SideMetrics
+	Short       SideMetrics
+	Equity      []EquityPoint
+}
+
+// splits bars into rolling in-sample/out-of-sample windows. parameters are optimized by grid search
+// on each in-sample window and then evaluated on the out-of-sample window right after it.
+func WalkForward(bars []AggregatedTradeInfo, cfg WalkForwardConfig, grid ParamGrid, wallet Wallet) (WalkForwardResult, error) {
+	var result WalkForwardResult
+	if cfg.Step <= 0 {
+		cfg.Step = cfg.OutOfSample
+	}
+	if cfg.InSample <= 0 || cfg.OutOfSample <= 0 {
+		return result, errors.New("in-sample and out-of-sample window lengths must be positive")
+	}
+	if cfg.Step < cfg.OutOfSample {
+		return result, errors.New("step must not be shorter than the out-of-sample window, out-of-sample windows would overlap")
+	}
+	if len(grid.Combinations()) == 0 {
+		return result, errors.New("parameter grid has no valid combinations")
+	}
+	if cfg.InSample < grid.MaxLongTerm() {
+		return result, errors.New("in-sample window is shorter than the longest SMA of the grid")
+	}
+	if len(bars) < cfg.InSample+cfg.OutOfSample {
+		return result, errors.New("not enough bars for a single walk-forward window")
+	}
+
+	for start := 0; start+cfg.InSample+cfg.OutOfSample <= len(bars); start += cfg.Step {
+		inEnd := start + cfg.InSample
+		outEnd := inEnd + cfg.OutOfSample
+
+		best := GridSearch(bars[start:inEnd], 0, grid, Wallet{USDT: wallet.Equity(bars[inEnd-1].LastPrice)})[0]
+
+		// feed the bars before the out-of-sample window as warmup so the SMAs are ready at its first bar
+		warmup := best.Params.SmaLongTerm
+		oos := Backtest(bars[inEnd-warmup:outEnd], warmup, best.Params, wallet)
+		wallet = oos.EndWallet
+
+		result.Windows = append(result.Windows, WalkForwardWindow{
+			InSampleStart:    bars[start].LastTime,
+			InSampleEnd:      bars[inEnd-1].LastTime,
+			OutOfSampleStart: bars[inEnd].LastTime,
+			OutOfSampleEnd:   bars[outEnd-1].LastTime,
+			InSample:         best,
+			OutOfSample:      oos,
+		})
+		result.NumTrades += oos.NumTrades
+		result.Equity = append(result.Equity, oos.Equity...)
+	}
+
+	result.StartEquity = result.Windows[0].OutOfSample.StartEquity
+	result.EndEquity = result.Equity[len(result.Equity)-1].Equity
+	if result.StartEquity > 0 {
+		result.Return = result.EndEquity/result.StartEquity - 1
+	}
+	result.MaxDrawdown = maxDrawdown(result.Equity)
+	var trades []Trade
+	for _, w := range result.Windows {
+		trades = append(trades, w.OutOfSample.Trades...)
+	}
+	result.Long, result.Short = SummarizeTrades(trades)
+	return result, nil
+}
@@ -0,0 +1,88 @@
+package shared
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryDeadLetters struct {
+	mu      sync.Mutex
+	letters []DeadLetter
+}
+
+func (s *memoryDeadLetters) Store(ctx context.Context, letter DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.letters = append(s.letters, letter)
+	return nil
+}
+
+func TestWebhookDispatcher(t *testing.T) {
+	payload := []byte(`{"signal":"BUY","price":100}`)
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		want := SignWebhook("secret", r.Header.Get(WebhookTimestampHeader), body)
+		if got := r.Header.Get(WebhookSignatureHeader); got != want {
+			t.Errorf("got signature %q; want %q", got, want)
+		}
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer rejecting.Close()
+
+	deadLetters := &memoryDeadLetters{}
+	d := &WebhookDispatcher{URLs: []string{server.URL, rejecting.URL}, Secret: "secret", MaxAttempts: 3, Backoff: time.Millisecond, DeadLetters: deadLetters}
+	d.Start(10)
+	d.Dispatch(payload)
+	d.Close()
+
+	if calls != 3 {
+		t.Errorf("got %v calls; want 3, delivered on the last retry", calls)
+	}
+	// 4xx is not retried
+	if len(deadLetters.letters) != 1 || deadLetters.letters[0].URL != rejecting.URL || deadLetters.letters[0].Attempts != 1 {
+		t.Fatalf("got dead letters %+v; want one for the rejecting webhook after 1 attempt", deadLetters.letters)
+	}
+	if deadLetters.letters[0].Payload != string(payload) {
+		t.Errorf("got payload %q; want %q", deadLetters.letters[0].Payload, payload)
+	}
+}
+
+func TestWebhookDispatcherSlowWebhook(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	delivered := make(chan struct{}, 2)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered <- struct{}{}
+	}))
+	defer fast.Close()
+
+	d := &WebhookDispatcher{URLs: []string{slow.URL, fast.URL}, MaxAttempts: 1}
+	d.Start(10)
+	d.Dispatch([]byte(`{"n":1}`))
+	d.Dispatch([]byte(`{"n":2}`))
+	for range 2 {
+		select {
+		case <-delivered:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the fast webhook waits for the slow one")
+		}
+	}
+	close(release)
+	d.Close()
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
+	"strconv"
+	"strings"
 
 	"github.com/kaanureyen/tradebot/cmd/shared"
 	"go.mongodb.org/mongo-driver/bson"
@@ -11,9 +14,49 @@ import (
 )
 
 func main() {
-	shutdownOrchestrator := shared.InitCommon("simulator") // set logger name, start http health endpoint, initialize & start shutdownOrchestrator
+	mode := flag.String("mode", "replay", "replay: replay stored trade signals, grid: grid search over all history, walkforward: walk-forward optimization")
+	n := flag.Int("n", 999999, "number of the last signals (replay) or bars (grid, walkforward) to load")
+	usdt := flag.Float64("usdt", 1000, "starting USDT balance")
+	shortTerms := flag.String("short", "10,20,50", "comma separated short SMA lengths to search")
+	longTerms := flag.String("long", "100,200,400", "comma separated long SMA lengths to search")
+	inSample := flag.Int("insample", 5760, "in-sample window length in bars (walkforward)")
+	outOfSample := flag.Int("outsample", 1440, "out-of-sample window length in bars (walkforward)")
+	step := flag.Int("step", 0, "bars to move the windows forward each time, defaults to outsample (walkforward)")
+	sizing := shared.SizingConfigFromEnv()
+	flag.StringVar(&sizing.Policy, "sizing", sizing.Policy, "position sizing policy: fraction, notional, volatility or kelly")
+	flag.Float64Var(&sizing.Fraction, "fraction", sizing.Fraction, "fraction of equity per position (fraction, kelly fallback)")
+	flag.Float64Var(&sizing.Notional, "notional", sizing.Notional, "USDT per position (notional)")
+	flag.Float64Var(&sizing.RiskFraction, "risk", sizing.RiskFraction, "fraction of equity risked on an atrmult*ATR move (volatility)")
+	flag.Float64Var(&sizing.AtrMultiple, "atrmult", sizing.AtrMultiple, "ATR multiple (volatility)")
+	flag.IntVar(&sizing.AtrPeriod, "atrperiod", sizing.AtrPeriod, "ATR period in bars (volatility)")
+	flag.Float64Var(&sizing.KellyCap, "kellycap", sizing.KellyCap, "upper limit of the kelly fraction (kelly)")
+	flag.IntVar(&sizing.KellyTrades, "kellytrades", sizing.KellyTrades, "closed trades before the kelly fraction is used (kelly)")
+	exits := shared.ExitRulesFromEnv()
+	flag.Float64Var(&exits.StopLoss, "stoploss", exits.StopLoss, "stop-loss distance below entry, 0.02 is 2%. 0 disables")
+	flag.Float64Var(&exits.TakeProfit, "takeprofit", exits.TakeProfit, "take-profit distance above entry. 0 disables")
+	flag.Float64Var(&exits.TrailingStop, "trailing", exits.TrailingStop, "trailing stop distance below the highest price since entry. 0 disables")
+	flag.DurationVar(&exits.MaxHold, "maxhold", exits.MaxHold, "close positions held longer than this. 0 disables")
+	margin := shared.MarginConfigFromEnv()
+	flag.BoolVar(&margin.AllowShort, "allowshort", margin.AllowShort, "SELL opens a short position")
+	flag.Float64Var(&margin.MaxLeverage, "maxleverage", margin.MaxLeverage, "upper limit of short notional / equity")
+	flag.Float64Var(&margin.InitialMargin, "initialmargin", margin.InitialMargin, "equity / short notional needed to open a short")
+	flag.Float64Var(&margin.MaintenanceMargin, "maintmargin", margin.MaintenanceMargin, "short is liquidated below this equity / short notional")
+	flag.Float64Var(&margin.BorrowRate, "borrowrate", margin.BorrowRate, "yearly borrow interest of shorted BTC, 0.1 is 10%")
+	orders := shared.OrderConfigFromEnv()
+	flag.StringVar(&orders.EntryType, "ordertype", orders.EntryType, "entry order type: MARKET, LIMIT or STOP. empty fills signals instantly at the bar close")
+	flag.Float64Var(&orders.EntryOffset, "offset", orders.EntryOffset, "distance of LIMIT/STOP entries from the signal price, 0.001 is 0.1%")
+	flag.StringVar(&orders.TimeInForce, "tif", orders.TimeInForce, "time in force of entries: GTC, IOC or FOK")
+	flag.DurationVar(&orders.CancelAfter, "cancelafter", orders.CancelAfter, "unfilled entries expire after this. 0 for never")
+	flag.DurationVar(&orders.Latency, "latency", orders.Latency, "orders become active this long after they are placed")
+	flag.Float64Var(&orders.MaxParticipation, "participation", orders.MaxParticipation, "upper limit of the fills of all orders in a bar as a fraction of its volume. 0 for no limit")
+	flag.Parse()
+	if sizing.Policy != "" && !shared.IsSizingPolicy(sizing.Policy) {
+		log.Fatalf("[Fatal][Error] Unknown sizing policy %q, expected one of %v\n", sizing.Policy, shared.SizingPolicies)
+	}
+
+	shutdownOrchestrator, admin := shared.InitCommon("simulator") // set logger name, start admin server, initialize & start shutdownOrchestrator
 	defer func() {
-		<-shutdownOrchestrator.Done // blocks until every shutdownOrchestrator.Get()'s recv is sent an empty struct, after a interrupt/terminate signal.
+		<-shutdownOrchestrator.Done // closed once every phase of the shutdown finished or timed out, after a interrupt/terminate signal.
 		log.Println("[Info] Exiting...")
 	}()
 
@@ -21,33 +64,86 @@ func main() {
 	client, ctx := shared.MongoConnect()
 	defer client.Disconnect(ctx)
 
-	collTrade := shared.MongoTradeCollection(client, ctx)
-	w := Wallet{
+	w := shared.Wallet{
 		BTC:  0,
-		USDT: 1000,
+		USDT: *usdt,
+	}
+	grid := shared.ParamGrid{
+		SmaShortTerms: parseIntList(*shortTerms),
+		SmaLongTerms:  parseIntList(*longTerms),
+		Sizing:        sizing,
+		Exits:         exits,
+		Margin:        margin,
+		Orders:        orders,
+	}
+
+	flag.VisitAll(func(f *flag.Flag) {
+		admin.SetConfig(f.Name, f.Value.String())
+	})
+
+	switch *mode {
+	case "replay":
+		collTrade := shared.MongoTradeCollection(client, ctx)
+		SimulateLastN(collTrade, *n, w)
+	case "grid":
+		bars := shared.LoadLastNBars(shared.MongoAggregateCollection(client, ctx), *n)
+		for _, r := range shared.GridSearch(bars, 0, grid, w) {
+			logResult(r)
+		}
+	case "walkforward":
+		bars := shared.LoadLastNBars(shared.MongoAggregateCollection(client, ctx), *n)
+		res, err := shared.WalkForward(bars, shared.WalkForwardConfig{InSample: *inSample, OutOfSample: *outOfSample, Step: *step}, grid, w)
+		if err != nil {
+			log.Printf("[Error] Walk-forward failed: %v\n", err)
+			return
+		}
+		for i, win := range res.Windows {
+			log.Printf("Window %v: in-sample [%v, %v] out-of-sample [%v, %v]\n", i, win.InSampleStart, win.InSampleEnd, win.OutOfSampleStart, win.OutOfSampleEnd)
+			log.Println("  In-sample best:")
+			logResult(win.InSample)
+			log.Println("  Out-of-sample:")
+			logResult(win.OutOfSample)
+		}
+		log.Printf("Stitched out-of-sample: Start %.2f End %.2f Return %.2f%% MaxDrawdown %.2f%% Trades %v\n",
+			res.StartEquity, res.EndEquity, res.Return*100, res.MaxDrawdown*100, res.NumTrades)
+		logSideMetrics(res.Long, res.Short)
+	default:
+		log.Printf("[Error] Unknown mode: %v\n", *mode)
 	}
-	SimulateLastN(collTrade, 999999, w)
 }
 
-type Wallet struct {
-	BTC  float64
-	USDT float64
+func logResult(r shared.BacktestResult) {
+	exitReasons := map[string]int{}
+	for _, t := range r.Trades {
+		exitReasons[t.ExitReason]++
+	}
+	log.Printf("SMA%v/SMA%v: Start %.2f End %.2f Return %.2f%% MaxDrawdown %.2f%% Trades %v Exits %v\n",
+		r.Params.SmaShortTerm, r.Params.SmaLongTerm, r.StartEquity, r.EndEquity, r.Return*100, r.MaxDrawdown*100, r.NumTrades, exitReasons)
+	logSideMetrics(r.Long, r.Short)
 }
 
-func (w *Wallet) BuyAll(price float64) {
-	btcToBuy := w.USDT / price
-	w.BTC += btcToBuy
-	w.USDT = 0
+func logSideMetrics(long, short shared.SideMetrics) {
+	log.Printf("  Long:  Trades %v Wins %v PnL %.2f\n", long.Trades, long.Wins, long.PnL)
+	if short.Trades > 0 {
+		log.Printf("  Short: Trades %v Wins %v PnL %.2f Interest %.2f Liquidations %v\n", short.Trades, short.Wins, short.PnL, short.Interest, short.Liquidations)
+	}
 }
 
-func (w *Wallet) SellAll(price float64) {
-	usdtToBuy := w.BTC * price
-	w.USDT += usdtToBuy
-	w.BTC = 0
+func parseIntList(s string) []int {
+	var out []int
+	for _, f := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			log.Printf("[Warning] Skipping invalid number %q: %v\n", f, err)
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
 }
 
 // Example function to get last N items
-func SimulateLastN(collection *mongo.Collection, n int, startWallet Wallet) {
+func SimulateLastN(collection *mongo.Collection, n int, startWallet shared.Wallet) {
 	ctx := context.Background()
 	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}}).SetLimit(int64(n))
 	cursor, err := collection.Find(ctx, bson.D{}, opts)
@@ -66,7 +162,7 @@ func SimulateLastN(collection *mongo.Collection, n int, startWallet Wallet) {
 	for i := len(results) - 1; i >= 0; i-- {
 		v := results[i]
 
-		log.Printf("Time: %v Price: %v Action: %v\n", v.TimeStamp, v.Price, v.Signal)
+		log.Printf("Time: %v Price: %v Action: %v Reason: %v\n", v.TimeStamp, v.Price, v.Signal, v.Reason)
 		log.Printf("Old Wallet:%v\n", startWallet)
 
 		if v.Signal == "BUY" {
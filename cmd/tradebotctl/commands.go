@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kaanureyen/tradebot/cmd/shared"
+)
+
+// sends the request to the service and decodes its JSON reply into v, if not nil
+func (c *ctl) call(method, service, path string, query url.Values, v any) error {
+	u := c.urls[service] + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v %v: %v %v", method, path, res.Status, strings.TrimSpace(string(body)))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(body, v)
+}
+
+// readiness report of the service, also when it is not ready
+func (c *ctl) readiness(service string) (shared.HealthReport, error) {
+	var report shared.HealthReport
+	res, err := c.client.Get(c.urls[service] + "/readyz")
+	if err != nil {
+		return report, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusServiceUnavailable {
+		return report, fmt.Errorf("GET /readyz: %v", res.Status)
+	}
+	err = json.NewDecoder(res.Body).Decode(&report)
+	return report, err
+}
+
+func runStatus(c *ctl, args []string) error {
+	flags := newFlags("status")
+	db := flags.Bool("db", true, "show the last bar and signal from MongoDB")
+	flags.Parse(args)
+
+	tw := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVICE\tSTATUS\tDETAIL")
+	for _, s := range services {
+		start := time.Now()
+		report, err := c.readiness(s.name)
+		if err != nil {
+			fmt.Fprintf(tw, "%v\tdown\t%v\n", s.name, err)
+			continue
+		}
+		if report.Status != "ok" {
+			var failed []string
+			for name, res := range report.Checks {
+				if res.Status != "ok" {
+					failed = append(failed, name+": "+res.Error)
+				}
+			}
+			sort.Strings(failed)
+			fmt.Fprintf(tw, "%v\tnot ready\t%v\n", s.name, strings.Join(failed, "; "))
+			continue
+		}
+		fmt.Fprintf(tw, "%v\tready\t%v\n", s.name, time.Since(start).Round(time.Millisecond))
+	}
+	tw.Flush()
+	fmt.Fprintln(c.out)
+
+	var paused struct {
+		Paused bool `json:"paused"`
+	}
+	if err := c.call(http.MethodGet, "aggregator", "/signals", nil, &paused); err != nil {
+		fmt.Fprintf(c.out, "signals:     unknown (%v)\n", err)
+	} else if paused.Paused {
+		fmt.Fprintln(c.out, "signals:     paused")
+	} else {
+		fmt.Fprintln(c.out, "signals:     running")
+	}
+	var killSwitch struct {
+		Killed bool   `json:"killed"`
+		Reason string `json:"reason"`
+	}
+	if err := c.call(http.MethodGet, "papertrader", "/killswitch", nil, &killSwitch); err != nil {
+		fmt.Fprintf(c.out, "kill switch: unknown (%v)\n", err)
+	} else if killSwitch.Killed {
+		fmt.Fprintf(c.out, "kill switch: engaged (%v)\n", killSwitch.Reason)
+	} else {
+		fmt.Fprintln(c.out, "kill switch: released")
+	}
+	if !*db {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.client.Timeout)
+	defer cancel()
+	now := time.Now()
+	if bars, err := c.mongo().lastBars(ctx, 1); err != nil {
+		fmt.Fprintf(c.out, "last bar:    unknown (%v)\n", err)
+	} else if len(bars) == 0 {
+		fmt.Fprintln(c.out, "last bar:    none")
+	} else {
+		b := bars[0]
+		fmt.Fprintf(c.out, "last bar:    %v close %v (%v ago)\n", formatTime(b.FirstTime.Truncate(shared.AggregatePeriod)), b.LastPrice, now.Sub(b.LastTime).Round(time.Second))
+	}
+	if signals, err := c.mongo().lastSignals(ctx, 1); err != nil {
+		fmt.Fprintf(c.out, "last signal: unknown (%v)\n", err)
+	} else if len(signals) == 0 {
+		fmt.Fprintln(c.out, "last signal: none")
+	} else {
+		s := signals[0]
+		fmt.Fprintf(c.out, "last signal: %v %v at %v (%v ago)\n", formatTime(s.TimeStamp), s.Signal, s.Price, now.Sub(s.TimeStamp).Round(time.Second))
+	}
+	return nil
+}
+
+func runSignals(c *ctl, args []string) error {
+	flags := newFlags("signals")
+	n := flags.Int("n", 20, "number of signals")
+	flags.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.client.Timeout)
+	defer cancel()
+	signals, err := c.mongo().lastSignals(ctx, *n)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tSIGNAL\tPRICE\tSMA SHORT\tSMA LONG\tREASON")
+	for i := len(signals) - 1; i >= 0; i-- {
+		s := signals[i]
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%.2f\t%.2f\t%v\n", formatTime(s.TimeStamp), s.Signal, s.Price, s.Sma50, s.Sma200, s.Reason)
+	}
+	return tw.Flush()
+}
+
+func runBars(c *ctl, args []string) error {
+	flags := newFlags("bars")
+	n := flags.Int("n", 20, "number of bars")
+	flags.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.client.Timeout)
+	defer cancel()
+	bars, err := c.mongo().lastBars(ctx, *n)
+	if err != nil {
+		return err
+	}
+	smas, err := c.mongo().smasOf(ctx, bars)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "START\tOPEN\tHIGH\tLOW\tCLOSE\tVOLUME\tSMA SHORT\tSMA LONG")
+	for i := len(bars) - 1; i >= 0; i-- {
+		b := bars[i]
+		short, long := "-", "-"
+		if s, ok := smas[b.LastTime.UnixMilli()]; ok {
+			short, long = fmt.Sprintf("%.2f", s.Sma50), fmt.Sprintf("%.2f", s.Sma200)
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", formatTime(b.FirstTime.Truncate(shared.AggregatePeriod)),
+			b.FirstPrice, b.MaxPrice, b.MinPrice, b.LastPrice, b.Volume, short, long)
+	}
+	return tw.Flush()
+}
+
+// recompute or backfill on the aggregator
+func runMaintenance(action string) func(c *ctl, args []string) error {
+	return func(c *ctl, args []string) error {
+		flags := newFlags(action)
+		from := flags.String("from", "", "start of the range, RFC 3339 or unix milliseconds (required)")
+		to := flags.String("to", "", "end of the range, RFC 3339 or unix milliseconds. defaults to now")
+		flags.Parse(args)
+
+		query := url.Values{}
+		for name, v := range map[string]string{"from": *from, "to": *to} {
+			if v == "" {
+				continue
+			}
+			if _, err := shared.ParseTime(v); err != nil {
+				return fmt.Errorf("-%v must be RFC 3339 or unix milliseconds", name)
+			}
+			query.Set(name, v)
+		}
+		if *from == "" {
+			return fmt.Errorf("-from is required")
+		}
+		var res struct {
+			Count int `json:"count"`
+		}
+		if err := c.call(http.MethodPost, "aggregator", "/"+action, query, &res); err != nil {
+			return err
+		}
+		switch action {
+		case "recompute":
+			fmt.Fprintf(c.out, "recomputed %v SMAs\n", res.Count)
+		case "backfill":
+			fmt.Fprintf(c.out, "backfilled %v bars\n", res.Count)
+		}
+		return nil
+	}
+}
+
+// pauses or resumes signal generation on the aggregator
+func runPause(pause bool) func(c *ctl, args []string) error {
+	return func(c *ctl, args []string) error {
+		var res struct {
+			Paused bool `json:"paused"`
+		}
+		query := url.Values{"paused": {strconv.FormatBool(pause)}}
+		if err := c.call(http.MethodPost, "aggregator", "/signals", query, &res); err != nil {
+			return err
+		}
+		if res.Paused {
+			fmt.Fprintln(c.out, "signal generation paused")
+		} else {
+			fmt.Fprintln(c.out, "signal generation resumed")
+		}
+		return nil
+	}
+}
+
+// shows or changes the log level of a service: loglevel <service> [level]
+func runLogLevel(c *ctl, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: loglevel <service> [debug|info|warn|error]")
+	}
+	if _, ok := c.urls[args[0]]; !ok {
+		return fmt.Errorf("unknown service %v", args[0])
+	}
+	var res struct {
+		Level string `json:"level"`
+	}
+	method, query := http.MethodGet, url.Values{}
+	if len(args) == 2 {
+		method = http.MethodPost
+		query.Set("level", args[1])
+	}
+	if err := c.call(method, args[0], "/loglevel", query, &res); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "%v log level: %v\n", args[0], res.Level)
+	return nil
+}
+
+func runBacktest(c *ctl, args []string) error {
+	flags := newFlags("backtest")
+	n := flags.Int("n", 5760, "number of the last bars to backtest on")
+	usdt := flags.Float64("usdt", 1000, "starting USDT balance")
+	shortTerms := flags.String("short", "10,20,50", "comma separated short SMA lengths to search")
+	longTerms := flags.String("long", "100,200,400", "comma separated long SMA lengths to search")
+	top := flags.Int("top", 10, "number of the best results to show")
+	flags.Parse(args)
+
+	grid := shared.ParamGrid{
+		Sizing: shared.SizingConfigFromEnv(),
+		Exits:  shared.ExitRulesFromEnv(),
+		Margin: shared.MarginConfigFromEnv(),
+		Orders: shared.OrderConfigFromEnv(),
+	}
+	var err error
+	if grid.SmaShortTerms, err = parseIntList(*shortTerms); err != nil {
+		return fmt.Errorf("-short: %w", err)
+	}
+	if grid.SmaLongTerms, err = parseIntList(*longTerms); err != nil {
+		return fmt.Errorf("-long: %w", err)
+	}
+	if len(grid.Combinations()) == 0 {
+		return fmt.Errorf("no short SMA length is below a long one")
+	}
+
+	bars := shared.LoadLastNBars(c.mongo().aggr, *n)
+	if len(bars) <= grid.MaxLongTerm() {
+		return fmt.Errorf("%v bars are not enough for SMA%v", len(bars), grid.MaxLongTerm())
+	}
+	results := shared.GridSearch(bars, 0, grid, shared.Wallet{USDT: *usdt})
+	if len(results) > *top {
+		results = results[:*top]
+	}
+	fmt.Fprintf(c.out, "%v bars from %v to %v\n\n", len(bars), formatTime(bars[0].FirstTime), formatTime(bars[len(bars)-1].LastTime))
+	tw := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SMA\tRETURN\tMAX DRAWDOWN\tTRADES\tEND EQUITY")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%v/%v\t%.2f%%\t%.2f%%\t%v\t%.2f\n", r.Params.SmaShortTerm, r.Params.SmaLongTerm, r.Return*100, r.MaxDrawdown*100, r.NumTrades, r.EndEquity)
+	}
+	return tw.Flush()
+}
+
+func parseIntList(s string) ([]int, error) {
+	var out []int
+	for _, f := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
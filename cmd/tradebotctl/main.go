@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/kaanureyen/tradebot/cmd/shared"
+)
+
+// admin ports of the services, as published by docker-compose.yml
+var services = []struct {
+	name string
+	port int
+}{
+	{"fetcher", 9000},
+	{"aggregator", 9001},
+	{"papertrader", 9002},
+	{"mockexchange", 9003},
+	{"notifier", 9004},
+	{"api", 9005},
+}
+
+// subcommand of the CLI
+type command struct {
+	usage string
+	run   func(c *ctl, args []string) error
+}
+
+var commands = map[string]command{
+	"status":    {"pipeline health, last bar and signal, paused and killed state", runStatus},
+	"signals":   {"recent trade signals", runSignals},
+	"bars":      {"latest bars with their SMAs", runBars},
+	"recompute": {"recompute the stored SMAs of a range", runMaintenance("recompute")},
+	"backfill":  {"fetch the missing bars of a range from the exchange", runMaintenance("backfill")},
+	"pause":     {"pause signal generation", runPause(true)},
+	"resume":    {"resume signal generation", runPause(false)},
+	"backtest":  {"grid search SMA lengths over the stored bars", runBacktest},
+	"loglevel":  {"show or change the log level of a service", runLogLevel},
+}
+
+// state shared by the subcommands
+type ctl struct {
+	out    io.Writer
+	urls   map[string]string // base URL of the admin server of each service
+	token  string            // ADMIN_TOKEN of the services, for their control actions
+	client *http.Client
+	store  *mongoStore // connected on first use
+}
+
+func serviceURLs(host string) map[string]string {
+	urls := make(map[string]string)
+	for _, s := range services {
+		urls[s.name] = fmt.Sprintf("http://%v:%v", host, s.port)
+	}
+	return urls
+}
+
+func (c *ctl) mongo() *mongoStore {
+	if c.store == nil {
+		c.store = connectMongo()
+	}
+	return c.store
+}
+
+func main() {
+	flags := flag.NewFlagSet("tradebotctl", flag.ExitOnError)
+	host := flags.String("host", "localhost", "host of the service endpoints")
+	flags.StringVar(&shared.MongoUri, "mongo", shared.MongoUri, "MongoDB URI")
+	timeout := flags.Duration("timeout", time.Minute, "timeout of the requests to the services")
+	token := flags.String("token", os.Getenv("ADMIN_TOKEN"), "admin token of the services, ADMIN_TOKEN by default")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: tradebotctl [flags] <command> [command flags]\n\nCommands:")
+		var names []string
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(flags.Output(), "  %-10v %v\n", name, commands[name].usage)
+		}
+		fmt.Fprintln(flags.Output(), "\nFlags:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		flags.Usage()
+		os.Exit(2)
+	}
+	log.SetFlags(0) // library logs go to stderr, without timestamps
+	c := &ctl{out: os.Stdout, urls: serviceURLs(*host), token: *token, client: &http.Client{Timeout: *timeout}}
+	err := cmd.run(c, flags.Args()[1:])
+	if c.store != nil {
+		c.store.client.Disconnect(context.Background())
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tradebotctl:", err)
+		os.Exit(1)
+	}
+}
+
+// flag set of a subcommand, usage errors exit with 2
+func newFlags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet("tradebotctl "+name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: tradebotctl %v [flags]\n\nFlags:\n", name)
+		flags.PrintDefaults()
+	}
+	return flags
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+
+	"github.com/kaanureyen/tradebot/cmd/shared"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// collections read by the CLI
+type mongoStore struct {
+	client *mongo.Client
+	aggr   *mongo.Collection
+	sma    *mongo.Collection
+	signal *mongo.Collection
+}
+
+func connectMongo() *mongoStore {
+	client, ctx := shared.MongoConnect()
+	return &mongoStore{
+		client: client,
+		aggr:   shared.MongoAggregateCollection(client, ctx),
+		sma:    shared.MongoSmaCollection(client, ctx),
+		signal: shared.MongoTradeCollection(client, ctx),
+	}
+}
+
+// last n documents of the collection by timeField, newest first
+func findLast[T any](ctx context.Context, collection *mongo.Collection, timeField string, filter bson.D, n int) ([]T, error) {
+	if filter == nil {
+		filter = bson.D{}
+	}
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: timeField, Value: -1}}).SetLimit(int64(n)))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var results []T
+	err = cursor.All(ctx, &results)
+	return results, err
+}
+
+// last n stored bars, newest first. gaps are not filled
+func (s *mongoStore) lastBars(ctx context.Context, n int) ([]shared.AggregatedTradeInfo, error) {
+	return findLast[shared.AggregatedTradeInfo](ctx, s.aggr, "lasttimestamp", nil, n)
+}
+
+// SMAs of the bars, keyed by the last trade time of the bar in unix ms
+func (s *mongoStore) smasOf(ctx context.Context, bars []shared.AggregatedTradeInfo) (map[int64]shared.SmaStruct, error) {
+	out := make(map[int64]shared.SmaStruct)
+	if len(bars) == 0 {
+		return out, nil
+	}
+	oldest := bars[len(bars)-1].LastTime
+	filter := bson.D{{Key: "timestamp", Value: bson.D{{Key: "$gte", Value: oldest}}}}
+	smas, err := findLast[shared.SmaStruct](ctx, s.sma, "timestamp", filter, len(bars)*2)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range smas {
+		out[v.TimeStamp.UnixMilli()] = v
+	}
+	return out, nil
+}
+
+// last n trade signals, newest first
+func (s *mongoStore) lastSignals(ctx context.Context, n int) ([]shared.TradeSignal, error) {
+	return findLast[shared.TradeSignal](ctx, s.signal, "timestamp", nil, n)
+}
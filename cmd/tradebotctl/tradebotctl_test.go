@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// local stand-in of the aggregator and papertrader control endpoints, records the requests
+func serviceStandIn(t *testing.T) (*httptest.Server, *[]string) {
+	var requests []string
+	paused := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		if r.Method == http.MethodPost && r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "admin token required", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/readyz":
+			w.Write([]byte(`{"status":"ok","checks":{}}`))
+		case "/notready/readyz":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"status":"fail","checks":{"redis":{"status":"ok"},"mongodb":{"status":"fail","error":"connection refused"}}}`))
+		case "/signals":
+			if r.Method == http.MethodPost {
+				paused = r.URL.Query().Get("paused") == "true"
+			}
+			if paused {
+				w.Write([]byte(`{"paused":true}`))
+			} else {
+				w.Write([]byte(`{"paused":false}`))
+			}
+		case "/killswitch":
+			w.Write([]byte(`{"killed":true,"reason":"DAILY_LOSS"}`))
+		case "/recompute":
+			w.Write([]byte(`{"count":42}`))
+		case "/loglevel":
+			if r.Method == http.MethodPost {
+				w.Write([]byte(`{"level":"` + strings.ToUpper(r.URL.Query().Get("level")) + `"}`))
+			} else {
+				w.Write([]byte(`{"level":"INFO"}`))
+			}
+		default:
+			http.Error(w, "range is longer than 24h0m0s", http.StatusInternalServerError)
+		}
+	}))
+	return server, &requests
+}
+
+func testCtl(server *httptest.Server) (*ctl, *bytes.Buffer) {
+	var out bytes.Buffer
+	urls := map[string]string{}
+	for _, s := range services {
+		urls[s.name] = server.URL
+	}
+	urls["notifier"] = "http://127.0.0.1:1" // down
+	urls["api"] = server.URL + "/notready"
+	return &ctl{out: &out, urls: urls, token: "secret", client: &http.Client{Timeout: time.Second}}, &out
+}
+
+func TestStatus(t *testing.T) {
+	server, _ := serviceStandIn(t)
+	defer server.Close()
+	c, out := testCtl(server)
+
+	if err := runStatus(c, []string{"-db=false"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"aggregator    ready", "notifier      down", "api           not ready  mongodb: connection refused", "signals:     running", "kill switch: engaged (DAILY_LOSS)"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("status output misses %q:\n%v", want, out)
+		}
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	server, requests := serviceStandIn(t)
+	defer server.Close()
+	c, out := testCtl(server)
+
+	if err := commands["pause"].run(c, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := commands["resume"].run(c, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "signal generation paused\nsignal generation resumed\n"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	if got, want := strings.Join(*requests, ","), "POST /signals?paused=true,POST /signals?paused=false"; got != want {
+		t.Errorf("got requests %v; want %v", got, want)
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	server, requests := serviceStandIn(t)
+	defer server.Close()
+	c, out := testCtl(server)
+
+	if err := commands["recompute"].run(c, []string{"-from", "2025-01-01T00:00:00Z", "-to", "1735693200000"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "recomputed 42 SMAs\n"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	if got, want := (*requests)[0], "POST /recompute?from=2025-01-01T00%3A00%3A00Z&to=1735693200000"; got != want {
+		t.Errorf("got request %v; want %v", got, want)
+	}
+
+	err := commands["backfill"].run(c, []string{"-from", "2025-01-01T00:00:00Z"})
+	if err == nil || !strings.Contains(err.Error(), "range is longer") {
+		t.Errorf("got error %v; want the error of the aggregator", err)
+	}
+	if err := commands["backfill"].run(c, []string{"-from", "yesterday"}); err == nil {
+		t.Error("invalid -from was accepted")
+	}
+	if err := commands["backfill"].run(c, nil); err == nil {
+		t.Error("missing -from was accepted")
+	}
+	if len(*requests) != 2 {
+		t.Errorf("got %v requests; want 2, invalid ranges must not be sent", len(*requests))
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	server, requests := serviceStandIn(t)
+	defer server.Close()
+	c, out := testCtl(server)
+
+	if err := commands["loglevel"].run(c, []string{"fetcher"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := commands["loglevel"].run(c, []string{"aggregator", "debug"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "fetcher log level: INFO\naggregator log level: DEBUG\n"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	if got, want := strings.Join(*requests, ","), "GET /loglevel,POST /loglevel?level=debug"; got != want {
+		t.Errorf("got requests %v; want %v", got, want)
+	}
+	if err := commands["loglevel"].run(c, []string{"unknown"}); err == nil {
+		t.Error("unknown service was accepted")
+	}
+}
@@ -0,0 +1,370 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: proto/tradebot/v1/tradebot.proto
+
+// market data and trade signals of tradebot.
+// regenerate the Go code from the repository root with
+//   protoc --go_out=. --go_opt=module=github.com/kaanureyen/tradebot --go-grpc_out=. --go-grpc_opt=module=github.com/kaanureyen/tradebot proto/tradebot/v1/tradebot.proto
+
+package tradebotv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	MarketData_GetBars_FullMethodName             = "/tradebot.v1.MarketData/GetBars"
+	MarketData_GetIndicators_FullMethodName       = "/tradebot.v1.MarketData/GetIndicators"
+	MarketData_GetSignals_FullMethodName          = "/tradebot.v1.MarketData/GetSignals"
+	MarketData_SubscribeTrades_FullMethodName     = "/tradebot.v1.MarketData/SubscribeTrades"
+	MarketData_SubscribeBars_FullMethodName       = "/tradebot.v1.MarketData/SubscribeBars"
+	MarketData_SubscribeIndicators_FullMethodName = "/tradebot.v1.MarketData/SubscribeIndicators"
+	MarketData_SubscribeSignals_FullMethodName    = "/tradebot.v1.MarketData/SubscribeSignals"
+)
+
+// MarketDataClient is the client API for MarketData service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// subscribers falling behind are ended with RESOURCE_EXHAUSTED
+type MarketDataClient interface {
+	GetBars(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*BarsResponse, error)
+	GetIndicators(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*IndicatorsResponse, error)
+	GetSignals(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*SignalsResponse, error)
+	SubscribeTrades(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Trade], error)
+	SubscribeBars(ctx context.Context, in *SubscribeBarsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Bar], error)
+	SubscribeIndicators(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Indicator], error)
+	SubscribeSignals(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TradeSignal], error)
+}
+
+type marketDataClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMarketDataClient(cc grpc.ClientConnInterface) MarketDataClient {
+	return &marketDataClient{cc}
+}
+
+func (c *marketDataClient) GetBars(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*BarsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BarsResponse)
+	err := c.cc.Invoke(ctx, MarketData_GetBars_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *marketDataClient) GetIndicators(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*IndicatorsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(IndicatorsResponse)
+	err := c.cc.Invoke(ctx, MarketData_GetIndicators_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *marketDataClient) GetSignals(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*SignalsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SignalsResponse)
+	err := c.cc.Invoke(ctx, MarketData_GetSignals_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *marketDataClient) SubscribeTrades(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Trade], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MarketData_ServiceDesc.Streams[0], MarketData_SubscribeTrades_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubscribeRequest, Trade]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MarketData_SubscribeTradesClient = grpc.ServerStreamingClient[Trade]
+
+func (c *marketDataClient) SubscribeBars(ctx context.Context, in *SubscribeBarsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Bar], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MarketData_ServiceDesc.Streams[1], MarketData_SubscribeBars_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubscribeBarsRequest, Bar]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MarketData_SubscribeBarsClient = grpc.ServerStreamingClient[Bar]
+
+func (c *marketDataClient) SubscribeIndicators(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Indicator], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MarketData_ServiceDesc.Streams[2], MarketData_SubscribeIndicators_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubscribeRequest, Indicator]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MarketData_SubscribeIndicatorsClient = grpc.ServerStreamingClient[Indicator]
+
+func (c *marketDataClient) SubscribeSignals(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TradeSignal], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MarketData_ServiceDesc.Streams[3], MarketData_SubscribeSignals_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubscribeRequest, TradeSignal]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MarketData_SubscribeSignalsClient = grpc.ServerStreamingClient[TradeSignal]
+
+// MarketDataServer is the server API for MarketData service.
+// All implementations must embed UnimplementedMarketDataServer
+// for forward compatibility.
+//
+// subscribers falling behind are ended with RESOURCE_EXHAUSTED
+type MarketDataServer interface {
+	GetBars(context.Context, *HistoryRequest) (*BarsResponse, error)
+	GetIndicators(context.Context, *HistoryRequest) (*IndicatorsResponse, error)
+	GetSignals(context.Context, *HistoryRequest) (*SignalsResponse, error)
+	SubscribeTrades(*SubscribeRequest, grpc.ServerStreamingServer[Trade]) error
+	SubscribeBars(*SubscribeBarsRequest, grpc.ServerStreamingServer[Bar]) error
+	SubscribeIndicators(*SubscribeRequest, grpc.ServerStreamingServer[Indicator]) error
+	SubscribeSignals(*SubscribeRequest, grpc.ServerStreamingServer[TradeSignal]) error
+	mustEmbedUnimplementedMarketDataServer()
+}
+
+// UnimplementedMarketDataServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedMarketDataServer struct{}
+
+func (UnimplementedMarketDataServer) GetBars(context.Context, *HistoryRequest) (*BarsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBars not implemented")
+}
+func (UnimplementedMarketDataServer) GetIndicators(context.Context, *HistoryRequest) (*IndicatorsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetIndicators not implemented")
+}
+func (UnimplementedMarketDataServer) GetSignals(context.Context, *HistoryRequest) (*SignalsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSignals not implemented")
+}
+func (UnimplementedMarketDataServer) SubscribeTrades(*SubscribeRequest, grpc.ServerStreamingServer[Trade]) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeTrades not implemented")
+}
+func (UnimplementedMarketDataServer) SubscribeBars(*SubscribeBarsRequest, grpc.ServerStreamingServer[Bar]) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeBars not implemented")
+}
+func (UnimplementedMarketDataServer) SubscribeIndicators(*SubscribeRequest, grpc.ServerStreamingServer[Indicator]) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeIndicators not implemented")
+}
+func (UnimplementedMarketDataServer) SubscribeSignals(*SubscribeRequest, grpc.ServerStreamingServer[TradeSignal]) error {
+	return status.Errorf(codes.Unimplemented, "method SubscribeSignals not implemented")
+}
+func (UnimplementedMarketDataServer) mustEmbedUnimplementedMarketDataServer() {}
+func (UnimplementedMarketDataServer) testEmbeddedByValue()                    {}
+
+// UnsafeMarketDataServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MarketDataServer will
+// result in compilation errors.
+type UnsafeMarketDataServer interface {
+	mustEmbedUnimplementedMarketDataServer()
+}
+
+func RegisterMarketDataServer(s grpc.ServiceRegistrar, srv MarketDataServer) {
+	// If the following call pancis, it indicates UnimplementedMarketDataServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&MarketData_ServiceDesc, srv)
+}
+
+func _MarketData_GetBars_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MarketDataServer).GetBars(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MarketData_GetBars_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MarketDataServer).GetBars(ctx, req.(*HistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MarketData_GetIndicators_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MarketDataServer).GetIndicators(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MarketData_GetIndicators_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MarketDataServer).GetIndicators(ctx, req.(*HistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MarketData_GetSignals_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MarketDataServer).GetSignals(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MarketData_GetSignals_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MarketDataServer).GetSignals(ctx, req.(*HistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MarketData_SubscribeTrades_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MarketDataServer).SubscribeTrades(m, &grpc.GenericServerStream[SubscribeRequest, Trade]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MarketData_SubscribeTradesServer = grpc.ServerStreamingServer[Trade]
+
+func _MarketData_SubscribeBars_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeBarsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MarketDataServer).SubscribeBars(m, &grpc.GenericServerStream[SubscribeBarsRequest, Bar]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MarketData_SubscribeBarsServer = grpc.ServerStreamingServer[Bar]
+
+func _MarketData_SubscribeIndicators_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MarketDataServer).SubscribeIndicators(m, &grpc.GenericServerStream[SubscribeRequest, Indicator]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MarketData_SubscribeIndicatorsServer = grpc.ServerStreamingServer[Indicator]
+
+func _MarketData_SubscribeSignals_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MarketDataServer).SubscribeSignals(m, &grpc.GenericServerStream[SubscribeRequest, TradeSignal]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MarketData_SubscribeSignalsServer = grpc.ServerStreamingServer[TradeSignal]
+
+// MarketData_ServiceDesc is the grpc.ServiceDesc for MarketData service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MarketData_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "tradebot.v1.MarketData",
+	HandlerType: (*MarketDataServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetBars",
+			Handler:    _MarketData_GetBars_Handler,
+		},
+		{
+			MethodName: "GetIndicators",
+			Handler:    _MarketData_GetIndicators_Handler,
+		},
+		{
+			MethodName: "GetSignals",
+			Handler:    _MarketData_GetSignals_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SubscribeTrades",
+			Handler:       _MarketData_SubscribeTrades_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "SubscribeBars",
+			Handler:       _MarketData_SubscribeBars_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "SubscribeIndicators",
+			Handler:       _MarketData_SubscribeIndicators_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "SubscribeSignals",
+			Handler:       _MarketData_SubscribeSignals_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proto/tradebot/v1/tradebot.proto",
+}